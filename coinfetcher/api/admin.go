@@ -0,0 +1,404 @@
+package price_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	authUtils "coinfetcher/services/auth"
+	cacheUtils "coinfetcher/services/cache"
+	geckoUtils "coinfetcher/services/gecko"
+	requestUtils "coinfetcher/services/request"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// auditLogSize is the number of admin actions kept for "GET /admin/audit".
+const auditLogSize = 200
+
+// redacted replaces secret configuration values.
+const redacted = "REDACTED"
+
+// secretSetting matches the names of settings whose values are secrets.
+var secretSetting = regexp.MustCompile(`(?i)secret|password|passwd|token|credential|hash-api-key`)
+
+// Pausable is a background poller that can be paused and resumed at runtime.
+type Pausable interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// AdminConfig configures the "/admin" API.
+type AdminConfig struct {
+	Pollers map[string]Pausable // Background pollers operators may pause, by name.
+	Config  map[string]string   // Effective configuration, such as the command-line flags. Secrets are redacted when shown.
+}
+
+// WithAdmin enables the "/admin" API to inspect and flush caches, edit the poller's watchlist,
+// pause pollers, control circuit breakers, change the log level and view the configuration.
+// It is only served when API keys or bearer tokens are enabled, and requires the admin scope.
+func WithAdmin(config AdminConfig) Option {
+	return func(s *JSONAPIServer) {
+		s.admin = &config
+	}
+}
+
+// auditEntry records one admin action.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	Subject   string    `json:"subject"`
+	Remote    string    `json:"remote"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog keeps the most recent admin actions in memory, on top of writing them to the log.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+}
+
+// add records entry, dropping the oldest one once the log is full.
+func (l *auditLog) add(entry auditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > auditLogSize {
+		l.entries = l.entries[len(l.entries)-auditLogSize:]
+	}
+}
+
+// recent returns the recorded actions, newest first.
+func (l *auditLog) recent() []auditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]auditEntry, len(l.entries))
+	for i, entry := range l.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// newAdminRouter creates the router serving the "/admin" API.
+func (s *JSONAPIServer) newAdminRouter() *router {
+	rt := s.newEnvelopeRouter()
+
+	rt.handle(http.MethodGet, "/admin/caches", s.makeAdminHandler("cache.list", s.handleAdminCaches))
+	rt.handle(http.MethodGet, "/admin/caches/{name}", s.makeAdminHandler("cache.inspect", s.handleAdminCache))
+	rt.handle(http.MethodDelete, "/admin/caches/{name}", s.makeAdminHandler("cache.flush", s.handleAdminFlushCache))
+	rt.handle(http.MethodGet, "/admin/caches/{name}/entries/{key}", s.makeAdminHandler("cache.entry", s.handleAdminCacheEntry))
+	rt.handle(http.MethodDelete, "/admin/caches/{name}/entries/{key}", s.makeAdminHandler("cache.evict", s.handleAdminFlushCacheEntry))
+
+	if s.poller != nil {
+		rt.handle(http.MethodGet, "/admin/watchlist", s.makeAdminHandler("watchlist.list", s.handleAdminWatchlist))
+		rt.handle(http.MethodPut, "/admin/watchlist/{ticker}", s.makeAdminHandler("watchlist.add", s.handleAdminWatch))
+		rt.handle(http.MethodDelete, "/admin/watchlist/{ticker}", s.makeAdminHandler("watchlist.remove", s.handleAdminUnwatch))
+	}
+
+	rt.handle(http.MethodGet, "/admin/pollers", s.makeAdminHandler("poller.list", s.handleAdminPollers))
+	rt.handle(http.MethodPost, "/admin/pollers/{name}/pause", s.makeAdminHandler("poller.pause", s.handleAdminPausePoller))
+	rt.handle(http.MethodPost, "/admin/pollers/{name}/resume", s.makeAdminHandler("poller.resume", s.handleAdminResumePoller))
+
+	rt.handle(http.MethodGet, "/admin/breakers", s.makeAdminHandler("breaker.list", s.handleAdminBreakers))
+	rt.handle(http.MethodPost, "/admin/breakers/{name}/trip", s.makeAdminHandler("breaker.trip", s.handleAdminTripBreaker))
+	rt.handle(http.MethodPost, "/admin/breakers/{name}/reset", s.makeAdminHandler("breaker.reset", s.handleAdminResetBreaker))
+
+	rt.handle(http.MethodGet, "/admin/log-level", s.makeAdminHandler("loglevel.get", s.handleAdminLogLevel))
+	rt.handle(http.MethodPut, "/admin/log-level", s.makeAdminHandler("loglevel.set", s.handleAdminSetLogLevel))
+
+	rt.handle(http.MethodGet, "/admin/config", s.makeAdminHandler("config.get", s.handleAdminConfig))
+	rt.handle(http.MethodGet, "/admin/audit", s.makeAdminHandler("audit.list", s.handleAdminAudit))
+
+	return rt
+}
+
+// makeAdminHandler wraps an admin endpoint like makeV2Handler, and audit-logs every call.
+func (s *JSONAPIServer) makeAdminHandler(action string, fn v2Func) http.Handler {
+	return s.makeV2Handler(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		data, err := fn(ctx, r)
+
+		entry := auditEntry{
+			Time:      time.Now().UTC(),
+			RequestID: requestUtils.RequestIDFromContext(ctx),
+			Subject:   authUtils.SubjectFromContext(ctx),
+			Remote:    r.RemoteAddr,
+			Action:    action,
+			Target:    r.URL.Path,
+			Status:    http.StatusOK,
+		}
+		if err != nil {
+			entry.Status = problemFor(r, err).Status
+			entry.Error = err.Error()
+		}
+		s.auditLog.add(entry)
+
+		log.WithFields(log.Fields{
+			"audit":     true,
+			"requestID": entry.RequestID,
+			"subject":   entry.Subject,
+			"remote":    entry.Remote,
+			"action":    entry.Action,
+			"target":    entry.Target,
+			"status":    entry.Status,
+			"err":       err,
+		}).Info("admin")
+
+		return data, err
+	})
+}
+
+// notFound creates a 404 error for a missing admin resource.
+func notFound(what, name string) error {
+	return &statusError{status: http.StatusNotFound, code: "not_found", message: what + " " + name + " does not exist"}
+}
+
+// cacheSummary describes a cache in "GET /admin/caches".
+type cacheSummary struct {
+	Name    string `json:"name"`
+	TTL     string `json:"ttl"`
+	Entries int    `json:"entries"`
+}
+
+// handleAdminCaches handles "GET /admin/caches".
+func (s *JSONAPIServer) handleAdminCaches(ctx context.Context, r *http.Request) (interface{}, error) {
+	summaries := []cacheSummary{}
+	for _, c := range cacheUtils.Caches() {
+		summaries = append(summaries, cacheSummary{Name: c.Name(), TTL: c.TTL().String(), Entries: len(c.Entries())})
+	}
+	return summaries, nil
+}
+
+// adminCache returns the cache named by the "name" route parameter.
+func adminCache(r *http.Request) (cacheUtils.Cache, error) {
+	c, ok := cacheUtils.LookupCache(routeParam(r, "name"))
+	if !ok {
+		return nil, notFound("cache", routeParam(r, "name"))
+	}
+	return c, nil
+}
+
+// handleAdminCache handles "GET /admin/caches/{name}", listing the entries without their values.
+func (s *JSONAPIServer) handleAdminCache(ctx context.Context, r *http.Request) (interface{}, error) {
+	c, err := adminCache(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Entries(), nil
+}
+
+// handleAdminCacheEntry handles "GET /admin/caches/{name}/entries/{key}".
+func (s *JSONAPIServer) handleAdminCacheEntry(ctx context.Context, r *http.Request) (interface{}, error) {
+	c, err := adminCache(r)
+	if err != nil {
+		return nil, err
+	}
+	value, info, ok := c.Entry(routeParam(r, "key"))
+	if !ok {
+		return nil, notFound("cache entry", routeParam(r, "key"))
+	}
+	return map[string]interface{}{"entry": info, "value": value}, nil
+}
+
+// handleAdminFlushCache handles "DELETE /admin/caches/{name}".
+func (s *JSONAPIServer) handleAdminFlushCache(ctx context.Context, r *http.Request) (interface{}, error) {
+	c, err := adminCache(r)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"flushed": c.FlushAll()}, nil
+}
+
+// handleAdminFlushCacheEntry handles "DELETE /admin/caches/{name}/entries/{key}".
+func (s *JSONAPIServer) handleAdminFlushCacheEntry(ctx context.Context, r *http.Request) (interface{}, error) {
+	c, err := adminCache(r)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Flush(routeParam(r, "key")) {
+		return nil, notFound("cache entry", routeParam(r, "key"))
+	}
+	return map[string]int{"flushed": 1}, nil
+}
+
+// handleAdminWatchlist handles "GET /admin/watchlist".
+func (s *JSONAPIServer) handleAdminWatchlist(ctx context.Context, r *http.Request) (interface{}, error) {
+	return s.poller.Watchlist(), nil
+}
+
+// handleAdminWatch handles "PUT /admin/watchlist/{ticker}".
+func (s *JSONAPIServer) handleAdminWatch(ctx context.Context, r *http.Request) (interface{}, error) {
+	ticker := strings.ToLower(strings.TrimSpace(routeParam(r, "ticker")))
+	if ticker == "" {
+		return nil, badRequest("ticker is required")
+	}
+	s.poller.AddToWatchlist(ticker)
+	return s.poller.Watchlist(), nil
+}
+
+// handleAdminUnwatch handles "DELETE /admin/watchlist/{ticker}".
+func (s *JSONAPIServer) handleAdminUnwatch(ctx context.Context, r *http.Request) (interface{}, error) {
+	s.poller.RemoveFromWatchlist(strings.ToLower(routeParam(r, "ticker")))
+	return s.poller.Watchlist(), nil
+}
+
+// pollerStatus describes a poller in "GET /admin/pollers".
+type pollerStatus struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// handleAdminPollers handles "GET /admin/pollers".
+func (s *JSONAPIServer) handleAdminPollers(ctx context.Context, r *http.Request) (interface{}, error) {
+	statuses := []pollerStatus{}
+	for name, p := range s.admin.Pollers {
+		statuses = append(statuses, pollerStatus{Name: name, Paused: p.Paused()})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+// adminPoller returns the poller named by the "name" route parameter.
+func (s *JSONAPIServer) adminPoller(r *http.Request) (Pausable, error) {
+	p, ok := s.admin.Pollers[routeParam(r, "name")]
+	if !ok {
+		return nil, notFound("poller", routeParam(r, "name"))
+	}
+	return p, nil
+}
+
+// handleAdminPausePoller handles "POST /admin/pollers/{name}/pause".
+func (s *JSONAPIServer) handleAdminPausePoller(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := s.adminPoller(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Pause()
+	return pollerStatus{Name: routeParam(r, "name"), Paused: p.Paused()}, nil
+}
+
+// handleAdminResumePoller handles "POST /admin/pollers/{name}/resume".
+func (s *JSONAPIServer) handleAdminResumePoller(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := s.adminPoller(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Resume()
+	return pollerStatus{Name: routeParam(r, "name"), Paused: p.Paused()}, nil
+}
+
+// handleAdminBreakers handles "GET /admin/breakers".
+func (s *JSONAPIServer) handleAdminBreakers(ctx context.Context, r *http.Request) (interface{}, error) {
+	statuses := []geckoUtils.BreakerStatus{}
+	for _, b := range geckoUtils.Breakers() {
+		statuses = append(statuses, b.Status())
+	}
+	return statuses, nil
+}
+
+// adminBreaker returns the circuit breaker named by the "name" route parameter.
+func adminBreaker(r *http.Request) (*geckoUtils.Breaker, error) {
+	b, ok := geckoUtils.LookupBreaker(routeParam(r, "name"))
+	if !ok {
+		return nil, notFound("circuit breaker", routeParam(r, "name"))
+	}
+	return b, nil
+}
+
+// handleAdminTripBreaker handles "POST /admin/breakers/{name}/trip".
+func (s *JSONAPIServer) handleAdminTripBreaker(ctx context.Context, r *http.Request) (interface{}, error) {
+	b, err := adminBreaker(r)
+	if err != nil {
+		return nil, err
+	}
+	b.Trip()
+	return b.Status(), nil
+}
+
+// handleAdminResetBreaker handles "POST /admin/breakers/{name}/reset".
+func (s *JSONAPIServer) handleAdminResetBreaker(ctx context.Context, r *http.Request) (interface{}, error) {
+	b, err := adminBreaker(r)
+	if err != nil {
+		return nil, err
+	}
+	b.Reset()
+	return b.Status(), nil
+}
+
+// logLevel is the body of the "/admin/log-level" endpoints.
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// handleAdminLogLevel handles "GET /admin/log-level".
+func (s *JSONAPIServer) handleAdminLogLevel(ctx context.Context, r *http.Request) (interface{}, error) {
+	return logLevel{Level: log.GetLevel().String()}, nil
+}
+
+// handleAdminSetLogLevel handles "PUT /admin/log-level" with a body like {"level": "debug"}.
+func (s *JSONAPIServer) handleAdminSetLogLevel(ctx context.Context, r *http.Request) (interface{}, error) {
+	var body logLevel
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<10)).Decode(&body); err != nil {
+		return nil, badRequest("invalid request body: %v", err)
+	}
+	level, err := log.ParseLevel(body.Level)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	log.SetLevel(level)
+	return logLevel{Level: level.String()}, nil
+}
+
+// handleAdminConfig handles "GET /admin/config".
+func (s *JSONAPIServer) handleAdminConfig(ctx context.Context, r *http.Request) (interface{}, error) {
+	return redactConfig(s.admin.Config), nil
+}
+
+// handleAdminAudit handles "GET /admin/audit", returning the most recent admin actions first.
+func (s *JSONAPIServer) handleAdminAudit(ctx context.Context, r *http.Request) (interface{}, error) {
+	return s.auditLog.recent(), nil
+}
+
+// redactConfig returns a copy of config with secrets replaced: the values of settings named
+// like secrets, and the passwords and query strings of URLs, which often carry tokens.
+func redactConfig(config map[string]string) map[string]string {
+	out := make(map[string]string, len(config))
+	for name, value := range config {
+		switch {
+		case value == "":
+			out[name] = value
+		case secretSetting.MatchString(name):
+			out[name] = redacted
+		default:
+			out[name] = redactURL(value)
+		}
+	}
+	return out
+}
+
+// redactURL hides the password and query of value if it is an absolute URL.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
+}
@@ -0,0 +1,127 @@
+package price_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	alertService "coinfetcher/services/alert"
+	authUtils "coinfetcher/services/auth"
+	"coinfetcher/types"
+)
+
+// maxAlertBodyBytes caps the size of alert rule request bodies.
+const maxAlertBodyBytes = 16 << 10
+
+// WithAlerts enables the "/v1/alerts" API to manage the price alert rules of engine.
+// Callers manage their own rules; admins see everyone's. It is only served with authentication.
+func WithAlerts(engine *alertService.Engine) Option {
+	return func(s *JSONAPIServer) {
+		s.alerts = engine
+	}
+}
+
+// newAlertsRouter creates the router of the "/v1/alerts" API.
+func (s *JSONAPIServer) newAlertsRouter() *router {
+	rt := s.newProblemRouter()
+	rt.handle(http.MethodGet, "/v1/alerts", s.makeHTTPHandlerFunc(s.handleListAlerts))
+	rt.handle(http.MethodPost, "/v1/alerts", s.makeHTTPHandlerFunc(s.handleCreateAlert))
+	// Registered before "/v1/alerts/{id}", which would match it too.
+	rt.handle(http.MethodGet, "/v1/alerts/dead-letters", s.makeHTTPHandlerFunc(s.handleAlertDeadLetters))
+	rt.handle(http.MethodGet, "/v1/alerts/{id}", s.makeHTTPHandlerFunc(s.handleGetAlert))
+	rt.handle(http.MethodPut, "/v1/alerts/{id}", s.makeHTTPHandlerFunc(s.handleUpdateAlert))
+	rt.handle(http.MethodDelete, "/v1/alerts/{id}", s.makeHTTPHandlerFunc(s.handleDeleteAlert))
+	return rt
+}
+
+// resourceOwner returns the subject whose alert rules and webhook endpoints the caller
+// manages, and whether the caller may manage everyone's.
+func (s *JSONAPIServer) resourceOwner(ctx context.Context) (string, bool) {
+	return authUtils.SubjectFromContext(ctx), authUtils.PrincipalFromContext(ctx).HasScope(authUtils.ScopeAdmin)
+}
+
+// alertError maps the errors of the alert engine onto the statuses they are reported with.
+func alertError(err error, id string) error {
+	switch {
+	case errors.Is(err, alertService.ErrRuleNotFound):
+		return notFound("alert rule", id)
+	case errors.Is(err, alertService.ErrInvalidRule):
+		return badRequest("%v", err)
+	}
+	return err
+}
+
+// decodeAlertRule reads the rule in the body of r.
+func decodeAlertRule(w http.ResponseWriter, r *http.Request) (types.AlertRule, error) {
+	var rule types.AlertRule
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertBodyBytes)).Decode(&rule); err != nil {
+		return rule, badRequest("invalid request body: %v", err)
+	}
+	return rule, nil
+}
+
+// handleListAlerts handles "GET /v1/alerts".
+func (s *JSONAPIServer) handleListAlerts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	owner, all := s.resourceOwner(ctx)
+	return s.render(w, r, http.StatusOK, s.alerts.Rules(owner, all))
+}
+
+// handleCreateAlert handles "POST /v1/alerts".
+func (s *JSONAPIServer) handleCreateAlert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rule, err := decodeAlertRule(w, r)
+	if err != nil {
+		return err
+	}
+	owner, _ := s.resourceOwner(ctx)
+	created, err := s.alerts.Create(owner, rule)
+	if err != nil {
+		return alertError(err, "")
+	}
+	w.Header().Set("Location", "/v1/alerts/"+created.ID)
+	return s.render(w, r, http.StatusCreated, created)
+}
+
+// handleGetAlert handles "GET /v1/alerts/{id}".
+func (s *JSONAPIServer) handleGetAlert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	owner, all := s.resourceOwner(ctx)
+	rule, err := s.alerts.Rule(id, owner, all)
+	if err != nil {
+		return alertError(err, id)
+	}
+	return s.render(w, r, http.StatusOK, rule)
+}
+
+// handleUpdateAlert handles "PUT /v1/alerts/{id}", replacing the rule.
+func (s *JSONAPIServer) handleUpdateAlert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	rule, err := decodeAlertRule(w, r)
+	if err != nil {
+		return err
+	}
+	owner, all := s.resourceOwner(ctx)
+	updated, err := s.alerts.Update(id, owner, all, rule)
+	if err != nil {
+		return alertError(err, id)
+	}
+	return s.render(w, r, http.StatusOK, updated)
+}
+
+// handleDeleteAlert handles "DELETE /v1/alerts/{id}".
+func (s *JSONAPIServer) handleDeleteAlert(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	owner, all := s.resourceOwner(ctx)
+	if err := s.alerts.Delete(id, owner, all); err != nil {
+		return alertError(err, id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleAlertDeadLetters handles "GET /v1/alerts/dead-letters", listing the alerts whose
+// webhook deliveries were given up on.
+func (s *JSONAPIServer) handleAlertDeadLetters(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	owner, all := s.resourceOwner(ctx)
+	return s.render(w, r, http.StatusOK, s.alerts.DeadLetters(owner, all))
+}
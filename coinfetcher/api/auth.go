@@ -0,0 +1,197 @@
+package price_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	authUtils "coinfetcher/services/auth"
+	"coinfetcher/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// apiKeyHeader is the header API keys are sent in.
+const apiKeyHeader = "X-API-Key"
+
+// WithAPIKeys requires an API key with the matching scope on every route except health
+// checks and documentation, and enforces the keys' quotas through quotas. With
+// WithBearerTokens, a bearer token is accepted instead of a key.
+func WithAPIKeys(keys *authUtils.KeyStore, quotas *authUtils.QuotaTracker) Option {
+	return func(s *JSONAPIServer) {
+		s.apiKeys = keys
+		s.quotas = quotas
+	}
+}
+
+// requiredScope returns the scope needed to call path, or "" for public routes.
+func requiredScope(path string) string {
+	switch {
+	case path == "/v1/health" || path == "/v2/health" || path == "/openapi.json" || strings.HasPrefix(path, "/swagger/"):
+		return ""
+	case strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/debug/"):
+		return authUtils.ScopeAdmin
+	case strings.HasSuffix(path, "/history"):
+		return authUtils.ScopeHistory
+	}
+	return authUtils.ScopePrice
+}
+
+// apiKeyFromRequest returns the API key of r. Browsers can't set headers on WebSocket and
+// EventSource connections, so the "api_key" query parameter is accepted as well.
+func apiKeyFromRequest(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(apiKeyHeader)); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// WithBearerTokens accepts JWT bearer tokens validated by verifier, alongside API keys if those
+// are enabled too. Like WithAPIKeys, it protects every route except health checks and documentation.
+func WithBearerTokens(verifier *authUtils.JWTVerifier) Option {
+	return func(s *JSONAPIServer) {
+		s.tokenVerifier = verifier
+	}
+}
+
+// bearerToken returns the bearer token of r, also accepted in the "access_token" query
+// parameter for WebSocket and EventSource connections.
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// authEnabled reports whether callers have to authenticate.
+func (s *JSONAPIServer) authEnabled() bool {
+	return s.apiKeys != nil || s.tokenVerifier != nil
+}
+
+// authenticate checks the credentials and scope of every request to a non-public route and
+// stores the caller's principal, and the API key it used, in the request context.
+func (s *JSONAPIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r.URL.Path)
+		if scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, key, message := s.credentials(r)
+		if principal == nil {
+			// Failed attempts count against the rate limits of anonymous callers, so floods of
+			// bad credentials are throttled even on routes limited per API key.
+			if s.rateLimiter != nil && s.rateLimited(w, r, s.rateLimiter.AllowCaller) {
+				return
+			}
+			s.writeAuthError(w, r, http.StatusUnauthorized, "unauthorized", message)
+			return
+		}
+		if !principal.HasScope(scope) {
+			s.writeAuthError(w, r, http.StatusForbidden, "forbidden", fmt.Sprintf("credentials lack the %q scope", scope))
+			return
+		}
+
+		ctx := authUtils.WithPrincipal(r.Context(), principal)
+		if key != nil {
+			ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiKeyContextKey is the context key of the API key a request was authenticated with.
+type apiKeyContextKey struct{}
+
+// credentials authenticates the caller of r by bearer token or API key. The key is nil for
+// token holders. If neither is valid, the principal is nil and the message says why.
+func (s *JSONAPIServer) credentials(r *http.Request) (*authUtils.Principal, *authUtils.Key, string) {
+	if token := bearerToken(r); token != "" && s.tokenVerifier != nil {
+		principal, err := s.tokenVerifier.Verify(r.Context(), token)
+		if errors.Is(err, authUtils.ErrInvalidToken) {
+			return nil, nil, err.Error()
+		}
+		if err != nil {
+			// The key set couldn't be loaded; that's our problem, not the caller's.
+			log.WithFields(log.Fields{"err": err}).Error("Error verifying bearer token")
+			return nil, nil, "token could not be verified, try again later"
+		}
+		return principal, nil, ""
+	}
+
+	if raw := apiKeyFromRequest(r); raw != "" && s.apiKeys != nil {
+		key, ok := s.apiKeys.Lookup(raw)
+		if !ok {
+			return nil, nil, "invalid API key"
+		}
+		return authUtils.NewPrincipal(key.ID, key.Scopes), key, ""
+	}
+
+	var accepted []string
+	if s.tokenVerifier != nil {
+		accepted = append(accepted, "a bearer token in the Authorization header")
+	}
+	if s.apiKeys != nil {
+		accepted = append(accepted, "an API key in the "+apiKeyHeader+" header")
+	}
+	return nil, nil, strings.Join(accepted, " or ") + " is required"
+}
+
+// chargeQuota counts requests made with an API key against its quota. It runs right before
+// the handlers, so requests rejected by rate limits or validation aren't charged.
+func (s *JSONAPIServer) chargeQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Quotas are attached to API keys; token holders are only subject to rate limits.
+		if key, ok := r.Context().Value(apiKeyContextKey{}).(*authUtils.Key); ok && !s.checkQuota(w, r, key) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkQuota counts a request against the quota of key and sets the X-RateLimit headers.
+// It writes a 429 response and returns false once the quota is exhausted.
+func (s *JSONAPIServer) checkQuota(w http.ResponseWriter, r *http.Request, key *authUtils.Key) bool {
+	now := time.Now()
+	quota, ok := s.quotas.Allow(key, now)
+	if quota.Limit > 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(quota.Limit, 10))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(quota.Remaining, 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(quota.Reset.Unix(), 10))
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(quota.Reset.Sub(now).Seconds())+1))
+		s.writeAuthError(w, r, http.StatusTooManyRequests, "quota_exceeded",
+			fmt.Sprintf("%s quota of %d requests exhausted", key.Quota.Period, key.Quota.Limit))
+	}
+	return ok
+}
+
+// writeAuthError writes an authentication or quota error in the error format of the API.
+func (s *JSONAPIServer) writeAuthError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if status == http.StatusUnauthorized {
+		// One challenge per accepted scheme.
+		if s.tokenVerifier != nil {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="coinfetcher"`)
+		}
+		if s.apiKeys != nil {
+			w.Header().Add("WWW-Authenticate", `APIKey realm="coinfetcher", header="`+apiKeyHeader+`"`)
+		}
+	}
+	s.writeError(w, r, &types.APIError{Status: status, Code: code, Message: message})
+}
+
+// authorize returns an error unless the caller was granted scope. It always succeeds
+// when authentication is disabled. Endpoints serving several scopes, like "/graphql",
+// use it to check the parts that need more than the route's scope.
+func (s *JSONAPIServer) authorize(ctx context.Context, scope string) error {
+	if !s.authEnabled() || authUtils.PrincipalFromContext(ctx).HasScope(scope) {
+		return nil
+	}
+	return fmt.Errorf("the %q scope is required", scope)
+}
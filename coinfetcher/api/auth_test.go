@@ -0,0 +1,109 @@
+package price_api
+
+import (
+	"net/http"
+	"testing"
+
+	authUtils "coinfetcher/services/auth"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+)
+
+// newKeyedServer creates a test server accepting the API key "test-key", which has the
+// scopes and quota of key, and rate limited by rule. opts configure the rest of the server.
+func newKeyedServer(t *testing.T, key authUtils.Key, rule rateLimitUtils.Rule, opts ...Option) *JSONAPIServer {
+	t.Helper()
+	key.ID, key.Hash = "test", authUtils.HashKey("test-key")
+	keys, err := authUtils.NewKeyStore([]authUtils.Key{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, err := authUtils.NewQuotaTracker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter, err := rateLimitUtils.NewLimiter(rateLimitUtils.Config{Rules: []rateLimitUtils.Rule{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(nil, append([]Option{WithAPIKeys(keys, quotas), WithRateLimiter(limiter)}, opts...)...)
+	return s
+}
+
+// newQuotaServer creates a validating test server whose API key "test-key" may make quota
+// requests a day, rate limited by rule.
+func newQuotaServer(t *testing.T, quota int64, rule rateLimitUtils.Rule) *JSONAPIServer {
+	t.Helper()
+	validator, err := NewRequestValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := authUtils.Key{Scopes: []string{authUtils.ScopePrice}, Quota: authUtils.Quota{Limit: quota, Period: authUtils.PeriodDaily}}
+	return newKeyedServer(t, key, rule, WithRequestValidation(validator))
+}
+
+func TestRejectedRequestsAreNotChargedToTheQuota(t *testing.T) {
+	s := newQuotaServer(t, 2, rateLimitUtils.Rule{Name: "default", Key: rateLimitUtils.KeyAPIKey, Rate: 0.001, Burst: 3})
+	key := http.Header{"X-Api-Key": {"test-key"}}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(s, http.MethodGet, "/v1/price", key); rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("invalid request: status = %d, want 422", rec.Code)
+		}
+	}
+	rec := serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", key)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != "1" {
+		t.Fatalf("valid request: status = %d, remaining = %q, want 200 with 1 left", rec.Code, rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	// The rate limit's three tokens are used up by now.
+	if rec := serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", key); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("rate limited request: status = %d, want 429", rec.Code)
+	}
+
+	// Setting the rules again resets the buckets, but not the quota.
+	if err := s.rateLimiter.SetConfig(rateLimitUtils.Config{Rules: []rateLimitUtils.Rule{{Name: "default", Key: rateLimitUtils.KeyAPIKey, Rate: 0.001, Burst: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", key)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("request after the rate limit: status = %d, remaining = %q, want 200 with 0 left", rec.Code, rec.Header().Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestBadCredentialsAreRateLimited(t *testing.T) {
+	for _, key := range []string{rateLimitUtils.KeyIP, rateLimitUtils.KeyAPIKey} {
+		s := newQuotaServer(t, 0, rateLimitUtils.Rule{Name: "default", Key: key, Rate: 0.001, Burst: 2})
+		bad := http.Header{"X-Api-Key": {"guessed-key"}}
+
+		var statuses []int
+		for i := 0; i < 3; i++ {
+			statuses = append(statuses, serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", bad).Code)
+		}
+		if statuses[0] != http.StatusUnauthorized || statuses[1] != http.StatusUnauthorized || statuses[2] != http.StatusTooManyRequests {
+			t.Errorf("%s rule: statuses = %v, want two 401s and a 429", key, statuses)
+		}
+	}
+}
+
+func TestMetricsNeedAdminCredentials(t *testing.T) {
+	limiter, err := rateLimitUtils.NewLimiter(rateLimitUtils.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, _ := newTestServer(nil, WithRateLimiter(limiter))
+	if rec := serve(open, http.MethodGet, "/debug/vars", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("without authentication: status = %d, want 404", rec.Code)
+	}
+
+	s := newAuthServer(t)
+	for _, tc := range []struct {
+		header http.Header
+		status int
+	}{
+		{nil, http.StatusUnauthorized},
+		{http.Header{"X-Api-Key": {"test-key"}}, http.StatusForbidden},
+	} {
+		if rec := serve(s, http.MethodGet, "/debug/vars", tc.header); rec.Code != tc.status {
+			t.Errorf("with authentication: status = %d, want %d", rec.Code, tc.status)
+		}
+	}
+}
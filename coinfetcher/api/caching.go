@@ -0,0 +1,123 @@
+package price_api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cacheUtils "coinfetcher/services/cache"
+	"coinfetcher/types"
+)
+
+// WithPriceCaching sets how long price responses may be cached by clients, and by CDNs
+// unless authentication is enabled. It should match the TTL of the price cache behind the server's PriceFetcher.
+func WithPriceCaching(maxAge time.Duration) Option {
+	return func(s *JSONAPIServer) {
+		s.priceMaxAge = maxAge
+	}
+}
+
+// cachePolicy holds the validators and freshness lifetime of a cacheable response.
+type cachePolicy struct {
+	etag         string        // Opaque tag of the represented value, without quotes.
+	weak         bool          // Set when equal tags may come with bodies that differ in details, like v2's meta block.
+	lastModified time.Time     // When the value last changed upstream; zero if unknown.
+	maxAge       time.Duration // How long the response may be served without revalidation.
+	private      bool          // Set when the response needed credentials, so shared caches must not keep it.
+}
+
+// cacheable is returned by v2 handlers whose data can be cached under policy.
+type cacheable struct {
+	data   interface{}
+	policy cachePolicy
+}
+
+// priceCachePolicy returns the cache policy of a quote. Its ETag is derived from the quote
+// itself and Last-Modified is the upstream update time. Clients may keep the quote for as long
+// as the server's price cache serves it, so max-age is what remains of the cache entry's TTL.
+// Quotes the cache doesn't hold were just fetched and get the full lifetime.
+func (s *JSONAPIServer) priceCachePolicy(price types.PriceResponse) cachePolicy {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%v|%v|%d", price.Ticker, price.Price, price.Vol24Hr, price.Timestamp.UnixNano())))
+
+	maxAge := s.priceMaxAge
+	if expiresAt, ok := cachedUntil(price); ok && time.Until(expiresAt) < maxAge {
+		maxAge = time.Until(expiresAt)
+		if maxAge < 0 {
+			maxAge = 0
+		}
+	}
+
+	// With authentication, a CDN must not serve a quote fetched with credentials to callers without them.
+	return cachePolicy{
+		etag:         hex.EncodeToString(sum[:8]),
+		lastModified: price.Timestamp,
+		maxAge:       maxAge,
+		private:      s.authEnabled(),
+	}
+}
+
+// cachedUntil returns when the server's price cache stops serving price, if it holds it.
+func cachedUntil(price types.PriceResponse) (time.Time, bool) {
+	c, ok := cacheUtils.LookupCache(cacheUtils.PriceCacheName)
+	if !ok {
+		return time.Time{}, false
+	}
+	value, info, ok := c.Entry(price.Ticker)
+	if cached, isPrice := value.(types.PriceResponse); !ok || !isPrice || !cached.Timestamp.Equal(price.Timestamp) {
+		return time.Time{}, false // The entry has been replaced since.
+	}
+	return info.ExpiresAt, true
+}
+
+// setCacheHeaders sets the validators and Cache-Control of a response rendered in format and returns its ETag.
+// Each representation gets its own ETag, as a CSV and a JSON rendering of a quote are different bodies.
+func setCacheHeaders(h http.Header, policy *cachePolicy, format *responseFormat) string {
+	etag := `"` + policy.etag + "-" + format.name + `"`
+	if policy.weak {
+		etag = "W/" + etag
+	}
+
+	h.Set("ETag", etag)
+	if !policy.lastModified.IsZero() {
+		h.Set("Last-Modified", policy.lastModified.UTC().Format(http.TimeFormat))
+	}
+	visibility := "public"
+	if policy.private {
+		visibility = "private"
+	}
+	h.Set("Cache-Control", visibility+", max-age="+strconv.Itoa(int(policy.maxAge/time.Second)))
+	return etag
+}
+
+// notModified evaluates the conditional headers of a GET or HEAD request against the response's validators.
+// If-None-Match takes precedence over If-Modified-Since, as RFC 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison, so W/ prefixes are ignored.
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have second precision.
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package price_api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cacheUtils "coinfetcher/services/cache"
+)
+
+func TestPriceMaxAgeFollowsTheServerCache(t *testing.T) {
+	// CoinGecko may not have updated the quote for a while; that doesn't make it stale for us.
+	pricing := &stubPricing{price: 64000, timestamp: time.Now().Add(-time.Hour).UTC()}
+	cached := cacheUtils.NewPriceCacheService(pricing, 15*time.Second)
+	s := NewJSONAPIServer(":0", cached, stubHealth{}, WithPriceCaching(15*time.Second))
+
+	for _, target := range []string{"/v1/price?ticker=bitcoin", "/v2/coins/bitcoin/price"} {
+		rec := serve(s, http.MethodGet, target, nil)
+		maxAge, err := strconv.Atoi(strings.TrimPrefix(rec.Header().Get("Cache-Control"), "public, max-age="))
+		if err != nil || maxAge < 13 || maxAge > 15 {
+			t.Errorf("GET %s: Cache-Control = %q, want the rest of the 15s the server caches the quote", target, rec.Header().Get("Cache-Control"))
+		}
+	}
+	if pricing.calls != 1 {
+		t.Errorf("pricing service called %d times, want 1", pricing.calls)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s, _ := newTestServer(nil, WithPriceCaching(15*time.Second))
+
+	for _, target := range []string{"/v1/price?ticker=bitcoin", "/v2/coins/bitcoin/price"} {
+		first := serve(s, http.MethodGet, target, nil)
+		etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+		if first.Code != http.StatusOK || etag == "" || lastModified == "" {
+			t.Fatalf("GET %s: status = %d, ETag = %q, Last-Modified = %q", target, first.Code, etag, lastModified)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			header http.Header
+			status int
+		}{
+			{"matching ETag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+			{"one of several ETags", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified},
+			{"weak ETag", http.Header{"If-None-Match": {"W/" + strings.TrimPrefix(etag, "W/")}}, http.StatusNotModified},
+			{"other ETag", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+			{"Last-Modified", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+			{"earlier date", http.Header{"If-Modified-Since": {time.Now().Add(-2 * time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusOK},
+			// If-None-Match takes precedence.
+			{"other ETag and Last-Modified", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {lastModified}}, http.StatusOK},
+		} {
+			rec := serve(s, http.MethodGet, target, tc.header)
+			if rec.Code != tc.status {
+				t.Errorf("GET %s with %s: status = %d, want %d", target, tc.name, rec.Code, tc.status)
+				continue
+			}
+			if tc.status == http.StatusNotModified {
+				if rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+					t.Errorf("GET %s with %s: want an empty 304 with the ETag, got %q and %q", target, tc.name, rec.Body, rec.Header().Get("ETag"))
+				}
+			}
+		}
+	}
+
+	// Each representation has its own ETag.
+	csv := serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", http.Header{"Accept": {"text/csv"}})
+	if json := serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", nil); csv.Header().Get("ETag") == json.Header().Get("ETag") {
+		t.Errorf("CSV and JSON share the ETag %q", csv.Header().Get("ETag"))
+	}
+}
+
+func TestAuthenticatedPricesAreNotCachedByCDNs(t *testing.T) {
+	open, _ := newTestServer(nil, WithPriceCaching(15*time.Second))
+	if cc := serve(open, http.MethodGet, "/v1/price?ticker=bitcoin", nil).Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public,") {
+		t.Errorf("without authentication: Cache-Control = %q, want public", cc)
+	}
+
+	s := newAuthServer(t)
+	for _, target := range []string{"/v1/price?ticker=bitcoin", "/v2/coins/bitcoin/price"} {
+		rec := serve(s, http.MethodGet, target, http.Header{"X-Api-Key": {"test-key"}})
+		if cc := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || !strings.HasPrefix(cc, "private,") {
+			t.Errorf("GET %s with an API key: status = %d, Cache-Control = %q, want a private 200", target, rec.Code, cc)
+		}
+	}
+}
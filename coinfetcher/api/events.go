@@ -0,0 +1,232 @@
+package price_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pollerService "coinfetcher/services/poller"
+	"coinfetcher/types"
+)
+
+// Server-Sent Events settings for "/v1/price/events".
+const (
+	eventsWriteWait  = 10 * time.Second // A client that can't take an event within this time is dropped.
+	eventsRetryDelay = 3 * time.Second  // Reconnection delay suggested to EventSource clients.
+)
+
+// WithPriceEvents enables the "/v1/price/events" Server-Sent Events endpoint fed by the given broker.
+// A keep-alive comment is sent whenever the stream was quiet for keepAlive, or never if it isn't positive.
+func WithPriceEvents(broker *pollerService.EventBroker, keepAlive time.Duration) Option {
+	return func(s *JSONAPIServer) {
+		s.eventBroker = broker
+		s.eventsKeepAlive = keepAlive
+	}
+}
+
+// handlePriceEvents handles the "Server-Sent Events price stream" endpoint.
+// It streams a "price" event whenever a watched ticker moved beyond the broker's threshold.
+// Clients resuming with Last-Event-ID first receive the events they missed from the
+// replay buffer; when those are no longer available they get a fresh snapshot instead.
+// Clients preferring NDJSON (via Accept or "format=ndjson") get one JSON price per line instead.
+func (s *JSONAPIServer) handlePriceEvents(w http.ResponseWriter, r *http.Request) {
+	tickers := normalizeTickers(strings.Split(r.URL.Query().Get("tickers"), ","))
+	if len(tickers) == 0 {
+		s.writeProblem(w, r, badRequest("at least one ticker is required"))
+		return
+	}
+	if s.maxStreamSubscriptions > 0 && len(tickers) > s.maxStreamSubscriptions {
+		s.writeProblem(w, r, badRequest("at most %d tickers can be watched per stream", s.maxStreamSubscriptions))
+		return
+	}
+
+	// The stream outlives the server's write timeout, so deadlines are managed per write below.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.writeProblem(w, r, &statusError{status: http.StatusInternalServerError, code: "internal_error", message: "streaming is not supported"})
+		return
+	}
+
+	watched := make(map[string]bool, len(tickers))
+	for _, ticker := range tickers {
+		watched[ticker] = true
+	}
+	release := s.eventBroker.Watch(tickers)
+	defer release()
+	notify, stopListening := s.eventBroker.Listen()
+	defer stopListening()
+
+	ndjson := prefersNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop reverse proxies from buffering the stream.
+	w.WriteHeader(http.StatusOK)
+
+	send := func(write func() error) bool {
+		rc.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+		if err := write(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	// Replay what the client missed, or start it off with a snapshot.
+	// NDJSON carries no event IDs, so those clients always start from a snapshot.
+	lastID, resuming := parseLastEventID(r)
+	resuming = resuming && !ndjson
+	var backlog []pollerService.PriceEvent
+	complete := false
+	if resuming {
+		backlog, complete = s.eventBroker.Since(lastID, watched)
+	}
+	if !complete {
+		lastID = s.eventBroker.LastID()
+		backlog = nil
+	}
+
+	ok := send(func() error {
+		if ndjson {
+			return s.writeSnapshotLines(w, tickers)
+		}
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventsRetryDelay.Milliseconds()); err != nil {
+			return err
+		}
+		if !complete {
+			return s.writeSnapshotEvents(w, lastID, tickers)
+		}
+		return writePriceEvents(w, backlog)
+	})
+	if !ok {
+		return
+	}
+	if len(backlog) > 0 {
+		lastID = backlog[len(backlog)-1].ID
+	}
+
+	// Without keep-alives the channel stays nil and never fires.
+	var keepAlive <-chan time.Time
+	resetKeepAlive := func() {}
+	if s.eventsKeepAlive > 0 {
+		ticker := time.NewTicker(s.eventsKeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+		resetKeepAlive = func() { ticker.Reset(s.eventsKeepAlive) }
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streams.Done():
+			return // Shutdown has started and would otherwise wait for the client to leave.
+		case <-s.eventBroker.Done():
+			return // The server is shutting down; EventSource clients reconnect on their own.
+		case <-keepAlive:
+			if ndjson {
+				continue // NDJSON has no comment lines to keep the connection busy with.
+			}
+			if !send(func() error { _, err := io.WriteString(w, ": keep-alive\n\n"); return err }) {
+				return
+			}
+		case <-notify:
+			events, _ := s.eventBroker.Since(lastID, watched)
+			if len(events) == 0 {
+				continue
+			}
+			write := func() error { return writePriceEvents(w, events) }
+			if ndjson {
+				write = func() error { return writePriceLines(w, events) }
+			}
+			if !send(write) {
+				return
+			}
+			lastID = events[len(events)-1].ID
+			resetKeepAlive()
+		}
+	}
+}
+
+// prefersNDJSON reports whether the client asked for NDJSON rather than Server-Sent Events.
+func prefersNDJSON(r *http.Request) bool {
+	formats, err := acceptedFormats(r)
+	return err == nil && formats[0].name == formatNDJSON
+}
+
+// parseLastEventID reads the Last-Event-ID header, or the "lastEventId" query
+// parameter for clients that can't set headers.
+func parseLastEventID(r *http.Request) (uint64, bool) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+	return id, err == nil
+}
+
+// writeSnapshotEvents writes the latest known price of every ticker as "snapshot" events.
+// They carry the broker's current event ID so a reconnecting client resumes from here.
+func (s *JSONAPIServer) writeSnapshotEvents(w io.Writer, lastID uint64, tickers []string) error {
+	for _, ticker := range tickers {
+		price, ok := s.poller.Latest(ticker)
+		if !ok {
+			continue // Its first event follows as soon as the poller fetched it.
+		}
+		if err := writeEvent(w, lastID, "snapshot", price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePriceEvents writes events as "price" events.
+func writePriceEvents(w io.Writer, events []pollerService.PriceEvent) error {
+	for _, e := range events {
+		if err := writeEvent(w, e.ID, "price", e.Price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSnapshotLines writes the latest known price of every ticker as NDJSON lines.
+func (s *JSONAPIServer) writeSnapshotLines(w io.Writer, tickers []string) error {
+	enc := json.NewEncoder(w)
+	for _, ticker := range tickers {
+		if price, ok := s.poller.Latest(ticker); ok {
+			if err := enc.Encode(price); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePriceLines writes the prices of events as NDJSON lines.
+func writePriceLines(w io.Writer, events []pollerService.PriceEvent) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e.Price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON encoded price as its data.
+func writeEvent(w io.Writer, id uint64, event string, price types.PriceResponse) error {
+	data, err := json.Marshal(price)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
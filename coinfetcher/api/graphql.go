@@ -0,0 +1,233 @@
+package price_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	priceService "coinfetcher/services/price"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// maxGraphQLBodyBytes caps the size of a "/graphql" request body.
+const maxGraphQLBodyBytes = 1 << 20
+
+// GraphQLLimits bounds the cost of a single GraphQL query.
+type GraphQLLimits struct {
+	MaxDepth      int // Deepest allowed nesting of selections.
+	MaxComplexity int // Highest allowed complexity score, see queryComplexity.
+}
+
+// DefaultGraphQLLimits returns the limits used when none are given.
+func DefaultGraphQLLimits() GraphQLLimits {
+	return GraphQLLimits{
+		MaxDepth:      8,
+		MaxComplexity: 500,
+	}
+}
+
+// WithGraphQL enables the "/graphql" endpoint. Coin quotes are fetched through quotes;
+// coin metadata and history are exposed when their services are configured too.
+func WithGraphQL(quotes priceService.QuoteFetcher, limits GraphQLLimits) Option {
+	return func(s *JSONAPIServer) {
+		s.quoteService = quotes
+		s.graphQLLimits = limits
+	}
+}
+
+// graphQLRequest is a GraphQL query sent as JSON body or as URL parameters.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handleGraphQL handles the "GraphQL" endpoint.
+// Queries are accepted as GET parameters or as a JSON POST body. Queries that fail to
+// parse or validate, or exceed the depth or complexity limits, are answered with 400.
+func (s *JSONAPIServer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if raw := query.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				s.writeGraphQLErrors(w, http.StatusBadRequest, fmt.Errorf("invalid variables: %v", err))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes)).Decode(&req); err != nil {
+			s.writeGraphQLErrors(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		s.writeGraphQLErrors(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		s.writeGraphQLErrors(w, http.StatusBadRequest, fmt.Errorf("query is required"))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		s.writeGraphQLErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	if result := graphql.ValidateDocument(&s.graphQLSchema, doc, nil); !result.IsValid {
+		s.writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: result.Errors})
+		return
+	}
+	if err := s.checkGraphQLLimits(doc, req.OperationName, req.Variables); err != nil {
+		s.writeGraphQLErrors(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Every query gets its own loaders, so lookups are only batched and de-duplicated within it.
+	ctx := context.WithValue(r.Context(), graphQLLoadersKey{}, s.newGraphQLLoaders(r.Context()))
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.graphQLSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// writeGraphQLErrors replies with a GraphQL response carrying only err.
+func (s *JSONAPIServer) writeGraphQLErrors(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+}
+
+// checkGraphQLLimits rejects the selected operation if it is nested too deeply or too expensive.
+func (s *JSONAPIServer) checkGraphQLLimits(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operations = append(operations, def)
+			}
+		}
+	}
+
+	// Execution reports a missing or ambiguous operation, so only the matching ones are checked here.
+	for _, op := range operations {
+		cost := queryCost{fragments: fragments, variables: variables}
+		complexity, depth := cost.selectionSet(op.SelectionSet, 1)
+		if depth > s.graphQLLimits.MaxDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, s.graphQLLimits.MaxDepth)
+		}
+		if complexity > s.graphQLLimits.MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, s.graphQLLimits.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+// graphQLFieldCosts weighs fields that cost an upstream request of their own; all other fields cost 1.
+var graphQLFieldCosts = map[string]int{
+	"info":    5,
+	"history": 10,
+}
+
+// graphQLListArguments names the argument whose length multiplies the cost of a list field's selections.
+var graphQLListArguments = map[string]string{
+	"coins":  "ids",
+	"quotes": "currencies",
+}
+
+// queryCost computes the complexity and depth of a query.
+// The complexity of a field is its own cost plus that of its selections, multiplied by the
+// number of items requested for list fields. Introspection fields are free, so tools can
+// always load the schema.
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// selectionSet returns the complexity of set and the deepest level reached, set being at level depth.
+func (c queryCost) selectionSet(set *ast.SelectionSet, depth int) (complexity, maxDepth int) {
+	if set == nil {
+		return 0, depth - 1
+	}
+
+	maxDepth = depth
+	for _, selection := range set.Selections {
+		var cost, reached int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost, reached = c.field(selection, depth)
+		case *ast.InlineFragment:
+			cost, reached = c.selectionSet(selection.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if fragment, ok := c.fragments[selection.Name.Value]; ok {
+				cost, reached = c.selectionSet(fragment.SelectionSet, depth)
+			}
+		}
+		complexity += cost
+		if reached > maxDepth {
+			maxDepth = reached
+		}
+	}
+	return complexity, maxDepth
+}
+
+// field returns the complexity of a single field at level depth and the deepest level below it.
+func (c queryCost) field(field *ast.Field, depth int) (complexity, maxDepth int) {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") {
+		return 0, 0
+	}
+
+	cost, ok := graphQLFieldCosts[name]
+	if !ok {
+		cost = 1
+	}
+
+	children, maxDepth := c.selectionSet(field.SelectionSet, depth+1)
+	if argument, ok := graphQLListArguments[name]; ok {
+		children *= c.listLength(field, argument)
+	}
+	return cost + children, maxDepth
+}
+
+// listLength returns the number of items passed in the named list argument of field, at least 1.
+func (c queryCost) listLength(field *ast.Field, argument string) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != argument {
+			continue
+		}
+		n := 1
+		switch value := arg.Value.(type) {
+		case *ast.ListValue:
+			n = len(value.Values)
+		case *ast.Variable:
+			if list, ok := c.variables[value.Name.Value].([]interface{}); ok {
+				n = len(list)
+			}
+		}
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+	return 1
+}
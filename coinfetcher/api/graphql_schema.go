@@ -0,0 +1,423 @@
+package price_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	authUtils "coinfetcher/services/auth"
+	historyService "coinfetcher/services/history"
+	"coinfetcher/types"
+
+	"github.com/graphql-go/graphql"
+)
+
+// graphQLLoadersKey is the context key the loaders of a GraphQL query are stored under.
+type graphQLLoadersKey struct{}
+
+// graphQLLoaders batch the upstream lookups made while resolving one GraphQL query.
+type graphQLLoaders struct {
+	quotes  *batchLoader[quoteKey, types.Quote]
+	info    *batchLoader[string, types.CoinInfo]
+	history *batchLoader[historyKey, types.HistoryResponse]
+}
+
+// quoteKey identifies the quote of a coin in a currency.
+type quoteKey struct {
+	id       string
+	currency string
+}
+
+// historyKey identifies the history of a coin over a number of days.
+type historyKey struct {
+	id   string
+	days int
+}
+
+// coinSource is the value behind a GraphQL Coin; its fields are loaded lazily.
+type coinSource struct {
+	id string
+}
+
+// newGraphQLLoaders creates the loaders for one query. Quotes of every coin and currency
+// requested at the same level of a query are fetched with a single upstream request;
+// metadata and history, which CoinGecko only serves per coin, are fetched concurrently.
+func (s *JSONAPIServer) newGraphQLLoaders(ctx context.Context) *graphQLLoaders {
+	loaders := &graphQLLoaders{
+		quotes: newBatchLoader(ctx, func(ctx context.Context, keys []quoteKey) map[quoteKey]loaded[types.Quote] {
+			ids, currencies := splitQuoteKeys(keys)
+			quotes, err := s.quoteService.FetchQuotes(ctx, ids, currencies)
+
+			results := make(map[quoteKey]loaded[types.Quote], len(keys))
+			if err != nil {
+				for _, key := range keys {
+					results[key] = loaded[types.Quote]{err: err}
+				}
+				return results
+			}
+			for _, quote := range quotes {
+				results[quoteKey{id: quote.Ticker, currency: quote.Currency}] = loaded[types.Quote]{value: quote}
+			}
+			return results
+		}),
+	}
+
+	if s.coinService != nil {
+		loaders.info = newBatchLoader(ctx, concurrentLoad(func(ctx context.Context, id string) (types.CoinInfo, error) {
+			return s.coinService.FetchCoinInfo(ctx, id)
+		}))
+	}
+	if s.historyService != nil {
+		loaders.history = newBatchLoader(ctx, concurrentLoad(func(ctx context.Context, key historyKey) (types.HistoryResponse, error) {
+			return s.historyService.FetchHistory(ctx, key.id, key.days)
+		}))
+	}
+	return loaders
+}
+
+// splitQuoteKeys returns the sorted distinct coin ids and currencies of keys.
+func splitQuoteKeys(keys []quoteKey) (ids, currencies []string) {
+	seenIDs := make(map[string]bool)
+	seenCurrencies := make(map[string]bool)
+	for _, key := range keys {
+		if !seenIDs[key.id] {
+			seenIDs[key.id] = true
+			ids = append(ids, key.id)
+		}
+		if !seenCurrencies[key.currency] {
+			seenCurrencies[key.currency] = true
+			currencies = append(currencies, key.currency)
+		}
+	}
+	sort.Strings(ids)
+	sort.Strings(currencies)
+	return ids, currencies
+}
+
+// loadersFromContext returns the loaders of the query being resolved.
+func loadersFromContext(ctx context.Context) *graphQLLoaders {
+	loaders, _ := ctx.Value(graphQLLoadersKey{}).(*graphQLLoaders)
+	return loaders
+}
+
+// loaded is the outcome of loading a single key.
+type loaded[V any] struct {
+	value V
+	err   error
+}
+
+// batchLoader collects the keys requested while one level of a GraphQL query is resolved,
+// and loads all of them with one call to fetch as soon as the first value is needed.
+// Resolvers return thunks, which the executor only calls after resolving the whole level.
+// Keys are loaded at most once per loader; keys missing from fetch's result resolve to null.
+type batchLoader[K comparable, V any] struct {
+	ctx   context.Context
+	fetch func(context.Context, []K) map[K]loaded[V]
+
+	mu      sync.Mutex
+	pending *loaderBatch[K, V]       // Batch still collecting keys.
+	batches map[K]*loaderBatch[K, V] // Batch each key was, or will be, loaded in.
+}
+
+// loaderBatch is a set of keys loaded together.
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	once    sync.Once
+	results map[K]loaded[V]
+}
+
+// newBatchLoader creates a loader whose fetches are bound to ctx.
+func newBatchLoader[K comparable, V any](ctx context.Context, fetch func(context.Context, []K) map[K]loaded[V]) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		ctx:     ctx,
+		fetch:   fetch,
+		batches: make(map[K]*loaderBatch[K, V]),
+	}
+}
+
+// load queues key and returns a thunk resolving to its value, or nil if it wasn't found.
+func (l *batchLoader[K, V]) load(key K) func() (interface{}, error) {
+	l.mu.Lock()
+	batch, ok := l.batches[key]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &loaderBatch[K, V]{}
+		}
+		batch = l.pending
+		batch.keys = append(batch.keys, key)
+		l.batches[key] = batch
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		if l.pending == batch {
+			l.pending = nil // Keys requested from now on go into a new batch.
+		}
+		l.mu.Unlock()
+
+		batch.once.Do(func() {
+			batch.results = l.fetch(l.ctx, batch.keys)
+		})
+
+		result, ok := batch.results[key]
+		if !ok {
+			return nil, nil
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		return result.value, nil
+	}
+}
+
+// concurrentLoad turns a single-key fetch into a batch fetch that loads every key concurrently.
+func concurrentLoad[K comparable, V any](fetch func(context.Context, K) (V, error)) func(context.Context, []K) map[K]loaded[V] {
+	return func(ctx context.Context, keys []K) map[K]loaded[V] {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		results := make(map[K]loaded[V], len(keys))
+
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key K) {
+				defer wg.Done()
+				value, err := fetch(ctx, key)
+
+				mu.Lock()
+				results[key] = loaded[V]{value: value, err: err}
+				mu.Unlock()
+			}(key)
+		}
+		wg.Wait()
+		return results
+	}
+}
+
+// newGraphQLSchema builds the GraphQL schema over the server's services.
+// Coin metadata and history are only part of the schema when their services are configured.
+func (s *JSONAPIServer) newGraphQLSchema() (graphql.Schema, error) {
+	quoteType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Quote",
+		Description: "Price of a coin in one currency.",
+		Fields: graphql.Fields{
+			"currency":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"price":      &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"marketCap":  &graphql.Field{Type: graphql.Float},
+			"vol24Hr":    &graphql.Field{Type: graphql.Float},
+			"change24Hr": &graphql.Field{Type: graphql.Float, Description: "Price change over the last 24 hours, in percent."},
+			"timestamp":  &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	coinFields := graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(coinSource).id, nil
+			},
+		},
+		"price": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Price in USD, or null if the coin is unknown.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				thunk := loadersFromContext(p.Context).quotes.load(quoteKey{id: p.Source.(coinSource).id, currency: "usd"})
+				return func() (interface{}, error) {
+					quote, err := thunk()
+					if quote == nil || err != nil {
+						return nil, err
+					}
+					return quote.(types.Quote).Price, nil
+				}, nil
+			},
+		},
+		"quote": &graphql.Field{
+			Type: quoteType,
+			Args: graphql.FieldConfigArgument{
+				"currency": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "usd"},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				currency := strings.ToLower(strings.TrimSpace(p.Args["currency"].(string)))
+				if currency == "" {
+					return nil, errors.New("currency must not be empty")
+				}
+				return loadersFromContext(p.Context).quotes.load(quoteKey{id: p.Source.(coinSource).id, currency: currency}), nil
+			},
+		},
+		"quotes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(quoteType))),
+			Description: "Quotes in each of the given currencies; currencies without a quote are left out.",
+			Args: graphql.FieldConfigArgument{
+				"currencies": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				loaders := loadersFromContext(p.Context)
+				id := p.Source.(coinSource).id
+
+				var thunks []func() (interface{}, error)
+				for _, currency := range normalizeTickers(stringArgs(p.Args["currencies"])) {
+					thunks = append(thunks, loaders.quotes.load(quoteKey{id: id, currency: currency}))
+				}
+				return func() (interface{}, error) {
+					quotes := make([]interface{}, 0, len(thunks))
+					for _, thunk := range thunks {
+						quote, err := thunk()
+						if err != nil {
+							return nil, err
+						}
+						if quote != nil {
+							quotes = append(quotes, quote)
+						}
+					}
+					return quotes, nil
+				}, nil
+			},
+		},
+	}
+
+	if s.coinService != nil {
+		imageType := graphql.NewObject(graphql.ObjectConfig{
+			Name: "CoinImage",
+			Fields: graphql.Fields{
+				"thumb": &graphql.Field{Type: graphql.String},
+				"small": &graphql.Field{Type: graphql.String},
+				"large": &graphql.Field{Type: graphql.String},
+			},
+		})
+		infoType := graphql.NewObject(graphql.ObjectConfig{
+			Name:        "CoinInfo",
+			Description: "Metadata of a coin.",
+			Fields: graphql.Fields{
+				"symbol":      &graphql.Field{Type: graphql.String},
+				"name":        &graphql.Field{Type: graphql.String},
+				"description": &graphql.Field{Type: graphql.String},
+				"image":       &graphql.Field{Type: imageType},
+				"homepage":    &graphql.Field{Type: graphql.NewList(graphql.String)},
+				"categories":  &graphql.Field{Type: graphql.NewList(graphql.String)},
+				"genesisDate": &graphql.Field{Type: graphql.String},
+			},
+		})
+		coinFields["info"] = &graphql.Field{
+			Type: infoType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loadersFromContext(p.Context).info.load(p.Source.(coinSource).id), nil
+			},
+		}
+	}
+
+	if s.historyService != nil {
+		pointType := graphql.NewObject(graphql.ObjectConfig{
+			Name:        "HistoryPoint",
+			Description: "USD price, market cap and volume of a coin at one instant.",
+			Fields: graphql.Fields{
+				"timestamp": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"price":     &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"marketCap": &graphql.Field{Type: graphql.Float},
+				"vol24Hr":   &graphql.Field{Type: graphql.Float},
+			},
+		})
+		coinFields["history"] = &graphql.Field{
+			Type:        graphql.NewList(graphql.NewNonNull(pointType)),
+			Description: "Price series over the last days.",
+			Args: graphql.FieldConfigArgument{
+				"days": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 30},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := s.authorize(p.Context, authUtils.ScopeHistory); err != nil {
+					return nil, err
+				}
+				days := p.Args["days"].(int)
+				if days < 1 || days > historyService.MaxDays {
+					return nil, fmt.Errorf("days must be between 1 and %d", historyService.MaxDays)
+				}
+				thunk := loadersFromContext(p.Context).history.load(historyKey{id: p.Source.(coinSource).id, days: days})
+				return func() (interface{}, error) {
+					history, err := thunk()
+					if history == nil || err != nil {
+						return nil, err
+					}
+					return history.(types.HistoryResponse).Points, nil
+				}, nil
+			},
+		}
+	}
+
+	coinType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Coin",
+		Description: "A coin, identified by its CoinGecko id.",
+		Fields:      coinFields,
+	})
+
+	healthType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Health",
+		Fields: graphql.Fields{
+			"status":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"geckoApiStatus": &graphql.Field{Type: graphql.String},
+			"timestamp":      &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"coin": &graphql.Field{
+				Type: graphql.NewNonNull(coinType),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := strings.ToLower(strings.TrimSpace(p.Args["id"].(string)))
+					if id == "" {
+						return nil, errors.New("id must not be empty")
+					}
+					return coinSource{id: id}, nil
+				},
+			},
+			"coins": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(coinType))),
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ids := normalizeTickers(stringArgs(p.Args["ids"]))
+					coins := make([]interface{}, len(ids))
+					for i, id := range ids {
+						coins[i] = coinSource{id: id}
+					}
+					return coins, nil
+				},
+			},
+			"health": &graphql.Field{
+				Type: graphql.NewNonNull(healthType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					status, geckoStatus, timestamp, err := s.statusService.CheckHealth(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]interface{}{
+						"status":         status,
+						"geckoApiStatus": geckoStatus,
+						"timestamp":      timestamp,
+					}, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// stringArgs converts a list argument to strings.
+func stringArgs(arg interface{}) []string {
+	values, _ := arg.([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package price_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"coinfetcher/docs"
+	cacheUtils "coinfetcher/services/cache"
+	geckoUtils "coinfetcher/services/gecko"
+	webhookUtils "coinfetcher/services/webhook"
+	"coinfetcher/types"
+
+	swaggerFiles "github.com/swaggo/files"
+)
+
+// servedRoute is a path registered on the server's mux, with the methods it accepts.
+type servedRoute struct {
+	pattern string   // Like "/v2/coins/{id}/price"; mux patterns ending in "/" match a whole subtree.
+	methods []string // Nil when the handler doesn't restrict methods itself.
+}
+
+// documentedTypes maps the "x-go-type" names used in the spec's schemas to the Go types
+// they describe, so CheckOpenAPI can compare their properties with the JSON encoding.
+var documentedTypes = map[string]reflect.Type{
+	"types.PriceResponse":        reflect.TypeOf(types.PriceResponse{}),
+	"types.HealthResponse":       reflect.TypeOf(types.HealthResponse{}),
+	"types.CoinMatch":            reflect.TypeOf(types.CoinMatch{}),
+	"types.SearchResponse":       reflect.TypeOf(types.SearchResponse{}),
+	"types.DominanceShare":       reflect.TypeOf(types.DominanceShare{}),
+	"types.GlobalMarketResponse": reflect.TypeOf(types.GlobalMarketResponse{}),
+	"types.CoinImage":            reflect.TypeOf(types.CoinImage{}),
+	"types.CoinInfo":             reflect.TypeOf(types.CoinInfo{}),
+	"types.TokenPriceResponse":   reflect.TypeOf(types.TokenPriceResponse{}),
+	"types.ExchangeTicker":       reflect.TypeOf(types.ExchangeTicker{}),
+	"types.VenueQuote":           reflect.TypeOf(types.VenueQuote{}),
+	"types.TickerSummary":        reflect.TypeOf(types.TickerSummary{}),
+	"types.TickersResponse":      reflect.TypeOf(types.TickersResponse{}),
+	"types.HistoryPoint":         reflect.TypeOf(types.HistoryPoint{}),
+	"types.HistoryResponse":      reflect.TypeOf(types.HistoryResponse{}),
+	"types.APIError":             reflect.TypeOf(types.APIError{}),
+	"types.FieldError":           reflect.TypeOf(types.FieldError{}),
+	"types.Meta":                 reflect.TypeOf(types.Meta{}),
+	"types.Problem":              reflect.TypeOf(types.Problem{}),
+	"types.Envelope":             reflect.TypeOf(types.Envelope{}),
+	"types.StreamRequest":        reflect.TypeOf(types.StreamRequest{}),
+	"types.StreamMessage":        reflect.TypeOf(types.StreamMessage{}),
+	"types.AlertRule":            reflect.TypeOf(types.AlertRule{}),
+	"types.AlertEvent":           reflect.TypeOf(types.AlertEvent{}),
+	"types.Holding":              reflect.TypeOf(types.Holding{}),
+	"types.PortfolioRequest":     reflect.TypeOf(types.PortfolioRequest{}),
+	"types.PositionValue":        reflect.TypeOf(types.PositionValue{}),
+	"types.PortfolioValuation":   reflect.TypeOf(types.PortfolioValuation{}),
+	"webhook_utils.Delivery":     reflect.TypeOf(webhookUtils.Delivery{}),
+	"webhook_utils.Attempt":      reflect.TypeOf(webhookUtils.Attempt{}),
+	"webhook_utils.Endpoint":     reflect.TypeOf(webhookUtils.Endpoint{}),
+	"price_api.cacheSummary":     reflect.TypeOf(cacheSummary{}),
+	"price_api.pollerStatus":     reflect.TypeOf(pollerStatus{}),
+	"price_api.logLevel":         reflect.TypeOf(logLevel{}),
+	"price_api.auditEntry":       reflect.TypeOf(auditEntry{}),
+	"cache_utils.EntryInfo":      reflect.TypeOf(cacheUtils.EntryInfo{}),
+	"gecko_utils.BreakerStatus":  reflect.TypeOf(geckoUtils.BreakerStatus{}),
+}
+
+// openAPISpec is the part of the OpenAPI document CheckOpenAPI looks at.
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			GoType     string                     `json:"x-go-type"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+// handle registers h on the server's mux and records the routes it serves for CheckOpenAPI.
+func (s *JSONAPIServer) handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+
+	rt, ok := h.(*router)
+	if !ok {
+		s.served = append(s.served, servedRoute{pattern: pattern})
+		return
+	}
+	for _, rte := range rt.routes {
+		s.served = append(s.served, servedRoute{pattern: "/" + strings.Join(rte.segments, "/"), methods: rte.allowed()})
+	}
+}
+
+// registerDocs serves the OpenAPI document at /openapi.json, Swagger UI at /swagger/ and
+// ReDoc at /swagger/redoc.html, all from files compiled into the binary.
+func (s *JSONAPIServer) registerDocs() {
+	spec := docs.Spec()
+	s.mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(spec)
+	})
+
+	pages := http.FileServer(http.FS(docs.Pages()))
+	s.mux.Handle("/swagger/", http.StripPrefix("/swagger", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			r.URL.Path = "/swagger.html"
+		}
+		pages.ServeHTTP(w, r)
+	})))
+	s.mux.Handle("/swagger/ui/", http.StripPrefix("/swagger/ui", http.FileServer(swaggerFiles.HTTP)))
+}
+
+// CheckOpenAPI compares the embedded OpenAPI document with the routes the server registered
+// and the Go types its responses are encoded from. Routes or methods served without being
+// documented, and schemas whose properties differ from the JSON encoding of their type, are
+// reported as an error. Documented routes the server doesn't serve are not: they belong to
+// features this configuration left disabled.
+func (s *JSONAPIServer) CheckOpenAPI() error {
+	var spec openAPISpec
+	if err := json.Unmarshal(docs.Spec(), &spec); err != nil {
+		return fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+
+	var problems []string
+	for _, served := range s.served {
+		problems = append(problems, checkRoute(spec, served)...)
+	}
+
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := spec.Components.Schemas[name]
+		if schema.GoType == "" {
+			continue
+		}
+		t, ok := documentedTypes[schema.GoType]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("schema %s: unknown Go type %s", name, schema.GoType))
+			continue
+		}
+
+		fields := jsonFields(t)
+		for field := range fields {
+			if _, ok := schema.Properties[field]; !ok {
+				problems = append(problems, fmt.Sprintf("schema %s: property %q of %s is undocumented", name, field, schema.GoType))
+			}
+		}
+		for property := range schema.Properties {
+			if _, ok := fields[property]; !ok {
+				problems = append(problems, fmt.Sprintf("schema %s: property %q is not a field of %s", name, property, schema.GoType))
+			}
+		}
+		for _, property := range schema.Required {
+			if omitted, ok := fields[property]; ok && omitted {
+				problems = append(problems, fmt.Sprintf("schema %s: property %q is required but omitted when empty", name, property))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("OpenAPI document is out of date:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkRoute reports what spec is missing about served.
+func checkRoute(spec openAPISpec, served servedRoute) []string {
+	// A subtree pattern like "/v1/coins/" is documented by the paths below it.
+	if strings.HasSuffix(served.pattern, "/") {
+		for path := range spec.Paths {
+			if strings.HasPrefix(path, served.pattern) {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("route %s* is undocumented", served.pattern)}
+	}
+
+	operations, ok := spec.Paths[served.pattern]
+	if !ok {
+		return []string{fmt.Sprintf("route %s is undocumented", served.pattern)}
+	}
+	var problems []string
+	for _, method := range served.methods {
+		if method == http.MethodHead {
+			continue // Implied by GET.
+		}
+		if _, ok := operations[strings.ToLower(method)]; !ok {
+			problems = append(problems, fmt.Sprintf("route %s %s is undocumented", method, served.pattern))
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the JSON property names of struct type t, and whether each is omitted when empty.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = strings.Contains(","+options+",", ",omitempty,")
+	}
+	return fields
+}
@@ -0,0 +1,122 @@
+package price_api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	alertService "coinfetcher/services/alert"
+	authUtils "coinfetcher/services/auth"
+	coinService "coinfetcher/services/coin"
+	exchangeService "coinfetcher/services/exchange"
+	globalService "coinfetcher/services/global"
+	historyService "coinfetcher/services/history"
+	pollerService "coinfetcher/services/poller"
+	portfolioService "coinfetcher/services/portfolio"
+	priceService "coinfetcher/services/price"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	searchService "coinfetcher/services/search"
+	tokenService "coinfetcher/services/token"
+	webhookUtils "coinfetcher/services/webhook"
+)
+
+// writeTestJWKS writes a key set holding one generated RSA key to a file and returns its path.
+func writeTestJWKS(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newFullServer creates a keyed server with every optional API enabled, backed by the real
+// services; none of them is called unless a request is served.
+func newFullServer(t *testing.T) *JSONAPIServer {
+	t.Helper()
+	verifier, err := authUtils.NewJWTVerifier(context.Background(), authUtils.JWTConfig{
+		JWKS:     writeTestJWKS(t),
+		Issuer:   "https://issuer.example.com/",
+		Audience: "coinfetcher",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := NewRequestValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pricing := priceService.NewPriceFetcher()
+	quotes := priceService.NewQuoteFetcher()
+	poller := pollerService.NewPoller(pricing, time.Minute)
+	webhooks, err := webhookUtils.NewDispatcher("", webhookUtils.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := alertService.NewEngine("", poller, webhooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := authUtils.Key{Scopes: []string{authUtils.ScopePrice, authUtils.ScopeHistory, authUtils.ScopeAdmin}}
+	return newKeyedServer(t, key, rateLimitUtils.Rule{Name: "default", Key: rateLimitUtils.KeyIP, Rate: 100, Burst: 100},
+		WithBearerTokens(verifier),
+		WithRequestValidation(validator),
+		WithAdmin(AdminConfig{Pollers: map[string]Pausable{"price-poller": poller}}),
+		WithPriceCaching(15*time.Second),
+		WithPriceStream(poller, 50),
+		WithPriceEvents(pollerService.NewEventBroker(poller, 0.1, 100), 15*time.Second),
+		WithCoinSearcher(searchService.NewCoinSearcher(searchService.NewCoinIndex(time.Hour, 1))),
+		WithGlobalFetcher(globalService.NewGlobalFetcher([]string{"btc"})),
+		WithCoinInfoFetcher(coinService.NewCoinInfoFetcher()),
+		WithTokenPriceFetcher(tokenService.NewTokenPriceFetcher(30)),
+		WithTickerFetcher(exchangeService.NewTickerFetcher()),
+		WithHistoryFetcher(historyService.NewHistoryFetcher()),
+		WithPortfolioValuer(portfolioService.NewPortfolioValuer(quotes, time.Minute)),
+		WithGraphQL(quotes, DefaultGraphQLLimits()),
+		WithWebhooks(webhooks),
+		WithAlerts(alerts),
+	)
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	s := newFullServer(t)
+	if err := s.CheckOpenAPI(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every optional API must have been registered, or the check above proves little.
+	registered := make(map[string]bool)
+	for _, served := range s.served {
+		registered[served.pattern] = true
+	}
+	for _, pattern := range []string{"/v1/price", "/v1/search", "/v1/global", "/v1/token_price", "/v1/portfolio/value",
+		"/v1/alerts", "/v1/webhooks", "/v1/stream", "/v1/price/events", "/graphql", "/admin/caches", "/v2/coins/{id}/price"} {
+		if !registered[pattern] {
+			t.Errorf("%s is not served by the fully configured server", pattern)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package price_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	portfolioService "coinfetcher/services/portfolio"
+	"coinfetcher/types"
+)
+
+// maxPortfolioBodyBytes caps the size of portfolio valuation request bodies.
+const maxPortfolioBodyBytes = 64 << 10
+
+// WithPortfolioValuer enables the "/v1/portfolio/value" endpoint backed by the given valuer.
+func WithPortfolioValuer(valuer portfolioService.PortfolioValuer) Option {
+	return func(s *JSONAPIServer) {
+		s.portfolioService = valuer
+	}
+}
+
+// newPortfolioRouter creates the router of the "/v1/portfolio" endpoints.
+func (s *JSONAPIServer) newPortfolioRouter() *router {
+	rt := s.newProblemRouter()
+	rt.handle(http.MethodPost, "/v1/portfolio/value", s.makeHTTPHandlerFunc(s.handleValuePortfolio))
+	return rt
+}
+
+// handleValuePortfolio handles the "Value portfolio" endpoint. As CSV, the positions are
+// rendered one per row.
+func (s *JSONAPIServer) handleValuePortfolio(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req types.PortfolioRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPortfolioBodyBytes)).Decode(&req); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	// Check the input here, so the service's errors all come from CoinGecko.
+	req, err := portfolioService.NormalizeRequest(req)
+	if err != nil {
+		return badRequest("%v", err)
+	}
+
+	valuation, err := s.portfolioService.ValuePortfolio(ctx, req)
+	if err != nil {
+		return err
+	}
+	return s.render(w, r, http.StatusOK, &valuation)
+}
@@ -4,13 +4,33 @@ package price_api
 import (
 	"context"
 	"encoding/json"
-	"math/rand"
+	"expvar"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	alertService "coinfetcher/services/alert"
+	authUtils "coinfetcher/services/auth"
+	coinService "coinfetcher/services/coin"
+	exchangeService "coinfetcher/services/exchange"
+	globalService "coinfetcher/services/global"
 	healthService "coinfetcher/services/health"
+	historyService "coinfetcher/services/history"
+	openAPIUtils "coinfetcher/services/openapi"
+	pollerService "coinfetcher/services/poller"
+	portfolioService "coinfetcher/services/portfolio"
 	priceService "coinfetcher/services/price"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	requestUtils "coinfetcher/services/request"
+	searchService "coinfetcher/services/search"
+	tokenService "coinfetcher/services/token"
+	webhookUtils "coinfetcher/services/webhook"
 	"coinfetcher/types"
+
+	"github.com/graphql-go/graphql"
+	log "github.com/sirupsen/logrus"
 )
 
 // APIFunc is a type representing a function that handles API requests.
@@ -33,46 +53,266 @@ type HealthResponse struct {
 
 // JSONAPIServer represents a JSON API server.
 type JSONAPIServer struct {
-	listenAddr     string
-	pricingService priceService.PriceFetcher
-	statusService  healthService.HealthChecker
+	listenAddr             string
+	pricingService         priceService.PriceFetcher
+	statusService          healthService.HealthChecker
+	searchService          searchService.CoinSearcher
+	globalService          globalService.GlobalFetcher
+	coinService            coinService.CoinInfoFetcher
+	tokenService           tokenService.TokenPriceFetcher
+	tickerService          exchangeService.TickerFetcher
+	historyService         historyService.HistoryFetcher
+	quoteService           priceService.QuoteFetcher
+	portfolioService       portfolioService.PortfolioValuer
+	priceMaxAge            time.Duration
+	apiKeys                *authUtils.KeyStore
+	quotas                 *authUtils.QuotaTracker
+	tokenVerifier          *authUtils.JWTVerifier
+	rateLimiter            *rateLimitUtils.Limiter
+	validator              *openAPIUtils.Validator
+	alerts                 *alertService.Engine
+	webhooks               *webhookUtils.Dispatcher
+	admin                  *AdminConfig
+	auditLog               auditLog
+	graphQLLimits          GraphQLLimits
+	graphQLSchema          graphql.Schema
+	v2Router               *router
+	poller                 *pollerService.Poller
+	maxStreamSubscriptions int
+	eventBroker            *pollerService.EventBroker
+	eventsKeepAlive        time.Duration
+	mux                    *http.ServeMux
+	served                 []servedRoute
+	middlewares            []func(http.Handler) http.Handler
+	config                 ServerConfig
+	workers                []*worker
+	streams                context.Context // Cancelled when shutdown starts, ending streamed responses.
+	stopStreams            context.CancelFunc
+}
+
+// Option configures optional services of the JSONAPIServer.
+type Option func(*JSONAPIServer)
+
+// WithCoinSearcher enables the "/v1/search" endpoint backed by the given searcher.
+func WithCoinSearcher(searcher searchService.CoinSearcher) Option {
+	return func(s *JSONAPIServer) {
+		s.searchService = searcher
+	}
+}
+
+// WithGlobalFetcher enables the "/v1/global" endpoint backed by the given fetcher.
+func WithGlobalFetcher(fetcher globalService.GlobalFetcher) Option {
+	return func(s *JSONAPIServer) {
+		s.globalService = fetcher
+	}
+}
+
+// WithCoinInfoFetcher enables the "/v1/coins/{id}" endpoint backed by the given fetcher.
+func WithCoinInfoFetcher(fetcher coinService.CoinInfoFetcher) Option {
+	return func(s *JSONAPIServer) {
+		s.coinService = fetcher
+	}
+}
+
+// WithTokenPriceFetcher enables the "/v1/token_price" endpoint backed by the given fetcher.
+func WithTokenPriceFetcher(fetcher tokenService.TokenPriceFetcher) Option {
+	return func(s *JSONAPIServer) {
+		s.tokenService = fetcher
+	}
+}
+
+// WithTickerFetcher enables the "/v1/coins/{id}/tickers" endpoint backed by the given fetcher.
+func WithTickerFetcher(fetcher exchangeService.TickerFetcher) Option {
+	return func(s *JSONAPIServer) {
+		s.tickerService = fetcher
+	}
+}
+
+// WithHistoryFetcher enables the "/v2/coins/{id}/history" endpoint backed by the given fetcher.
+func WithHistoryFetcher(fetcher historyService.HistoryFetcher) Option {
+	return func(s *JSONAPIServer) {
+		s.historyService = fetcher
+	}
+}
+
+// WithMiddleware wraps every route of the server in mw. Middleware runs in registration order.
+func WithMiddleware(mw func(http.Handler) http.Handler) Option {
+	return func(s *JSONAPIServer) {
+		s.middlewares = append(s.middlewares, mw)
+	}
 }
 
 // NewJSONAPIServer creates a new instance of the JSONAPIServer.
-func NewJSONAPIServer(listenAddr string, pricingService priceService.PriceFetcher, statusService healthService.HealthChecker) *JSONAPIServer {
-	return &JSONAPIServer{
+func NewJSONAPIServer(listenAddr string, pricingService priceService.PriceFetcher, statusService healthService.HealthChecker, opts ...Option) *JSONAPIServer {
+	s := &JSONAPIServer{
 		listenAddr:     listenAddr,
 		pricingService: pricingService,
 		statusService:  statusService,
+		mux:            http.NewServeMux(),
+		config:         DefaultServerConfig(),
+		graphQLLimits:  DefaultGraphQLLimits(),
+	}
+	s.streams, s.stopStreams = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.v2Router = s.newV2Router()
+	s.registerRoutes()
+	return s
+}
+
+// registerRoutes adds the API routes to the server's own mux.
+func (s *JSONAPIServer) registerRoutes() {
+	s.handle("/v1/price", s.makeHTTPHandlerFunc(s.handleFetchPrice))
+	s.handle("/v1/health", s.makeHTTPHandlerFunc(s.handleApiHealth))
+
+	// Optional endpoints are only registered when their service was provided.
+	if s.searchService != nil {
+		s.handle("/v1/search", s.makeHTTPHandlerFunc(s.handleSearchCoins))
+	}
+	if s.globalService != nil {
+		s.handle("/v1/global", s.makeHTTPHandlerFunc(s.handleFetchGlobal))
+	}
+	if s.coinService != nil || s.tickerService != nil {
+		s.handle("/v1/coins/", s.makeHTTPHandlerFunc(s.handleCoinResource))
 	}
+	if s.tokenService != nil {
+		s.handle("/v1/token_price", s.makeHTTPHandlerFunc(s.handleFetchTokenPrice))
+	}
+	if s.portfolioService != nil {
+		s.handle("/v1/portfolio/value", s.newPortfolioRouter())
+	}
+
+	// Webhook endpoints make the server send requests to URLs of the caller's choosing, so
+	// like the admin API they, and the alerts delivered through them, are never anonymous.
+	if s.alerts != nil && s.authEnabled() {
+		alerts := s.newAlertsRouter()
+		s.handle("/v1/alerts/", alerts)
+		s.mux.Handle("/v1/alerts", alerts) // Its routes were recorded with the subtree above.
+	} else if s.alerts != nil {
+		log.WithFields(log.Fields{"route": "/v1/alerts"}).Warn("Alerts API disabled: it requires API keys or bearer tokens")
+	}
+	if s.webhooks != nil && s.authEnabled() {
+		webhooks := s.newWebhooksRouter()
+		s.handle("/v1/webhooks/", webhooks)
+		s.mux.Handle("/v1/webhooks", webhooks)
+	} else if s.webhooks != nil {
+		log.WithFields(log.Fields{"route": "/v1/webhooks"}).Warn("Webhooks API disabled: it requires API keys or bearer tokens")
+	}
+
+	if s.poller != nil {
+		s.handle("/v1/stream", http.HandlerFunc(s.handleStream))
+	}
+	if s.poller != nil && s.eventBroker != nil {
+		s.handle("/v1/price/events", http.HandlerFunc(s.handlePriceEvents))
+	}
+
+	if s.quoteService != nil {
+		schema, err := s.newGraphQLSchema()
+		if err != nil {
+			panic(fmt.Sprintf("invalid GraphQL schema: %v", err)) // The schema is static, so this is a programming error.
+		}
+		s.graphQLSchema = schema
+		s.handle("/graphql", http.HandlerFunc(s.handleGraphQL))
+	}
+
+	// The counters reveal who is being throttled, so like the admin API they need credentials.
+	if s.rateLimiter != nil && s.authEnabled() {
+		s.handle("/debug/vars", expvar.Handler())
+	} else if s.rateLimiter != nil {
+		log.WithFields(log.Fields{"route": "/debug/vars"}).Warn("Metrics disabled: they require API keys or bearer tokens")
+	}
+
+	// The admin API must never be reachable anonymously.
+	if s.admin != nil && s.authEnabled() {
+		s.handle("/admin/", s.newAdminRouter())
+	} else if s.admin != nil {
+		log.WithFields(log.Fields{"route": "/admin/"}).Warn("Admin API disabled: it requires API keys or bearer tokens")
+	}
+
+	// The v2 surface runs on its own router, side by side with v1.
+	s.handle("/v2/", s.v2Router)
+
+	// Documentation isn't part of the API it documents, so it isn't recorded for CheckOpenAPI.
+	s.registerDocs()
 }
 
-// Run starts the JSON API server.
-func (s *JSONAPIServer) Run() {
-	http.HandleFunc("/v1/price", s.makeHTTPHandlerFunc(s.handleFetchPrice))
-	http.HandleFunc("/v1/health", s.makeHTTPHandlerFunc(s.handleApiHealth))
+// Handle registers an additional handler on the server's mux.
+func (s *JSONAPIServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
 
-	http.ListenAndServe(s.listenAddr, nil)
+// Handler returns the server's routes wrapped in its middleware, ready to be
+// served, mounted inside another mux or used with httptest.NewServer.
+func (s *JSONAPIServer) Handler() http.Handler {
+	var h http.Handler = s.mux
+	// Quotas are charged last, once the request passed every check that could reject it.
+	if s.quotas != nil {
+		h = s.chargeQuota(h)
+	}
+	// Validation runs after authentication and rate limiting, right before the handler.
+	if s.validator != nil {
+		h = s.validateRequest(h)
+	}
+	// Wrap in reverse so the first registered middleware is the outermost one.
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+	// Callers are authenticated before any middleware runs, so those can rely on the principal.
+	// Rate limits keyed by IP or route apply before authentication does any work; those keyed
+	// by API key after it, once the caller is known.
+	if s.authEnabled() {
+		if s.rateLimiter != nil {
+			h = s.rateLimit(s.rateLimiter.AllowCaller, h)
+		}
+		h = s.authenticate(h)
+	}
+	if s.rateLimiter != nil {
+		allow := s.rateLimiter.AllowClient
+		if !s.authEnabled() {
+			allow = s.rateLimiter.Allow // Every caller is anonymous, so all rules apply at once.
+		}
+		h = s.rateLimit(allow, h)
+	}
+	// Request IDs are assigned first so every middleware and handler can log them.
+	return requestUtils.Middleware(h)
 }
 
 // makeHTTPHandlerFunc is a helper function to create an HTTP handler function.
 func (s *JSONAPIServer) makeHTTPHandlerFunc(apiFn APIFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), "requestID", rand.Intn(10000000))
-
-		if err := apiFn(ctx, w, r); err != nil {
-			s.writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		// Refuse unsupported formats before any upstream work is done.
+		if _, err := acceptedFormats(r); err != nil {
+			s.writeProblem(w, r, err)
+			return
+		}
+		// Errors are reported as RFC 7807 problem details.
+		if err := apiFn(r.Context(), w, r); err != nil {
+			s.writeProblem(w, r, err)
 		}
 	}
 }
 
+// newProblemRouter creates a router for v1 resources, which reports unknown paths and
+// methods as problem details like the handlers do.
+func (s *JSONAPIServer) newProblemRouter() *router {
+	return newRouter(
+		func(w http.ResponseWriter, r *http.Request) {
+			s.writeProblem(w, r, &statusError{status: http.StatusNotFound, code: "not_found", message: "no such resource"})
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			s.writeProblem(w, r, &statusError{status: http.StatusMethodNotAllowed, code: "method_not_allowed", message: r.Method + " is not allowed on this resource"})
+		},
+	)
+}
+
 // handleFetchPrice handles the "Fetch coin price" endpoint.
 func (s *JSONAPIServer) handleFetchPrice(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ticker := r.URL.Query().Get("ticker")
 
 	price, vol24Hr, timestamp, err := s.pricingService.FetchPrice(ctx, ticker)
 	if err != nil {
-		return err
+		return withTicker(err, ticker)
 	}
 
 	priceResp := types.PriceResponse{
@@ -82,7 +322,8 @@ func (s *JSONAPIServer) handleFetchPrice(ctx context.Context, w http.ResponseWri
 		Vol24Hr:   vol24Hr,
 	}
 
-	return s.writeJSON(w, http.StatusOK, &priceResp)
+	policy := s.priceCachePolicy(priceResp)
+	return s.renderCached(w, r, http.StatusOK, &priceResp, &policy)
 }
 
 // handleApiHealth handles the "Get Gecko API health status" endpoint.
@@ -98,12 +339,146 @@ func (s *JSONAPIServer) handleApiHealth(ctx context.Context, w http.ResponseWrit
 		Timestamp:      timestamp,
 	}
 
-	return s.writeJSON(w, http.StatusOK, &healthResponse)
+	return s.render(w, r, http.StatusOK, &healthResponse)
+}
+
+// Search result limits for the "Search coins" endpoint.
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// handleSearchCoins handles the "Search coins" endpoint.
+func (s *JSONAPIServer) handleSearchCoins(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		return badRequest("q must not be empty")
+	}
+
+	limit := defaultSearchLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return badRequest("limit must be an integer between 1 and %d", maxSearchLimit)
+		}
+		limit = n
+	}
+
+	coins, err := s.searchService.SearchCoins(ctx, query, limit)
+	if err != nil {
+		return err
+	}
+
+	searchResp := types.SearchResponse{
+		Query: query,
+		Coins: coins,
+	}
+
+	return s.render(w, r, http.StatusOK, &searchResp)
+}
+
+// handleFetchGlobal handles the "Global market overview" endpoint.
+func (s *JSONAPIServer) handleFetchGlobal(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	global, err := s.globalService.FetchGlobal(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.render(w, r, http.StatusOK, &global)
+}
+
+// maxTokenContracts caps the number of contracts accepted by the "Token price" endpoint.
+const maxTokenContracts = 100
+
+// handleFetchTokenPrice handles the "Token price by contract address" endpoint.
+func (s *JSONAPIServer) handleFetchTokenPrice(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	platform := r.URL.Query().Get("platform")
+
+	var contracts []string
+	for _, contract := range strings.Split(r.URL.Query().Get("contracts"), ",") {
+		if contract = strings.TrimSpace(contract); contract != "" {
+			contracts = append(contracts, contract)
+		}
+	}
+	if len(contracts) > maxTokenContracts {
+		return badRequest("at most %d contracts can be requested at once", maxTokenContracts)
+	}
+	// Check the input here, so the service's errors all come from CoinGecko.
+	if err := tokenService.ValidatePlatform(platform); err != nil {
+		return badRequest("%v", err)
+	}
+	if len(contracts) == 0 {
+		return badRequest("at least one contract address is required")
+	}
+	for _, contract := range contracts {
+		if _, err := tokenService.NormalizeContract(platform, contract); err != nil {
+			return badRequest("%v", err)
+		}
+	}
+
+	prices, err := s.tokenService.FetchTokenPrices(ctx, platform, contracts)
+	if err != nil {
+		return err
+	}
+
+	// Report the requested contracts CoinGecko had no price for.
+	found := make(map[string]bool, len(prices))
+	for _, p := range prices {
+		found[strings.ToLower(p.Ticker)] = true
+	}
+	var missing []string
+	for _, contract := range contracts {
+		if !found[strings.ToLower(contract)] {
+			missing = append(missing, contract)
+		}
+	}
+
+	tokenResp := types.TokenPriceResponse{
+		Platform: platform,
+		Prices:   prices,
+		Missing:  missing,
+	}
+
+	return s.render(w, r, http.StatusOK, &tokenResp)
+}
+
+// handleCoinResource dispatches requests below "/v1/coins/" to the matching coin endpoint.
+func (s *JSONAPIServer) handleCoinResource(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/coins/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] != "" && s.coinService != nil:
+		return s.handleFetchCoinInfo(ctx, w, r, parts[0])
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "tickers" && s.tickerService != nil:
+		return s.handleFetchTickers(ctx, w, r, parts[0])
+	}
+
+	return &statusError{status: http.StatusNotFound, code: "not_found", message: "unknown coin resource"}
+}
+
+// handleFetchCoinInfo handles the "Coin metadata" endpoint.
+func (s *JSONAPIServer) handleFetchCoinInfo(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) error {
+	info, err := s.coinService.FetchCoinInfo(ctx, id)
+	if err != nil {
+		return withTicker(err, id)
+	}
+
+	return s.render(w, r, http.StatusOK, &info)
+}
+
+// handleFetchTickers handles the "Exchange tickers and cross-venue spread" endpoint.
+func (s *JSONAPIServer) handleFetchTickers(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) error {
+	tickers, err := s.tickerService.FetchTickers(ctx, id)
+	if err != nil {
+		return withTicker(err, id)
+	}
+
+	return s.render(w, r, http.StatusOK, &tickers)
 }
 
 // writeJSON writes JSON responses with the specified status code.
 func (s *JSONAPIServer) writeJSON(w http.ResponseWriter, statusCode int, v interface{}) error {
-	w.WriteHeader(statusCode)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	return json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,77 @@
+package price_api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"coinfetcher/types"
+)
+
+// stubPricing is a PriceFetcher quoting every coin at the same price, or failing with err.
+type stubPricing struct {
+	price     float64
+	timestamp time.Time
+	err       error
+	calls     int32
+}
+
+func (p *stubPricing) FetchPrice(ctx context.Context, ticker string) (float64, float64, time.Time, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if p.err != nil {
+		return 0, 0, time.Time{}, p.err
+	}
+	return p.price, 1e9, p.timestamp, nil
+}
+
+func (p *stubPricing) FetchPrices(ctx context.Context, tickers []string) ([]types.PriceResponse, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if p.err != nil {
+		return nil, p.err
+	}
+	prices := make([]types.PriceResponse, len(tickers))
+	for i, ticker := range tickers {
+		prices[i] = types.PriceResponse{Ticker: ticker, Price: p.price, Timestamp: p.timestamp, Vol24Hr: 1e9}
+	}
+	return prices, nil
+}
+
+// stubHealth is a HealthChecker reporting the upstream as up.
+type stubHealth struct{}
+
+func (stubHealth) CheckHealth(ctx context.Context) (string, string, time.Time, error) {
+	return "ok", "(V3) To the Moon!", time.Now().UTC(), nil
+}
+
+// newTestServer creates a server quoting every coin at 64000 through pricing, if it is nil.
+func newTestServer(pricing *stubPricing, opts ...Option) (*JSONAPIServer, *stubPricing) {
+	if pricing == nil {
+		pricing = &stubPricing{price: 64000, timestamp: time.Now().UTC()}
+	}
+	return NewJSONAPIServer(":0", pricing, stubHealth{}, opts...), pricing
+}
+
+// serve sends a request to the handler of s and returns the recorded response.
+func serve(s *JSONAPIServer, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFetchPrice(t *testing.T) {
+	s, pricing := newTestServer(nil)
+	rec := serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if pricing.calls != 1 {
+		t.Errorf("pricing service called %d times, want once", pricing.calls)
+	}
+}
@@ -0,0 +1,170 @@
+package price_api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	alertService "coinfetcher/services/alert"
+	geckoUtils "coinfetcher/services/gecko"
+	priceService "coinfetcher/services/price"
+	requestUtils "coinfetcher/services/request"
+	searchService "coinfetcher/services/search"
+	webhookUtils "coinfetcher/services/webhook"
+	"coinfetcher/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// problemContentType is the media type of RFC 7807 problem details.
+const problemContentType = "application/problem+json"
+
+// problemTitles are the short, fixed summaries of each problem type, by code.
+var problemTitles = map[string]string{
+	"bad_request":          "Invalid request",
+	"not_found":            "Resource not found",
+	"invalid_request":      "Request failed validation",
+	"unauthorized":         "Authentication required",
+	"forbidden":            "Access denied",
+	"not_acceptable":       "Response format not acceptable",
+	"conflict":             "Resource in use",
+	"rate_limited":         "Rate limit exceeded",
+	"quota_exceeded":       "Quota exhausted",
+	"not_ready":            "Service not ready",
+	"upstream_unavailable": "Upstream temporarily unavailable",
+	"upstream_error":       "Upstream request failed",
+	"internal_error":       "Internal error",
+}
+
+// tickerError attaches the coin a request was about to an error, for the "ticker" problem extension.
+type tickerError struct {
+	ticker string
+	err    error
+}
+
+// Error implements the error interface.
+func (e *tickerError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *tickerError) Unwrap() error {
+	return e.err
+}
+
+// withTicker attaches ticker to err, if there is an error.
+func withTicker(err error, ticker string) error {
+	if err == nil {
+		return nil
+	}
+	return &tickerError{ticker: ticker, err: err}
+}
+
+// newProblem creates the problem with the given code. Its type is a URI relative to the
+// service, so clients can switch on it without parsing the title or detail.
+func newProblem(r *http.Request, status int, code, detail string) *types.Problem {
+	title, ok := problemTitles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &types.Problem{
+		Type:     "/problems/" + strings.ReplaceAll(code, "_", "-"),
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: requestUtils.RequestIDFromContext(r.Context()),
+		Code:     code,
+	}
+}
+
+// problemFor maps an error returned by a handler onto the problem reported to the client.
+// Errors from the service itself carry messages meant for clients. Anything else failed
+// upstream, and its details, such as CoinGecko URLs and network errors, are left out.
+func problemFor(r *http.Request, err error) *types.Problem {
+	var problem *types.Problem
+	var se *statusError
+	var notAcceptable *notAcceptableError
+	switch {
+	case errors.As(err, &se):
+		problem = newProblem(r, se.status, se.code, se.message)
+	case errors.As(err, &notAcceptable):
+		problem = newProblem(r, http.StatusNotAcceptable, "not_acceptable", notAcceptable.message)
+	case errors.Is(err, priceService.ErrTickerNotFound):
+		problem = newProblem(r, http.StatusNotFound, "not_found", "CoinGecko has no price data for this coin")
+	case errors.Is(err, searchService.ErrIndexNotReady):
+		problem = newProblem(r, http.StatusServiceUnavailable, "not_ready", "the coin index is still loading")
+		problem.RetryAfter = 5
+	case errors.Is(err, alertService.ErrNotSaved), errors.Is(err, webhookUtils.ErrNotSaved):
+		problem = newProblem(r, http.StatusInternalServerError, "internal_error", "the change could not be saved and was undone, try again later")
+	case isUpstreamStatus(err, http.StatusNotFound):
+		problem = newProblem(r, http.StatusNotFound, "not_found", "CoinGecko does not know this coin")
+	default:
+		if wait, ok := geckoUtils.RetryAfter(err); ok {
+			problem = newProblem(r, http.StatusServiceUnavailable, "upstream_unavailable", "CoinGecko is temporarily unavailable")
+			problem.RetryAfter = int(math.Ceil(wait.Seconds()))
+		} else {
+			problem = newProblem(r, http.StatusBadGateway, "upstream_error", "fetching data from CoinGecko failed")
+		}
+	}
+
+	var te *tickerError
+	if errors.As(err, &te) {
+		problem.Ticker = te.ticker
+	}
+	return problem
+}
+
+// isUpstreamStatus reports whether err is CoinGecko answering with status.
+func isUpstreamStatus(err error, status int) bool {
+	var statusErr *geckoUtils.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == status
+}
+
+// logProblem logs server side failures with the full error, which clients only see as
+// the request ID under "instance".
+func logProblem(r *http.Request, problem *types.Problem, err error) {
+	if problem.Status < http.StatusInternalServerError {
+		return
+	}
+	log.WithFields(log.Fields{
+		"requestID": problem.Instance,
+		"path":      r.URL.Path,
+		"status":    problem.Status,
+		"code":      problem.Code,
+		"err":       err,
+	}).Error("request failed")
+}
+
+// writeProblem writes err to the client as problem details.
+func (s *JSONAPIServer) writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemFor(r, err)
+	logProblem(r, problem, err)
+	sendProblem(w, problem)
+}
+
+// writeError writes an error raised by a middleware, before any handler ran, in the error
+// format of the API r is for: problem details on v1, the envelope everywhere else.
+func (s *JSONAPIServer) writeError(w http.ResponseWriter, r *http.Request, apiErr *types.APIError) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		s.writeEnvelope(w, r, apiErr.Status, nil, apiErr)
+		return
+	}
+	problem := newProblem(r, apiErr.Status, apiErr.Code, apiErr.Message)
+	problem.Fields = apiErr.Fields
+	problem.RetryAfter, _ = strconv.Atoi(w.Header().Get("Retry-After"))
+	sendProblem(w, problem)
+}
+
+// sendProblem writes problem as the response.
+func sendProblem(w http.ResponseWriter, problem *types.Problem) {
+	if problem.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(problem.RetryAfter))
+	}
+	// Problems are always JSON, whatever format the client asked for.
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,131 @@
+package price_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	alertService "coinfetcher/services/alert"
+	authUtils "coinfetcher/services/auth"
+	geckoUtils "coinfetcher/services/gecko"
+	priceService "coinfetcher/services/price"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	requestUtils "coinfetcher/services/request"
+	searchService "coinfetcher/services/search"
+	webhookUtils "coinfetcher/services/webhook"
+	"coinfetcher/types"
+)
+
+func TestProblemFor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/price?ticker=bitcoin", nil)
+	r = r.WithContext(requestUtils.WithRequestID(r.Context(), "req-1"))
+
+	for _, tc := range []struct {
+		name       string
+		err        error
+		status     int
+		code       string
+		detail     string // Expected detail, if not empty.
+		retryAfter int
+		ticker     string
+	}{
+		{"bad request", badRequest("days must be positive"), http.StatusBadRequest, "bad_request", "days must be positive", 0, ""},
+		{"missing resource", notFound("cache", "prices"), http.StatusNotFound, "not_found", "cache prices does not exist", 0, ""},
+		{"not acceptable", &notAcceptableError{message: "unsupported format"}, http.StatusNotAcceptable, "not_acceptable", "unsupported format", 0, ""},
+		{"unknown ticker", withTicker(priceService.ErrTickerNotFound, "nocoin"), http.StatusNotFound, "not_found", "", 0, "nocoin"},
+		{"index loading", searchService.ErrIndexNotReady, http.StatusServiceUnavailable, "not_ready", "", 5, ""},
+		{"upstream 404", fmt.Errorf("fetching coin: %w", &geckoUtils.StatusError{StatusCode: http.StatusNotFound}), http.StatusNotFound, "not_found", "", 0, ""},
+		{"upstream throttling", &geckoUtils.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond}, http.StatusServiceUnavailable, "upstream_unavailable", "", 2, ""},
+		{"upstream failure", withTicker(&geckoUtils.StatusError{StatusCode: http.StatusInternalServerError}, "bitcoin"), http.StatusBadGateway, "upstream_error", "fetching data from CoinGecko failed", 0, "bitcoin"},
+		{"unsaved change", fmt.Errorf("%w: disk full", alertService.ErrNotSaved), http.StatusInternalServerError, "internal_error", "the change could not be saved and was undone, try again later", 0, ""},
+		{"unsaved endpoint", fmt.Errorf("%w: disk full", webhookUtils.ErrNotSaved), http.StatusInternalServerError, "internal_error", "", 0, ""},
+		{"network error", errors.New("dial tcp api.coingecko.com: connection refused"), http.StatusBadGateway, "upstream_error", "fetching data from CoinGecko failed", 0, ""},
+	} {
+		problem := problemFor(r, tc.err)
+		if problem.Status != tc.status || problem.Code != tc.code || problem.RetryAfter != tc.retryAfter || problem.Ticker != tc.ticker {
+			t.Errorf("%s: got %d %s (retryAfter %d, ticker %q), want %d %s (retryAfter %d, ticker %q)",
+				tc.name, problem.Status, problem.Code, problem.RetryAfter, problem.Ticker, tc.status, tc.code, tc.retryAfter, tc.ticker)
+		}
+		if tc.detail != "" && problem.Detail != tc.detail {
+			t.Errorf("%s: detail = %q, want %q", tc.name, problem.Detail, tc.detail)
+		}
+		if want := "/problems/" + strings.ReplaceAll(tc.code, "_", "-"); problem.Type != want || problem.Title != problemTitles[tc.code] || problem.Instance != "req-1" {
+			t.Errorf("%s: type = %q, title = %q, instance = %q, want %q, %q, req-1", tc.name, problem.Type, problem.Title, problem.Instance, want, problemTitles[tc.code])
+		}
+	}
+}
+
+func TestHandlerErrorsAreProblems(t *testing.T) {
+	s, _ := newTestServer(&stubPricing{err: priceService.ErrTickerNotFound})
+	rec := serve(s, http.MethodGet, "/v1/price?ticker=nocoin", nil)
+
+	var problem types.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || rec.Header().Get("Content-Type") != problemContentType {
+		t.Fatalf("want problem details, got %s %s", rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if rec.Code != http.StatusNotFound || problem.Status != http.StatusNotFound || problem.Ticker != "nocoin" || problem.Instance == "" {
+		t.Errorf("status = %d, problem = %+v, want a 404 about nocoin with the request ID", rec.Code, problem)
+	}
+}
+
+// newAuthServer creates a test server requiring the API key "test-key". Callers may make two
+// requests, and then one a second.
+func newAuthServer(t *testing.T) *JSONAPIServer {
+	t.Helper()
+	return newKeyedServer(t, authUtils.Key{Scopes: []string{authUtils.ScopePrice}},
+		rateLimitUtils.Rule{Name: "default", Key: rateLimitUtils.KeyAPIKey, Rate: 1, Burst: 2})
+}
+
+func TestMiddlewareErrorsUseTheFormatOfTheAPI(t *testing.T) {
+	s := newAuthServer(t)
+	key := http.Header{"X-Api-Key": {"test-key"}}
+	for i := 0; i < 2; i++ {
+		serve(s, http.MethodGet, "/v1/price?ticker=bitcoin", key) // Uses up the rate limit.
+	}
+
+	for _, tc := range []struct {
+		target string
+		header http.Header
+		status int
+		code   string
+	}{
+		{"/v1/price?ticker=bitcoin", nil, http.StatusUnauthorized, "unauthorized"},
+		{"/v2/coins/bitcoin/price", nil, http.StatusUnauthorized, "unauthorized"},
+		{"/v1/price?ticker=bitcoin", key, http.StatusTooManyRequests, "rate_limited"},
+		{"/v2/coins/bitcoin/price", key, http.StatusTooManyRequests, "rate_limited"},
+	} {
+		rec := serve(s, http.MethodGet, tc.target, tc.header)
+		if rec.Code != tc.status {
+			t.Errorf("GET %s: status = %d, want %d: %s", tc.target, rec.Code, tc.status, rec.Body)
+			continue
+		}
+
+		var code string
+		if strings.HasPrefix(tc.target, "/v1/") {
+			var problem types.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || rec.Header().Get("Content-Type") != problemContentType {
+				t.Errorf("GET %s: want problem details, got %s %s", tc.target, rec.Header().Get("Content-Type"), rec.Body)
+				continue
+			}
+			if tc.status == http.StatusTooManyRequests && problem.RetryAfter < 1 {
+				t.Errorf("GET %s: retryAfter = %d, want it set", tc.target, problem.RetryAfter)
+			}
+			code = problem.Code
+		} else {
+			var envelope types.Envelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+				t.Errorf("GET %s: want an envelope error, got %s", tc.target, rec.Body)
+				continue
+			}
+			code = envelope.Error.Code
+		}
+		if code != tc.code {
+			t.Errorf("GET %s: code = %q, want %q", tc.target, code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package price_api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	"coinfetcher/types"
+)
+
+// WithRateLimiter throttles requests with limiter. If authentication is enabled, its counters
+// are exposed to admins with the other expvar metrics on "/debug/vars".
+func WithRateLimiter(limiter *rateLimitUtils.Limiter) Option {
+	return func(s *JSONAPIServer) {
+		s.rateLimiter = limiter
+	}
+}
+
+// rateLimit rejects requests that exceed their rate limit with 429 and a Retry-After header,
+// taking their token with allow. It runs twice: with the limiter's AllowClient before
+// authentication, so floods of bad credentials are throttled too, and with AllowCaller
+// after it, so buckets can be keyed by the caller's API key.
+func (s *JSONAPIServer) rateLimit(allow func(*http.Request, time.Time) rateLimitUtils.Decision, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.rateLimited(w, r, allow) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimited takes a token for r with allow, and writes a 429 response and returns true if
+// there was none.
+func (s *JSONAPIServer) rateLimited(w http.ResponseWriter, r *http.Request, allow func(*http.Request, time.Time) rateLimitUtils.Decision) bool {
+	decision := allow(r, time.Now())
+	if decision.Allowed {
+		return false
+	}
+	// Retry-After has second precision; round up so clients don't retry too early.
+	retryAfter := int((decision.RetryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.writeError(w, r, &types.APIError{
+		Status:  http.StatusTooManyRequests,
+		Code:    "rate_limited",
+		Message: fmt.Sprintf("rate limit %q exceeded, retry in %d seconds", decision.Rule, retryAfter),
+	})
+	return true
+}
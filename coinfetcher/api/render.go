@@ -0,0 +1,447 @@
+package price_api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	coinfetcherv1 "coinfetcher/proto/coinfetcher/v1"
+	"coinfetcher/types"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Names of the response formats, as accepted by the "format" query parameter.
+const (
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatNDJSON   = "ndjson"
+	formatMsgPack  = "msgpack"
+	formatProtobuf = "protobuf"
+)
+
+// errNotEncodable is returned by an encoder that can't represent a value, such as protobuf for search results.
+var errNotEncodable = errors.New("value can't be encoded in this format")
+
+// responseFormat is a representation responses can be rendered in.
+type responseFormat struct {
+	name       string
+	mediaTypes []string // The first one is sent as Content-Type.
+	encode     func(io.Writer, interface{}) error
+}
+
+// responseFormats lists the supported formats in the server's order of preference.
+var responseFormats = []*responseFormat{
+	{name: formatJSON, mediaTypes: []string{"application/json"}, encode: encodeJSON},
+	{name: formatMsgPack, mediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}, encode: encodeMsgPack},
+	{name: formatProtobuf, mediaTypes: []string{"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"}, encode: encodeProtobuf},
+	{name: formatNDJSON, mediaTypes: []string{"application/x-ndjson", "application/ndjson", "application/jsonl"}, encode: encodeNDJSON},
+	{name: formatCSV, mediaTypes: []string{"text/csv"}, encode: encodeCSV},
+}
+
+// notAcceptableError is returned when none of the formats acceptable to the client is supported.
+type notAcceptableError struct {
+	message string
+}
+
+// Error implements the error interface.
+func (e *notAcceptableError) Error() string {
+	return e.message
+}
+
+// acceptedFormats returns the supported formats the client accepts, most preferred first.
+// A "format" query parameter overrides the Accept header; no Accept header means JSON.
+func acceptedFormats(r *http.Request) ([]*responseFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, f := range responseFormats {
+			if f.name == strings.ToLower(name) {
+				return []*responseFormat{f}, nil
+			}
+		}
+		return nil, &notAcceptableError{message: fmt.Sprintf("unsupported format %q, expected one of %s", name, formatNames())}
+	}
+
+	accept := strings.TrimSpace(strings.Join(r.Header.Values("Accept"), ","))
+	if accept == "" {
+		return responseFormats[:1], nil
+	}
+
+	ranges := parseAccept(accept)
+	type ranked struct {
+		format *responseFormat
+		q      float64
+	}
+	var candidates []ranked
+	for _, f := range responseFormats {
+		if q := f.quality(ranges); q > 0 {
+			candidates = append(candidates, ranked{format: f, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &notAcceptableError{message: fmt.Sprintf("none of the accepted media types is supported, expected one of %s", mediaTypeNames())}
+	}
+
+	// Equal qualities keep the server's order of preference.
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	formats := make([]*responseFormat, len(candidates))
+	for i, c := range candidates {
+		formats[i] = c.format
+	}
+	return formats, nil
+}
+
+// mediaRange is one entry of an Accept header.
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header, skipping malformed entries.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// quality returns the quality the client gives to f; the most specific matching range decides.
+func (f *responseFormat) quality(ranges []mediaRange) float64 {
+	best, specificity := 0.0, -1
+	for _, mr := range ranges {
+		for _, mediaType := range f.mediaTypes {
+			s := -1
+			switch {
+			case mr.mediaType == mediaType:
+				s = 2
+			case mr.mediaType == strings.SplitN(mediaType, "/", 2)[0]+"/*":
+				s = 1
+			case mr.mediaType == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				best, specificity = mr.q, s
+			}
+		}
+	}
+	return best
+}
+
+// formatNames lists the values of the "format" query parameter.
+func formatNames() string {
+	names := make([]string, len(responseFormats))
+	for i, f := range responseFormats {
+		names[i] = f.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// mediaTypeNames lists the media types responses can be rendered as.
+func mediaTypeNames() string {
+	names := make([]string, len(responseFormats))
+	for i, f := range responseFormats {
+		names[i] = f.mediaTypes[0]
+	}
+	return strings.Join(names, ", ")
+}
+
+// render writes v with the status code in the format the client prefers among those that can represent v.
+// Error bodies that the accepted formats can't represent fall back to JSON. For any other value
+// nothing is written and a *notAcceptableError is returned, for the caller to answer with 406.
+func (s *JSONAPIServer) render(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) error {
+	return s.renderCached(w, r, statusCode, v, nil)
+}
+
+// renderCached renders v like render. With a policy, the response also carries validators and
+// Cache-Control, and a conditional request whose validators still match is answered with 304.
+func (s *JSONAPIServer) renderCached(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}, policy *cachePolicy) error {
+	formats, err := acceptedFormats(r)
+	if err != nil {
+		if statusCode >= http.StatusBadRequest {
+			return s.writeJSON(w, statusCode, v)
+		}
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, f := range formats {
+		buf.Reset()
+		if err := f.encode(&buf, v); err != nil {
+			if errors.Is(err, errNotEncodable) {
+				continue
+			}
+			return err
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if policy != nil {
+			etag := setCacheHeaders(w.Header(), policy, f)
+			if notModified(r, etag, policy.lastModified) {
+				w.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+		}
+		w.Header().Set("Content-Type", f.mediaTypes[0])
+		w.WriteHeader(statusCode)
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	if statusCode >= http.StatusBadRequest {
+		return s.writeJSON(w, statusCode, v)
+	}
+	return &notAcceptableError{message: fmt.Sprintf("this resource can't be represented in the accepted formats, try one of %s", formatNames())}
+}
+
+// encodeJSON encodes v as a JSON document.
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encodeMsgPack encodes v as MessagePack, with the same keys as the JSON representation.
+func encodeMsgPack(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+// encodeNDJSON encodes the rows of v as newline delimited JSON, one row per line.
+func encodeNDJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	for _, row := range tableRows(v) {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCSV encodes the rows of v as CSV with a header line. Nested objects become
+// dotted columns, lists of plain values are joined with ";" and anything else is
+// written as JSON.
+func encodeCSV(w io.Writer, v interface{}) error {
+	rows := tableRows(v)
+	cw := csv.NewWriter(w)
+
+	var header []string
+	for i, row := range rows {
+		columns, values := flattenRow(reflect.ValueOf(row), "")
+		if i == 0 {
+			header = columns
+			if err := cw.Write(header); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// tableRows returns the rows a value is made of when rendered as a table or line stream:
+// the list of a batch response, the elements of a slice, or else the value itself.
+// v2 envelopes are unwrapped to their data or error.
+func tableRows(v interface{}) []interface{} {
+	switch resp := v.(type) {
+	case *types.Envelope:
+		if resp.Error != nil {
+			return []interface{}{resp.Error}
+		}
+		return tableRows(resp.Data)
+	case *types.SearchResponse:
+		return tableRows(resp.Coins)
+	case *types.TokenPriceResponse:
+		return tableRows(resp.Prices)
+	case *types.TickersResponse:
+		return tableRows(resp.Tickers)
+	case *types.HistoryResponse:
+		return tableRows(resp.Points)
+	case *types.PortfolioValuation:
+		return tableRows(resp.Positions)
+	case types.SearchResponse, types.TokenPriceResponse, types.TickersResponse, types.HistoryResponse, types.PortfolioValuation:
+		return tableRows(pointerTo(resp))
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		rows := make([]interface{}, rv.Len())
+		for i := range rows {
+			rows[i] = rv.Index(i).Interface()
+		}
+		return rows
+	}
+	if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// pointerTo returns a pointer to a copy of v.
+func pointerTo(v interface{}) interface{} {
+	p := reflect.New(reflect.TypeOf(v))
+	p.Elem().Set(reflect.ValueOf(v))
+	return p.Interface()
+}
+
+// flattenRow returns the column names and cell values of a row.
+func flattenRow(v reflect.Value, prefix string) (columns, values []string) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return []string{strings.TrimSuffix(prefix, ".")}, []string{""}
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}):
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			c, vals := flattenRow(v.Field(i), prefix+name+".")
+			columns = append(columns, c...)
+			values = append(values, vals...)
+		}
+		return columns, values
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && prefix == "":
+		// Top-level maps, such as error bodies, get a column per key.
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c, vals := flattenRow(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())), k+".")
+			columns = append(columns, c...)
+			values = append(values, vals...)
+		}
+		return columns, values
+	}
+
+	return []string{strings.TrimSuffix(prefix, ".")}, []string{formatCell(v)}
+}
+
+// formatCell formats a single CSV cell.
+func formatCell(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return strings.Join(v.Interface().([]string), ";")
+		}
+	}
+
+	raw, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// encodeProtobuf encodes v as one of the coinfetcher.v1 protobuf messages shared with the gRPC API.
+// Only prices and health have a protobuf representation.
+func encodeProtobuf(w io.Writer, v interface{}) error {
+	if envelope, ok := v.(*types.Envelope); ok {
+		if envelope.Error != nil {
+			return errNotEncodable
+		}
+		v = envelope.Data
+	}
+
+	var msg proto.Message
+	switch resp := v.(type) {
+	case types.PriceResponse:
+		msg = toProtoPrice(resp)
+	case *types.PriceResponse:
+		msg = toProtoPrice(*resp)
+	case types.HealthResponse:
+		msg = toProtoHealth(resp)
+	case *types.HealthResponse:
+		msg = toProtoHealth(*resp)
+	case []types.PriceResponse:
+		msg = &coinfetcherv1.GetPricesResponse{Prices: toProtoPrices(resp)}
+	case *types.TokenPriceResponse:
+		msg = &coinfetcherv1.GetPricesResponse{Prices: toProtoPrices(resp.Prices), Missing: resp.Missing}
+	default:
+		return errNotEncodable
+	}
+
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// toProtoPrice converts a price to its protobuf message.
+func toProtoPrice(price types.PriceResponse) *coinfetcherv1.Price {
+	return &coinfetcherv1.Price{
+		Ticker:    price.Ticker,
+		Price:     price.Price,
+		Vol_24H:   price.Vol24Hr,
+		Timestamp: timestamppb.New(price.Timestamp),
+	}
+}
+
+// toProtoPrices converts prices to their protobuf messages.
+func toProtoPrices(prices []types.PriceResponse) []*coinfetcherv1.Price {
+	out := make([]*coinfetcherv1.Price, len(prices))
+	for i, price := range prices {
+		out[i] = toProtoPrice(price)
+	}
+	return out
+}
+
+// toProtoHealth converts a health report to its protobuf message.
+func toProtoHealth(health types.HealthResponse) *coinfetcherv1.CheckHealthResponse {
+	return &coinfetcherv1.CheckHealthResponse{
+		Status:         health.Status,
+		GeckoApiStatus: health.GeckoApiStatus,
+		Timestamp:      timestamppb.New(health.Timestamp),
+	}
+}
@@ -0,0 +1,140 @@
+package price_api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeParamsKey is the context key under which the router stores path parameters.
+type routeParamsKey struct{}
+
+// route is a path pattern together with the handler registered for each HTTP method.
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+// router is a small path router supporting "{param}" segments and per-method handlers.
+// Requests for a known path with an unregistered method are answered with 405 and an Allow header.
+type router struct {
+	routes           []*route
+	notFound         http.HandlerFunc // Called when no pattern matches the path.
+	methodNotAllowed http.HandlerFunc // Called after the Allow header has been set.
+}
+
+// newRouter creates an empty router that answers unmatched requests with the given handlers.
+func newRouter(notFound, methodNotAllowed http.HandlerFunc) *router {
+	return &router{
+		notFound:         notFound,
+		methodNotAllowed: methodNotAllowed,
+	}
+}
+
+// handle registers h for method on pattern, for example "/v2/coins/{id}/price".
+func (rt *router) handle(method, pattern string, h http.Handler) {
+	segments := splitPath(pattern)
+	for _, existing := range rt.routes {
+		if equalSegments(existing.segments, segments) {
+			existing.handlers[method] = h
+			return
+		}
+	}
+	rt.routes = append(rt.routes, &route{
+		segments: segments,
+		handlers: map[string]http.Handler{method: h},
+	})
+}
+
+// ServeHTTP dispatches the request to the handler registered for its path and method.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.Path)
+
+	for _, rte := range rt.routes {
+		params, ok := matchSegments(rte.segments, path)
+		if !ok {
+			continue
+		}
+
+		h, ok := rte.handlers[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			h, ok = rte.handlers[http.MethodGet] // net/http drops the body of HEAD responses for us.
+		}
+		if !ok {
+			w.Header().Set("Allow", strings.Join(rte.allowed(), ", "))
+			rt.methodNotAllowed(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), routeParamsKey{}, params)
+		h.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	rt.notFound(w, r)
+}
+
+// allowed returns the sorted list of methods the route accepts.
+func (rte *route) allowed() []string {
+	methods := make([]string, 0, len(rte.handlers)+1)
+	for method := range rte.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rte.handlers[http.MethodGet]; ok {
+		if _, ok := rte.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// routeParam returns the value of the named path parameter of the current request.
+func routeParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(routeParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+// splitPath splits a URL path into its non-empty segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// matchSegments matches a path against a pattern and returns the captured "{param}" values.
+func matchSegments(pattern, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			params[p[1:len(p)-1]] = path[i]
+			continue
+		}
+		if p != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// equalSegments reports whether two patterns are identical.
+func equalSegments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package price_api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"coinfetcher/types"
+)
+
+func TestRouterMatchesPathsAndMethods(t *testing.T) {
+	var got string
+	rt := newRouter(
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusMethodNotAllowed) },
+	)
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = name + " " + routeParam(r, "id")
+		})
+	}
+	rt.handle(http.MethodGet, "/coins/{id}", handler("get"))
+	rt.handle(http.MethodPost, "/coins/{id}", handler("post"))
+	rt.handle(http.MethodGet, "/coins/{id}/price", handler("price"))
+
+	for _, tc := range []struct {
+		method, target string
+		status         int
+		want           string
+		allow          string
+	}{
+		{http.MethodGet, "/coins/bitcoin", http.StatusOK, "get bitcoin", ""},
+		{http.MethodPost, "/coins/bitcoin/", http.StatusOK, "post bitcoin", ""},
+		{http.MethodHead, "/coins/ethereum/price", http.StatusOK, "price ethereum", ""},
+		{http.MethodDelete, "/coins/bitcoin", http.StatusMethodNotAllowed, "", "GET, HEAD, POST"},
+		{http.MethodPost, "/coins/bitcoin/price", http.StatusMethodNotAllowed, "", "GET, HEAD"},
+		{http.MethodGet, "/coins", http.StatusNotFound, "", ""},
+		{http.MethodGet, "/coins/bitcoin/history", http.StatusNotFound, "", ""},
+	} {
+		got = ""
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.status || got != tc.want || rec.Header().Get("Allow") != tc.allow {
+			t.Errorf("%s %s: status = %d, handler = %q, Allow = %q, want %d, %q, %q",
+				tc.method, tc.target, rec.Code, got, rec.Header().Get("Allow"), tc.status, tc.want, tc.allow)
+		}
+	}
+}
+
+func TestUnsupportedMethodsUseTheFormatOfTheAPI(t *testing.T) {
+	s, pricing := newTestServer(nil)
+
+	rec := serve(s, http.MethodPost, "/v2/coins/bitcoin/price", nil)
+	var envelope types.Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("POST /v2/coins/bitcoin/price: want an envelope error, got %s", rec.Body)
+	}
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" || envelope.Error.Code != "method_not_allowed" {
+		t.Errorf("POST /v2/coins/bitcoin/price: status = %d, Allow = %q, code = %q, want 405 allowing GET, HEAD",
+			rec.Code, rec.Header().Get("Allow"), envelope.Error.Code)
+	}
+
+	if pricing.calls != 0 {
+		t.Errorf("pricing service called %d times", pricing.calls)
+	}
+
+	// The alerts API is one of the v1 resources served by a router.
+	rec = serve(newFullServer(t), http.MethodDelete, "/v1/alerts", http.Header{"X-Api-Key": {"test-key"}})
+	var problem types.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || rec.Header().Get("Content-Type") != problemContentType {
+		t.Fatalf("DELETE /v1/alerts: want problem details, got %s", rec.Body)
+	}
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD, POST" || problem.Code != "method_not_allowed" {
+		t.Errorf("DELETE /v1/alerts: status = %d, Allow = %q, code = %q, want 405 allowing GET, HEAD, POST",
+			rec.Code, rec.Header().Get("Allow"), problem.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package price_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerConfig holds the limits of the underlying http.Server and how long shutdown may take.
+type ServerConfig struct {
+	ReadTimeout         time.Duration // Maximum time to read a whole request, body included.
+	ReadHeaderTimeout   time.Duration // Maximum time to read the request headers.
+	WriteTimeout        time.Duration // Maximum time to write a response.
+	IdleTimeout         time.Duration // How long keep-alive connections may sit idle.
+	MaxHeaderBytes      int           // Maximum size of the request headers.
+	ShutdownGracePeriod time.Duration // How long in-flight requests, and then workers, get to finish on shutdown.
+}
+
+// DefaultServerConfig returns the configuration used when none is given.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadTimeout:         10 * time.Second,
+		ReadHeaderTimeout:   5 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         120 * time.Second,
+		MaxHeaderBytes:      1 << 20,
+		ShutdownGracePeriod: 15 * time.Second,
+	}
+}
+
+// WithServerConfig overrides the default server limits and shutdown grace period.
+func WithServerConfig(config ServerConfig) Option {
+	return func(s *JSONAPIServer) {
+		s.config = config
+	}
+}
+
+// worker is a background task, such as a poller, whose lifetime is tied to the server.
+type worker struct {
+	name   string
+	run    func(context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// WithWorker registers a background task that runs while the server is up.
+// run must return once its context is cancelled. Workers are started in
+// registration order and stopped in reverse order after the HTTP server has drained.
+func WithWorker(name string, run func(context.Context)) Option {
+	return func(s *JSONAPIServer) {
+		s.workers = append(s.workers, &worker{name: name, run: run})
+	}
+}
+
+// Run starts the JSON API server and blocks until it fails or receives SIGINT or SIGTERM.
+func (s *JSONAPIServer) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return s.RunContext(ctx)
+}
+
+// RunContext starts the JSON API server and blocks until it fails or ctx is cancelled.
+// On cancellation it stops accepting connections, ends streamed responses, drains in-flight
+// requests and then stops the background workers. Draining and stopping the workers each
+// get the configured grace period.
+func (s *JSONAPIServer) RunContext(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.listenAddr,
+		Handler:           s.Handler(),
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+	// Streams only end when their client leaves, and Shutdown neither cancels request contexts
+	// nor waits for hijacked WebSocket connections, so they are told to end when it starts.
+	srv.RegisterOnShutdown(s.stopStreams)
+
+	s.startWorkers()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server never came up (for example the address is in use), so just stop the workers.
+		stopCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownGracePeriod)
+		defer cancel()
+		s.stopWorkers(stopCtx)
+		return fmt.Errorf("server failed: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownGracePeriod)
+	defer cancel()
+
+	// Stop accepting new connections and wait for in-flight requests to complete.
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		shutdownErr = err
+	}
+
+	// Workers go last so requests being drained can still rely on them. They get a budget of
+	// their own, as draining may have used up the grace period.
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), s.config.ShutdownGracePeriod)
+	defer cancelStop()
+	if err := s.stopWorkers(stopCtx); err != nil && shutdownErr == nil {
+		shutdownErr = err
+	}
+
+	if shutdownErr != nil {
+		return fmt.Errorf("graceful shutdown failed: %v", shutdownErr)
+	}
+	return nil
+}
+
+// startWorkers launches every registered worker with its own cancellable context.
+func (s *JSONAPIServer) startWorkers() {
+	for _, w := range s.workers {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.cancel = cancel
+		w.done = make(chan struct{})
+
+		go func(w *worker) {
+			defer close(w.done)
+			w.run(ctx)
+		}(w)
+	}
+}
+
+// stopWorkers stops the workers one by one in reverse start order, waiting for each to return.
+func (s *JSONAPIServer) stopWorkers(ctx context.Context) error {
+	for i := len(s.workers) - 1; i >= 0; i-- {
+		w := s.workers[i]
+		if w.cancel == nil {
+			continue // Never started.
+		}
+		w.cancel()
+
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return fmt.Errorf("worker %q did not stop in time", w.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package price_api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	pollerService "coinfetcher/services/poller"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestShutdownEndsOpenStreams(t *testing.T) {
+	pricing := &stubPricing{price: 64000, timestamp: time.Now().UTC()}
+	poller := pollerService.NewPoller(pricing, time.Hour)
+	broker := pollerService.NewEventBroker(poller, 0.1, 100)
+	config := DefaultServerConfig()
+	config.ShutdownGracePeriod = 10 * time.Second
+
+	addr := freeAddr(t)
+	s := NewJSONAPIServer(addr, pricing, stubHealth{},
+		WithServerConfig(config),
+		WithWorker("price-poller", poller.Run),
+		WithWorker("price-events", broker.Run),
+		WithPriceStream(poller, 10),
+		WithPriceEvents(broker, time.Minute),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.RunContext(ctx) }()
+
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, err = http.Get("http://" + addr + "/v1/price/events?tickers=bitcoin"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatalf("stream didn't start: %v", err)
+	}
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunContext = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("shutdown took %s with an open stream", elapsed)
+		}
+	case <-time.After(config.ShutdownGracePeriod):
+		t.Fatal("shutdown waited for the open stream")
+	}
+}
@@ -0,0 +1,208 @@
+package price_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	pollerService "coinfetcher/services/poller"
+	"coinfetcher/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket timing and size limits for "/v1/stream".
+const (
+	streamWriteWait      = 10 * time.Second   // A client that can't take a message within this time is dropped.
+	streamPongWait       = 60 * time.Second   // A client must answer pings within this time.
+	streamPingPeriod     = streamPongWait / 2 // How often the server pings the client.
+	streamMaxMessageSize = 4096               // Largest message accepted from the client.
+	streamOutboundBuffer = 16                 // Replies queued between the reader and the writer.
+)
+
+// Message types exchanged on "/v1/stream".
+const (
+	streamActionSubscribe   = "subscribe"
+	streamActionUnsubscribe = "unsubscribe"
+
+	streamTypeSnapshot     = "snapshot"
+	streamTypeUnsubscribed = "unsubscribed"
+	streamTypeUpdate       = "update"
+	streamTypeError        = "error"
+)
+
+// streamUpgrader upgrades "/v1/stream" requests to WebSocket connections.
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The API uses no cookies, so cross-origin connections carry no ambient credentials.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// WithPriceStream enables the "/v1/stream" WebSocket endpoint fed by the given poller.
+// maxSubscriptions caps the number of tickers a single connection may watch.
+func WithPriceStream(poller *pollerService.Poller, maxSubscriptions int) Option {
+	return func(s *JSONAPIServer) {
+		s.poller = poller
+		s.maxStreamSubscriptions = maxSubscriptions
+	}
+}
+
+// handleStream handles the "WebSocket price stream" endpoint.
+// Clients send {"action":"subscribe","tickers":[...]} or "unsubscribe" messages and
+// receive a snapshot of the known prices on subscribe followed by pushed updates.
+// Updates are coalesced per ticker, so a slow client only ever receives the latest
+// price of each ticker, and a client that stops reading is disconnected.
+func (s *JSONAPIServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has already replied with an HTTP error.
+	}
+	defer conn.Close()
+
+	sub := s.poller.Subscribe()
+	defer sub.Close()
+
+	outbound := make(chan types.StreamMessage, streamOutboundBuffer)
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	defer close(writerDone)
+
+	go func() {
+		defer close(readerDone)
+		s.readStream(conn, sub, outbound, writerDone)
+	}()
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg *types.StreamMessage
+		select {
+		case <-readerDone:
+			return
+		case <-s.streams.Done():
+			// The server is shutting down; it doesn't track hijacked connections itself.
+			closeGoingAway(conn)
+			return
+		case <-sub.Done():
+			// The poller stopped because the server is shutting down.
+			closeGoingAway(conn)
+			return
+		case m := <-outbound:
+			msg = &m
+		case <-sub.Ready():
+			prices := sub.Drain()
+			if len(prices) == 0 {
+				continue
+			}
+			msg = &types.StreamMessage{Type: streamTypeUpdate, Prices: prices}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// closeGoingAway tells the client the server is shutting down.
+func closeGoingAway(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+		time.Now().Add(streamWriteWait))
+}
+
+// readStream reads subscription requests from the client until the connection fails.
+func (s *JSONAPIServer) readStream(conn *websocket.Conn, sub *pollerService.Subscription, outbound chan<- types.StreamMessage, writerDone <-chan struct{}) {
+	conn.SetReadLimit(streamMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return // The connection is gone.
+		}
+
+		var req types.StreamRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			req = types.StreamRequest{} // Malformed JSON is answered like an unknown action.
+		}
+
+		reply := s.handleStreamRequest(sub, req)
+		select {
+		case outbound <- reply:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// handleStreamRequest applies one client request to the subscription and returns the reply.
+func (s *JSONAPIServer) handleStreamRequest(sub *pollerService.Subscription, req types.StreamRequest) types.StreamMessage {
+	tickers := normalizeTickers(req.Tickers)
+
+	switch req.Action {
+	case streamActionSubscribe:
+		if len(tickers) == 0 {
+			return types.StreamMessage{Type: streamTypeError, Error: "no tickers given"}
+		}
+		if n := countNew(sub.Tickers(), tickers); len(sub.Tickers())+n > s.maxStreamSubscriptions {
+			return types.StreamMessage{
+				Type:    streamTypeError,
+				Tickers: sub.Tickers(),
+				Error:   fmt.Sprintf("at most %d tickers can be watched per connection", s.maxStreamSubscriptions),
+			}
+		}
+		snapshot := sub.Watch(tickers...)
+		return types.StreamMessage{Type: streamTypeSnapshot, Tickers: sub.Tickers(), Prices: snapshot}
+
+	case streamActionUnsubscribe:
+		sub.Unwatch(tickers...)
+		return types.StreamMessage{Type: streamTypeUnsubscribed, Tickers: sub.Tickers()}
+	}
+
+	return types.StreamMessage{
+		Type:  streamTypeError,
+		Error: fmt.Sprintf("unknown action %q, expected %q or %q", req.Action, streamActionSubscribe, streamActionUnsubscribe),
+	}
+}
+
+// normalizeTickers lowercases, trims and de-duplicates tickers.
+func normalizeTickers(tickers []string) []string {
+	seen := make(map[string]bool, len(tickers))
+	out := make([]string, 0, len(tickers))
+	for _, ticker := range tickers {
+		ticker = strings.ToLower(strings.TrimSpace(ticker))
+		if ticker != "" && !seen[ticker] {
+			seen[ticker] = true
+			out = append(out, ticker)
+		}
+	}
+	return out
+}
+
+// countNew returns how many of tickers are not in current.
+func countNew(current, tickers []string) int {
+	have := make(map[string]bool, len(current))
+	for _, ticker := range current {
+		have[ticker] = true
+	}
+	n := 0
+	for _, ticker := range tickers {
+		if !have[ticker] {
+			n++
+		}
+	}
+	return n
+}
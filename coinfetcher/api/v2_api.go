@@ -0,0 +1,170 @@
+package price_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	historyService "coinfetcher/services/history"
+	requestUtils "coinfetcher/services/request"
+	"coinfetcher/types"
+)
+
+// apiVersion2 is reported in the meta block of every v2 response.
+const apiVersion2 = "v2"
+
+// defaultHistoryDays is the history window used when "days" isn't given.
+const defaultHistoryDays = 30
+
+// v2Func is a v2 endpoint. It returns the value placed under "data" in the response envelope.
+type v2Func func(context.Context, *http.Request) (interface{}, error)
+
+// statusError is an error carrying the HTTP status and machine readable code it should be reported with.
+type statusError struct {
+	status  int
+	code    string
+	message string
+}
+
+// Error implements the error interface.
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// badRequest creates a 400 error for invalid client input.
+func badRequest(format string, args ...interface{}) error {
+	return &statusError{status: http.StatusBadRequest, code: "bad_request", message: fmt.Sprintf(format, args...)}
+}
+
+// newV2Router creates the router serving the v2 API surface.
+func (s *JSONAPIServer) newV2Router() *router {
+	rt := s.newEnvelopeRouter()
+
+	rt.handle(http.MethodGet, "/v2/health", s.makeV2Handler(s.handleV2Health))
+	rt.handle(http.MethodGet, "/v2/coins/{id}/price", s.makeV2Handler(s.handleV2Price))
+	if s.historyService != nil {
+		rt.handle(http.MethodGet, "/v2/coins/{id}/history", s.makeV2Handler(s.handleV2History))
+	}
+
+	return rt
+}
+
+// newEnvelopeRouter creates an empty router answering unknown paths and methods in the response envelope.
+func (s *JSONAPIServer) newEnvelopeRouter() *router {
+	return newRouter(
+		func(w http.ResponseWriter, r *http.Request) {
+			s.writeEnvelope(w, r, http.StatusNotFound, nil, &types.APIError{
+				Status: http.StatusNotFound, Code: "not_found", Message: "no such resource",
+			})
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			s.writeEnvelope(w, r, http.StatusMethodNotAllowed, nil, &types.APIError{
+				Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: r.Method + " is not allowed on this resource",
+			})
+		},
+	)
+}
+
+// makeV2Handler wraps a v2 endpoint so its result or error is always written in the response envelope.
+func (s *JSONAPIServer) makeV2Handler(fn v2Func) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Refuse unsupported formats before any upstream work is done.
+		if _, err := acceptedFormats(r); err != nil {
+			s.writeEnvelope(w, r, http.StatusNotAcceptable, nil, &types.APIError{
+				Status: http.StatusNotAcceptable, Code: "not_acceptable", Message: err.Error(),
+			})
+			return
+		}
+
+		data, err := fn(r.Context(), r)
+		if err != nil {
+			problem := problemFor(r, err)
+			logProblem(r, problem, err)
+			if problem.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(problem.RetryAfter))
+			}
+			s.writeEnvelope(w, r, problem.Status, nil, &types.APIError{Status: problem.Status, Code: problem.Code, Message: problem.Detail})
+			return
+		}
+		s.writeEnvelope(w, r, http.StatusOK, data, nil)
+	})
+}
+
+// writeEnvelope writes data or apiErr wrapped in the v2 response envelope.
+// Data returned as cacheable is sent with its cache policy.
+func (s *JSONAPIServer) writeEnvelope(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}, apiErr *types.APIError) {
+	var policy *cachePolicy
+	if c, ok := data.(cacheable); ok {
+		data, policy = c.data, &c.policy
+	}
+
+	envelope := types.Envelope{
+		Data: data,
+		Meta: types.Meta{
+			RequestID: requestUtils.RequestIDFromContext(r.Context()),
+			Version:   apiVersion2,
+			Timestamp: time.Now().UTC(),
+		},
+		Error: apiErr,
+	}
+
+	var notAcceptable *notAcceptableError
+	if err := s.renderCached(w, r, statusCode, &envelope, policy); errors.As(err, &notAcceptable) {
+		envelope.Data = nil
+		envelope.Error = &types.APIError{Status: http.StatusNotAcceptable, Code: "not_acceptable", Message: notAcceptable.message}
+		s.writeJSON(w, http.StatusNotAcceptable, &envelope)
+	}
+}
+
+// handleV2Health handles "GET /v2/health".
+func (s *JSONAPIServer) handleV2Health(ctx context.Context, r *http.Request) (interface{}, error) {
+	health, geckoStatus, timestamp, err := s.statusService.CheckHealth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.HealthResponse{
+		Status:         health,
+		GeckoApiStatus: geckoStatus,
+		Timestamp:      timestamp,
+	}, nil
+}
+
+// handleV2Price handles "GET /v2/coins/{id}/price".
+func (s *JSONAPIServer) handleV2Price(ctx context.Context, r *http.Request) (interface{}, error) {
+	id := routeParam(r, "id")
+
+	price, vol24Hr, timestamp, err := s.pricingService.FetchPrice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	priceResp := types.PriceResponse{
+		Ticker:    id,
+		Price:     price,
+		Timestamp: timestamp,
+		Vol24Hr:   vol24Hr,
+	}
+
+	// The envelope's meta block changes on every response, hence the weak ETag.
+	policy := s.priceCachePolicy(priceResp)
+	policy.weak = true
+	return cacheable{data: priceResp, policy: policy}, nil
+}
+
+// handleV2History handles "GET /v2/coins/{id}/history?days=N".
+func (s *JSONAPIServer) handleV2History(ctx context.Context, r *http.Request) (interface{}, error) {
+	days := defaultHistoryDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > historyService.MaxDays {
+			return nil, badRequest("days must be an integer between 1 and %d", historyService.MaxDays)
+		}
+		days = n
+	}
+
+	return s.historyService.FetchHistory(ctx, routeParam(r, "id"), days)
+}
@@ -0,0 +1,63 @@
+package price_api
+
+import (
+	"fmt"
+	"net/http"
+
+	"coinfetcher/docs"
+	openAPIUtils "coinfetcher/services/openapi"
+	"coinfetcher/types"
+)
+
+// NewRequestValidator compiles the published OpenAPI document into the validator used by
+// WithRequestValidation.
+func NewRequestValidator() (*openAPIUtils.Validator, error) {
+	validator, err := openAPIUtils.NewValidator(docs.Spec())
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	return validator, nil
+}
+
+// WithRequestValidation checks the parameters and bodies of requests against the published
+// OpenAPI document, as compiled by NewRequestValidator, before they reach a handler. Invalid
+// requests are answered with 422 and the offending fields, without calling any service.
+func WithRequestValidation(validator *openAPIUtils.Validator) Option {
+	return func(s *JSONAPIServer) {
+		s.validator = validator
+	}
+}
+
+// validateRequest is the middleware enforcing WithRequestValidation.
+func (s *JSONAPIServer) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fields := s.validator.ValidateRequest(r); len(fields) > 0 {
+			s.writeError(w, r, &types.APIError{
+				Status:  http.StatusUnprocessableEntity,
+				Code:    "invalid_request",
+				Message: validationMessage(fields),
+				Fields:  fields,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validationMessage summarises fields in a sentence, like "query parameter ticker is required".
+func validationMessage(fields []types.FieldError) string {
+	first := fields[0]
+	var what string
+	switch {
+	case first.In == openAPIUtils.InBody && first.Field == "":
+		what = "request body"
+	case first.In == openAPIUtils.InBody:
+		what = "body field " + first.Field
+	default:
+		what = first.In + " parameter " + first.Field
+	}
+	if len(fields) > 1 {
+		return fmt.Sprintf("%s %s (and %d more)", what, first.Message, len(fields)-1)
+	}
+	return what + " " + first.Message
+}
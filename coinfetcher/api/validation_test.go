@@ -0,0 +1,101 @@
+package price_api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"coinfetcher/types"
+)
+
+func TestRequestValidatorCompilesTheDocument(t *testing.T) {
+	if _, err := NewRequestValidator(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newValidatingServer creates a test server validating its requests.
+func newValidatingServer(t *testing.T) (*JSONAPIServer, *stubPricing) {
+	t.Helper()
+	validator, err := NewRequestValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(nil, WithRequestValidation(validator))
+}
+
+func TestInvalidRequestsAreRejectedBeforeTheService(t *testing.T) {
+	s, pricing := newValidatingServer(t)
+	for _, tc := range []struct {
+		target string
+		field  string
+	}{
+		{"/v1/price", "ticker"},
+		{"/v1/price?ticker=" + url.QueryEscape("bit coin!"), "ticker"},
+		{"/v1/price?ticker=" + strings.Repeat("a", 101), "ticker"},
+		{"/v2/coins/" + url.PathEscape("bit coin!") + "/price", "id"},
+	} {
+		rec := serve(s, http.MethodGet, tc.target, nil)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET %s: status = %d, want 422: %s", tc.target, rec.Code, rec.Body)
+			continue
+		}
+
+		// v1 reports errors as problem details, v2 in its envelope.
+		var fields []types.FieldError
+		if strings.HasPrefix(tc.target, "/v1/") {
+			var problem types.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || rec.Header().Get("Content-Type") != problemContentType {
+				t.Fatalf("GET %s: no problem details in %s", tc.target, rec.Body)
+			}
+			if problem.Code != "invalid_request" {
+				t.Errorf("GET %s: code = %q, want invalid_request", tc.target, problem.Code)
+			}
+			fields = problem.Fields
+		} else {
+			var envelope struct {
+				Error *types.APIError `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+				t.Fatalf("GET %s: no envelope error in %s", tc.target, rec.Body)
+			}
+			if envelope.Error.Code != "invalid_request" {
+				t.Errorf("GET %s: code = %q, want invalid_request", tc.target, envelope.Error.Code)
+			}
+			fields = envelope.Error.Fields
+		}
+		if len(fields) == 0 || fields[0].Field != tc.field {
+			t.Errorf("GET %s: fields = %+v, want an error about %s", tc.target, fields, tc.field)
+		}
+	}
+	if pricing.calls != 0 {
+		t.Errorf("pricing service called %d times for invalid requests", pricing.calls)
+	}
+}
+
+func TestResponsesMatchTheDocument(t *testing.T) {
+	s, _ := newValidatingServer(t)
+	for _, tc := range []struct {
+		target string
+		path   string // Path the operation is documented under.
+		status int
+	}{
+		{"/v1/price?ticker=bitcoin", "/v1/price", http.StatusOK},
+		{"/v1/health", "/v1/health", http.StatusOK},
+		{"/v1/price", "/v1/price", http.StatusUnprocessableEntity},
+		{"/v2/coins/bitcoin/price", "/v2/coins/bitcoin/price", http.StatusOK},
+		{"/v2/health", "/v2/health", http.StatusOK},
+		{"/v2/coins/bit%20coin/price", "/v2/coins/bit%20coin/price", http.StatusUnprocessableEntity},
+	} {
+		rec := serve(s, http.MethodGet, tc.target, nil)
+		if rec.Code != tc.status {
+			t.Errorf("GET %s: status = %d, want %d: %s", tc.target, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if fields := s.validator.ValidateResponse(http.MethodGet, tc.path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()); len(fields) > 0 {
+			t.Errorf("GET %s: response doesn't match the document: %+v\n%s", tc.target, fields, rec.Body)
+		}
+	}
+}
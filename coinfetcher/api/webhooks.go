@@ -0,0 +1,128 @@
+package price_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	webhookUtils "coinfetcher/services/webhook"
+)
+
+// maxWebhookBodyBytes caps the size of webhook endpoint request bodies.
+const maxWebhookBodyBytes = 4 << 10
+
+// WithWebhooks enables the "/v1/webhooks" API to register the endpoints dispatcher sends
+// signed deliveries to, and to inspect and resend those deliveries.
+// Callers manage their own endpoints; admins see everyone's. It is only served with authentication.
+func WithWebhooks(dispatcher *webhookUtils.Dispatcher) Option {
+	return func(s *JSONAPIServer) {
+		s.webhooks = dispatcher
+	}
+}
+
+// webhookEndpointInput is the body of "POST /v1/webhooks".
+type webhookEndpointInput struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+// newWebhooksRouter creates the router of the "/v1/webhooks" API.
+func (s *JSONAPIServer) newWebhooksRouter() *router {
+	rt := s.newProblemRouter()
+	rt.handle(http.MethodGet, "/v1/webhooks", s.makeHTTPHandlerFunc(s.handleListWebhooks))
+	rt.handle(http.MethodPost, "/v1/webhooks", s.makeHTTPHandlerFunc(s.handleCreateWebhook))
+	rt.handle(http.MethodGet, "/v1/webhooks/{id}", s.makeHTTPHandlerFunc(s.handleGetWebhook))
+	rt.handle(http.MethodDelete, "/v1/webhooks/{id}", s.makeHTTPHandlerFunc(s.handleDeleteWebhook))
+	rt.handle(http.MethodGet, "/v1/webhooks/{id}/deliveries", s.makeHTTPHandlerFunc(s.handleWebhookDeliveries))
+	rt.handle(http.MethodPost, "/v1/webhooks/{id}/deliveries/{delivery}/resend", s.makeHTTPHandlerFunc(s.handleResendWebhook))
+	return rt
+}
+
+// webhookError maps the errors of the dispatcher onto the statuses they are reported with.
+func webhookError(err error, id string) error {
+	switch {
+	case errors.Is(err, webhookUtils.ErrEndpointNotFound):
+		return notFound("webhook endpoint", id)
+	case errors.Is(err, webhookUtils.ErrDeliveryNotFound):
+		return notFound("webhook delivery", id)
+	case errors.Is(err, webhookUtils.ErrInvalidEndpoint):
+		return badRequest("%v", err)
+	case errors.Is(err, webhookUtils.ErrEndpointInUse):
+		return &statusError{status: http.StatusConflict, code: "conflict", message: "webhook endpoint " + id + " is used by alert rules; delete or update them first"}
+	case errors.Is(err, webhookUtils.ErrQueueFull):
+		return &statusError{status: http.StatusServiceUnavailable, code: "not_ready", message: "too many webhook deliveries are queued"}
+	}
+	return err
+}
+
+// handleListWebhooks handles "GET /v1/webhooks".
+func (s *JSONAPIServer) handleListWebhooks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	owner, all := s.resourceOwner(ctx)
+	return s.render(w, r, http.StatusOK, s.webhooks.Endpoints(owner, all))
+}
+
+// handleCreateWebhook handles "POST /v1/webhooks". The response is the only place the
+// endpoint's signing secret is shown.
+func (s *JSONAPIServer) handleCreateWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var input webhookEndpointInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes)).Decode(&input); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	owner, _ := s.resourceOwner(ctx)
+	endpoint, err := s.webhooks.CreateEndpoint(owner, input.URL, input.Description)
+	if err != nil {
+		return webhookError(err, "")
+	}
+	w.Header().Set("Location", "/v1/webhooks/"+endpoint.ID)
+	return s.render(w, r, http.StatusCreated, endpoint)
+}
+
+// handleGetWebhook handles "GET /v1/webhooks/{id}".
+func (s *JSONAPIServer) handleGetWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	owner, all := s.resourceOwner(ctx)
+	endpoint, err := s.webhooks.Endpoint(id, owner, all)
+	if err != nil {
+		return webhookError(err, id)
+	}
+	return s.render(w, r, http.StatusOK, endpoint)
+}
+
+// handleDeleteWebhook handles "DELETE /v1/webhooks/{id}".
+func (s *JSONAPIServer) handleDeleteWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	owner, all := s.resourceOwner(ctx)
+	if err := s.webhooks.DeleteEndpoint(id, owner, all); err != nil {
+		return webhookError(err, id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleWebhookDeliveries handles "GET /v1/webhooks/{id}/deliveries", listing the most
+// recent deliveries to the endpoint with every attempt made.
+func (s *JSONAPIServer) handleWebhookDeliveries(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := routeParam(r, "id")
+	owner, all := s.resourceOwner(ctx)
+	deliveries, err := s.webhooks.Deliveries(id, owner, all)
+	if err != nil {
+		return webhookError(err, id)
+	}
+	return s.render(w, r, http.StatusOK, deliveries)
+}
+
+// handleResendWebhook handles "POST /v1/webhooks/{id}/deliveries/{delivery}/resend", queueing
+// the payload of a logged delivery again as a new delivery.
+func (s *JSONAPIServer) handleResendWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, deliveryID := routeParam(r, "id"), routeParam(r, "delivery")
+	owner, all := s.resourceOwner(ctx)
+	delivery, err := s.webhooks.Resend(id, deliveryID, owner, all)
+	if errors.Is(err, webhookUtils.ErrDeliveryNotFound) {
+		return webhookError(err, deliveryID)
+	}
+	if err != nil {
+		return webhookError(err, id)
+	}
+	return s.render(w, r, http.StatusAccepted, delivery)
+}
@@ -0,0 +1,30 @@
+package price_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAlertsAndWebhooksNegotiateTheFormat(t *testing.T) {
+	s := newFullServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"url": "https://example.com/hook"}`))
+	req.Header.Set("X-Api-Key", "test-key")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/msgpack")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != "application/msgpack" {
+		t.Errorf("POST /v1/webhooks: status = %d, Content-Type = %q, want 201 as MessagePack", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	key := http.Header{"X-Api-Key": {"test-key"}}
+	for _, target := range []string{"/v1/webhooks?format=ndjson", "/v1/alerts?format=ndjson"} {
+		rec := serve(s, http.MethodGet, target, key)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("GET %s: status = %d, Content-Type = %q, want 200 as NDJSON", target, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -2,60 +2,325 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 
+	requestUtils "coinfetcher/services/request"
 	"coinfetcher/types"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Format is a media type the client can ask the service to respond with.
+type Format string
+
+// Formats the client can decode.
+const (
+	FormatJSON    Format = "application/json"
+	FormatMsgPack Format = "application/msgpack" // Compact binary encoding with the same fields as JSON.
 )
 
 // Client represents a client for fetching cryptocurrency prices.
 type Client struct {
 	endpoint string // The endpoint URL for the price service.
+	baseURL  string // The root URL of the service, derived from the endpoint.
+	format   Format // The format responses are requested in.
+	apiKey   string // Sent in the X-API-Key header, if set.
+	token    string // Sent as a bearer token in the Authorization header, if set.
+
+	mu        sync.Mutex
+	validated map[string]validatedResponse // Responses with validators, by format and URL.
+}
+
+// maxValidatedResponses bounds the number of responses the client keeps for revalidation.
+const maxValidatedResponses = 256
+
+// validatedResponse is a response kept to be replayed when the service answers 304 Not Modified.
+type validatedResponse struct {
+	etag         string
+	lastModified string
+	contentType  string
+	body         []byte
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithFormat makes the client request responses in the given format instead of JSON.
+func WithFormat(format Format) Option {
+	return func(c *Client) {
+		c.format = format
+	}
+}
+
+// WithAPIKey makes the client authenticate with the given API key, on HTTP requests and streams alike.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken makes the client authenticate with the given JWT bearer token, on HTTP
+// requests and streams alike. The service checks it instead of an API key if both are set.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
 }
 
 // New creates a new instance of the Client with the specified endpoint.
-func New(endpoint string) *Client {
-	return &Client{
-		endpoint: endpoint,
+// The endpoint may be either the service root ("http://host:9899") or its "/v1/price" URL.
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint:  endpoint,
+		baseURL:   strings.TrimSuffix(strings.TrimRight(endpoint, "/"), "/v1/price"),
+		format:    FormatJSON,
+		validated: make(map[string]validatedResponse),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // FetchPrice fetches cryptocurrency price information for the given ticker.
 func (c *Client) FetchPrice(ctx context.Context, ticker string) (*types.PriceResponse, error) {
-	// Create the full endpoint URL by combining the base endpoint and ticker parameter.
-	endpoint := fmt.Sprintf("%s?ticker=%s", c.endpoint, ticker)
+	// Create a new instance of PriceResponse to hold the decoded JSON response.
+	priceResp := new(types.PriceResponse)
+	if err := c.get(ctx, "/v1/price", url.Values{"ticker": {ticker}}, priceResp); err != nil {
+		return nil, err
+	}
 
-	// Create an HTTP GET request to the endpoint.
-	req, err := http.NewRequest("GET", endpoint, nil)
+	// Return the successfully fetched PriceResponse.
+	return priceResp, nil
+}
+
+// SearchCoins searches the service's coin index for coins matching query.
+func (c *Client) SearchCoins(ctx context.Context, query string) (*types.SearchResponse, error) {
+	searchResp := new(types.SearchResponse)
+	if err := c.get(ctx, "/v1/search", url.Values{"q": {query}}, searchResp); err != nil {
+		return nil, err
+	}
+	return searchResp, nil
+}
+
+// FetchGlobal fetches the global cryptocurrency market overview.
+func (c *Client) FetchGlobal(ctx context.Context) (*types.GlobalMarketResponse, error) {
+	globalResp := new(types.GlobalMarketResponse)
+	if err := c.get(ctx, "/v1/global", nil, globalResp); err != nil {
+		return nil, err
+	}
+	return globalResp, nil
+}
+
+// FetchCoinInfo fetches the metadata (name, logo, links, ...) of the coin with the given id.
+func (c *Client) FetchCoinInfo(ctx context.Context, id string) (*types.CoinInfo, error) {
+	coinInfo := new(types.CoinInfo)
+	if err := c.get(ctx, "/v1/coins/"+url.PathEscape(id), nil, coinInfo); err != nil {
+		return nil, err
+	}
+	return coinInfo, nil
+}
+
+// FetchTickers fetches the per-exchange tickers of the coin with the given id and their cross-venue summary.
+func (c *Client) FetchTickers(ctx context.Context, id string) (*types.TickersResponse, error) {
+	tickersResp := new(types.TickersResponse)
+	if err := c.get(ctx, "/v1/coins/"+url.PathEscape(id)+"/tickers", nil, tickersResp); err != nil {
+		return nil, err
+	}
+	return tickersResp, nil
+}
+
+// FetchTokenPrices fetches the prices of tokens identified by contract address on the given platform.
+func (c *Client) FetchTokenPrices(ctx context.Context, platform string, contracts []string) (*types.TokenPriceResponse, error) {
+	query := url.Values{}
+	query.Set("platform", platform)
+	query.Set("contracts", strings.Join(contracts, ","))
+
+	tokenResp := new(types.TokenPriceResponse)
+	if err := c.get(ctx, "/v1/token_price", query, tokenResp); err != nil {
+		return nil, err
+	}
+	return tokenResp, nil
+}
+
+// FetchHistory fetches the USD price history of the coin with the given id over the last days from the v2 API.
+func (c *Client) FetchHistory(ctx context.Context, id string, days int) (*types.HistoryResponse, error) {
+	historyResp := new(types.HistoryResponse)
+	envelope := types.Envelope{Data: historyResp}
+	query := url.Values{"days": {strconv.Itoa(days)}}
+	if err := c.get(ctx, "/v2/coins/"+url.PathEscape(id)+"/history", query, &envelope); err != nil {
+		return nil, err
+	}
+	return historyResp, nil
+}
+
+// Subscribe opens a WebSocket to "/v1/stream", subscribes to tickers and returns a channel
+// of price updates, starting with the snapshot of the prices the service already knows.
+// The channel is closed when ctx is cancelled or the connection drops; callers that want
+// to keep streaming simply subscribe again and receive a fresh snapshot.
+func (c *Client) Subscribe(ctx context.Context, tickers ...string) (<-chan types.PriceResponse, error) {
+	wsURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/v1/stream"
+
+	header := http.Header{}
+	if id := requestUtils.RequestIDFromContext(ctx); id != "" {
+		header.Set(requestUtils.HeaderName, id)
+	}
+	c.setCredentials(header)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := conn.WriteJSON(types.StreamRequest{Action: "subscribe", Tickers: tickers}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	updates := make(chan types.PriceResponse)
+	go func() {
+		defer close(updates)
+		defer conn.Close()
+
+		// Closing the connection unblocks the reader below once ctx is done.
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-stop:
+			}
+		}()
+
+		for {
+			var msg types.StreamMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			for _, price := range msg.Prices {
+				select {
+				case updates <- price:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+// get sends a GET request for path and decodes the response into out.
+// Validators of earlier responses are sent along, so unchanged resources cost a 304 without a body.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	// Create the full endpoint URL by combining the base URL, path and query parameters.
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	// Create an HTTP GET request to the endpoint.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", string(c.format))
+	// Propagate the caller's request ID, if any, so both sides log the same one.
+	if id := requestUtils.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestUtils.HeaderName, id)
+	}
+	c.setCredentials(req.Header)
+
+	key := string(c.format) + " " + endpoint
+	c.mu.Lock()
+	cached, haveCached := c.validated[key]
+	c.mu.Unlock()
+	if haveCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
 	// Send the HTTP request using the default HTTP client.
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The service confirmed our copy is still current.
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		return decodeBody(cached.contentType, bytes.NewReader(cached.body), out)
 	}
 
-	// Check if the response status code is not OK (200).
+	// Check if the response status code is not OK (200); errors are returned as *Error.
 	if resp.StatusCode != http.StatusOK {
-		// Decode the response body into a map for error information.
-		httpErr := map[string]interface{}{}
-		if err := json.NewDecoder(resp.Body).Decode(&httpErr); err != nil {
-			return nil, err
-		}
-		// Return an error with the service response error message.
-		return nil, fmt.Errorf("service responded with non-OK status code: %s", httpErr["error"])
+		return parseError(resp)
 	}
 
-	// Create a new instance of PriceResponse to hold the decoded JSON response.
-	priceResp := new(types.PriceResponse)
-	if err := json.NewDecoder(resp.Body).Decode(priceResp); err != nil {
-		return nil, err
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return decodeBody(resp.Header.Get("Content-Type"), resp.Body, out)
 	}
 
-	// Return the successfully fetched PriceResponse.
-	return priceResp, nil
+	// Keep the body so a later 304 can be answered from it.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	c.remember(key, validatedResponse{
+		etag:         etag,
+		lastModified: lastModified,
+		contentType:  resp.Header.Get("Content-Type"),
+		body:         body,
+	})
+	return decodeBody(resp.Header.Get("Content-Type"), bytes.NewReader(body), out)
+}
+
+// setCredentials adds the client's credentials, if any, to header.
+func (c *Client) setCredentials(header http.Header) {
+	if c.apiKey != "" {
+		header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// remember stores a response for revalidation, evicting an arbitrary one when the client holds too many.
+func (c *Client) remember(key string, resp validatedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.validated[key]; !ok && len(c.validated) >= maxValidatedResponses {
+		for k := range c.validated {
+			delete(c.validated, k)
+			break
+		}
+	}
+	c.validated[key] = resp
+}
+
+// decodeBody decodes a response body according to its Content-Type.
+// Error responses the service couldn't render in the requested format arrive as JSON.
+func decodeBody(contentType string, body io.Reader, out interface{}) error {
+	if strings.HasPrefix(contentType, string(FormatMsgPack)) {
+		dec := msgpack.NewDecoder(body)
+		dec.SetCustomStructTag("json") // The service encodes MessagePack with the JSON field names.
+		return dec.Decode(out)
+	}
+	return json.NewDecoder(body).Decode(out)
 }
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"coinfetcher/types"
+)
+
+// maxErrorBodyBytes caps how much of an error response is read.
+const maxErrorBodyBytes = 64 << 10
+
+// Error is an error response of the service, as RFC 7807 problem details. Callers can
+// switch on Code, or on Type, which is the same for every instance of a problem.
+//
+//	var apiErr *client.Error
+//	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound { ... }
+type Error struct {
+	types.Problem
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("service responded with %d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Instance != "" {
+		msg += " (request " + e.Instance + ")"
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if retried after RetryAfterDuration.
+func (e *Error) Temporary() bool {
+	return e.Status == http.StatusServiceUnavailable || e.Status == http.StatusTooManyRequests
+}
+
+// RetryAfterDuration returns how long the service asked to wait before retrying, zero if it didn't.
+func (e *Error) RetryAfterDuration() time.Duration {
+	return time.Duration(e.RetryAfter) * time.Second
+}
+
+// parseError reads the error response resp. Besides problem details, it understands the
+// v2 envelope and the plain {"error": "..."} bodies of older services, so callers always
+// get an *Error.
+func parseError(resp *http.Response) error {
+	apiErr := &Error{Problem: types.Problem{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = seconds
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err != nil {
+		return apiErr
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		var problem types.Problem
+		if err := json.Unmarshal(body, &problem); err == nil {
+			if problem.RetryAfter == 0 {
+				problem.RetryAfter = apiErr.RetryAfter
+			}
+			if problem.Status == 0 {
+				problem.Status = resp.StatusCode
+			}
+			apiErr.Problem = problem
+		}
+		return apiErr
+	}
+
+	var legacy struct {
+		Error json.RawMessage `json:"error"`
+		Meta  types.Meta      `json:"meta"`
+	}
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return apiErr
+	}
+	var envelopeErr types.APIError
+	var message string
+	switch {
+	case json.Unmarshal(legacy.Error, &envelopeErr) == nil && envelopeErr.Code != "":
+		apiErr.Code, apiErr.Detail, apiErr.Instance = envelopeErr.Code, envelopeErr.Message, legacy.Meta.RequestID
+	case json.Unmarshal(legacy.Error, &message) == nil:
+		apiErr.Detail = message
+	}
+	return apiErr
+}
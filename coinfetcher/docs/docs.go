@@ -1,115 +1,29 @@
-// Package docs Code generated by swaggo/swag. DO NOT EDIT
+// Package docs holds the OpenAPI 3 description of the API and the pages rendering it,
+// compiled into the binary so they are served the same wherever it runs.
 package docs
 
-import "github.com/swaggo/swag"
+import (
+	"embed"
+	"io/fs"
+)
 
-const docTemplate = `{
-    "schemes": {{ marshal .Schemes }},
-    "swagger": "2.0",
-    "info": {
-        "description": "{{escape .Description}}",
-        "title": "{{.Title}}",
-        "contact": {},
-        "version": "{{.Version}}"
-    },
-    "host": "{{.Host}}",
-    "basePath": "{{.BasePath}}",
-    "paths": {
-        "/v1/health": {
-            "get": {
-                "description": "This gets the Gecko API health status",
-                "produces": [
-                    "application/json"
-                ],
-                "summary": "Get Gecko API health status Endpoint",
-                "operationId": "checkHealth",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/price_api.HealthResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/v1/price": {
-            "get": {
-                "description": "Fetches the price of a given coin ticker.",
-                "produces": [
-                    "application/json"
-                ],
-                "summary": "Fetch coin price Endpoint",
-                "operationId": "fetchPrice",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Coin ticker symbol",
-                        "name": "ticker",
-                        "in": "query",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/price_api.PriceResponse"
-                        }
-                    }
-                }
-            }
-        }
-    },
-    "definitions": {
-        "price_api.HealthResponse": {
-            "type": "object",
-            "properties": {
-                "geckoapistatus": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string"
-                },
-                "timestamp": {
-                    "type": "string"
-                }
-            }
-        },
-        "price_api.PriceResponse": {
-            "type": "object",
-            "properties": {
-                "price": {
-                    "type": "number"
-                },
-                "ticker": {
-                    "type": "string"
-                },
-                "timestamp": {
-                    "type": "string"
-                },
-                "vol24Hr": {
-                    "type": "number"
-                }
-            }
-        }
-    }
-}`
+//go:embed openapi.json swagger
+var assets embed.FS
 
-// SwaggerInfo holds exported Swagger Info so clients can modify it
-var SwaggerInfo = &swag.Spec{
-	Version:          "",
-	Host:             "",
-	BasePath:         "",
-	Schemes:          []string{},
-	Title:            "",
-	Description:      "",
-	InfoInstanceName: "swagger",
-	SwaggerTemplate:  docTemplate,
-	LeftDelim:        "{{",
-	RightDelim:       "}}",
+// Spec returns the OpenAPI 3 document describing the API.
+func Spec() []byte {
+	spec, err := assets.ReadFile("openapi.json")
+	if err != nil {
+		panic(err) // Embedded at build time, so it can't be missing.
+	}
+	return spec
 }
 
-func init() {
-	swag.Register(SwaggerInfo.InstanceName(), SwaggerInfo)
+// Pages returns the documentation pages: swagger.html, redoc.html with the Redoc bundle, and logo.png.
+func Pages() fs.FS {
+	pages, err := fs.Sub(assets, "swagger")
+	if err != nil {
+		panic(err)
+	}
+	return pages
 }
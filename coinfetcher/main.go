@@ -1,45 +1,280 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"net/http"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	// Importing services created for our API
 	coinApi "coinfetcher/api"
+	coinRpc "coinfetcher/rpc"
+	alertService "coinfetcher/services/alert"
+	authUtils "coinfetcher/services/auth"
+	cacheUtils "coinfetcher/services/cache"
+	coinService "coinfetcher/services/coin"
+	exchangeService "coinfetcher/services/exchange"
+	globalService "coinfetcher/services/global"
 	healthService "coinfetcher/services/health"
+	historyService "coinfetcher/services/history"
 	logUtils "coinfetcher/services/log"
 	metricsUtils "coinfetcher/services/metrics"
+	pollerService "coinfetcher/services/poller"
+	portfolioService "coinfetcher/services/portfolio"
 	priceService "coinfetcher/services/price"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	searchService "coinfetcher/services/search"
+	tokenService "coinfetcher/services/token"
+	webhookUtils "coinfetcher/services/webhook"
 )
 
 func main() {
 	// Define a command-line flag to specify the listening address.
 	listenAddr := flag.String("listenaddr", ":9899", "listen address for the service to run")
+	grpcListenAddr := flag.String("grpc-listenaddr", ":9900", "listen address for the gRPC API, empty to disable it")
+	searchRefresh := flag.Duration("search-refresh", 6*time.Hour, "how often the local coin search index is refreshed")
+	searchMarketPages := flag.Int("search-market-pages", 4, "number of 250-coin market pages used to rank search results")
+	priceTTL := flag.Duration("price-ttl", 15*time.Second, "how long quotes are cached, and may be cached by HTTP clients and CDNs")
+	globalTTL := flag.Duration("global-ttl", 5*time.Minute, "how long global market data is cached")
+	dominanceCoins := flag.String("dominance", "btc,eth,usdt,bnb,sol", "comma separated coin symbols broken out in the global dominance breakdown")
+	coinInfoTTL := flag.Duration("coininfo-ttl", 6*time.Hour, "how long coin metadata is cached")
+	coinInfoCacheFile := flag.String("coininfo-cache-file", "", "optional file the coin metadata cache is persisted to across restarts")
+	tokenBatchSize := flag.Int("token-batch-size", 30, "maximum number of contract addresses sent to CoinGecko per token price request")
+	shutdownGrace := flag.Duration("shutdown-grace", 15*time.Second, "how long in-flight requests and background workers get to finish on shutdown")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "maximum duration for reading an entire request")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "maximum duration before timing out writes of a response")
+	idleTimeout := flag.Duration("idle-timeout", 120*time.Second, "how long idle keep-alive connections are kept open")
+	pollInterval := flag.Duration("poll-interval", 10*time.Second, "how often streamed prices are polled from CoinGecko")
+	streamMaxSubscriptions := flag.Int("stream-max-subscriptions", 50, "maximum number of tickers a single stream connection may watch")
+	eventsThreshold := flag.Float64("events-threshold", 0.1, "minimum price change, in percent, that triggers a price event")
+	eventsReplay := flag.Int("events-replay", 1000, "number of price events kept for Last-Event-ID resumption")
+	eventsKeepAlive := flag.Duration("events-keepalive", 15*time.Second, "interval between keep-alive comments on idle event streams, 0 to send none")
+	alertsFile := flag.String("alerts-file", "", "optional file price alert rules are persisted to across restarts; they are kept in memory otherwise")
+	webhooksFile := flag.String("webhooks-file", "", "optional file webhook endpoints and their signing secrets are persisted to across restarts; they are kept in memory otherwise")
+	webhookMaxAttempts := flag.Int("webhook-max-attempts", 6, "attempts made to deliver a webhook before it is dead-lettered")
+	webhookTimeout := flag.Duration("webhook-timeout", 10*time.Second, "time allowed for a single webhook delivery attempt")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private-networks", false, "let webhook endpoints reach loopback, link-local and private addresses")
+	portfolioStaleAfter := flag.Duration("portfolio-stale-after", 10*time.Minute, "age beyond which portfolio valuations report a coin's quote as stale")
+	graphQLMaxDepth := flag.Int("graphql-max-depth", 8, "deepest selection nesting allowed in a GraphQL query")
+	graphQLMaxComplexity := flag.Int("graphql-max-complexity", 500, "highest complexity score allowed for a GraphQL query")
+	apiKeysFile := flag.String("api-keys", "", "optional JSON file of hashed API keys; when set, every route but health checks and docs requires a key")
+	quotaFile := flag.String("quota-file", "", "optional file API key quota usage is persisted to across restarts")
+	jwtJWKS := flag.String("jwt-jwks", "", "optional JWKS file or URL; when set, JWT bearer tokens from the identity provider are accepted")
+	jwtIssuer := flag.String("jwt-issuer", "", "required issuer of bearer tokens")
+	jwtAudience := flag.String("jwt-audience", "", "required audience of bearer tokens")
+	jwtScopeClaim := flag.String("jwt-scope-claim", "scope", "claim holding the scopes or roles of bearer tokens")
+	jwtScopeMap := flag.String("jwt-scope-map", "", "optional comma separated claim value=scope pairs, like \"coins.read=price,coins.read=history\"")
+	jwtLeeway := flag.Duration("jwt-leeway", 30*time.Second, "clock skew tolerated when checking token expiry")
+	jwtRefresh := flag.Duration("jwt-jwks-refresh", time.Hour, "how often the JWKS is reloaded")
+	rateLimitsFile := flag.String("rate-limits", "", "optional JSON file of per-client rate limits, reloaded on SIGHUP")
+	validateRequests := flag.Bool("validate-requests", true, "reject requests whose parameters or body don't match the OpenAPI document with 422")
+	checkOpenAPI := flag.Bool("check-openapi", false, "compare the embedded OpenAPI document with the served routes and types, and exit non-zero if they differ")
+	hashAPIKey := flag.String("hash-api-key", "", "print the hash of the given API key for the key file and exit")
 	flag.Parse()
 
+	if *hashAPIKey != "" {
+		fmt.Println(authUtils.HashKey(*hashAPIKey))
+		return
+	}
+
+	// Tickers panic on non-positive intervals, and would do so in a background worker.
+	if *pollInterval <= 0 {
+		log.Fatalf("-poll-interval must be positive, got %s", *pollInterval)
+	}
+	// The search index would refresh in a busy loop.
+	if *searchRefresh <= 0 {
+		log.Fatalf("-search-refresh must be positive, got %s", *searchRefresh)
+	}
+
 	// Create instances of the price service and health checker.
 	priceFetcher := priceService.NewPriceFetcher()
 	healthChecker := healthService.NewHealthChecker()
 
+	// Build the local coin index used by search; the server keeps it refreshed in the background.
+	coinIndex := searchService.NewCoinIndex(*searchRefresh, *searchMarketPages)
+	coinSearcher := searchService.NewCoinSearcher(coinIndex)
+
+	globalFetcher := globalService.NewGlobalFetcher(strings.Split(*dominanceCoins, ","))
+
+	// Coin metadata rarely changes, so it is cached for hours and optionally persisted to disk.
+	coinInfoFetcher, err := cacheUtils.NewCoinInfoCacheService(coinService.NewCoinInfoFetcher(), *coinInfoTTL, *coinInfoCacheFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokenPriceFetcher := tokenService.NewTokenPriceFetcher(*tokenBatchSize)
+
 	// Create instances of log and metrics services for price and health.
-	coinService := logUtils.NewPriceLogService(metricsUtils.NewPriceMetricService(priceFetcher))
+	coinService := logUtils.NewPriceLogService(metricsUtils.NewPriceMetricService(cacheUtils.NewPriceCacheService(priceFetcher, *priceTTL)))
 	healthService := logUtils.NewHealthLogService(metricsUtils.NewHealthMetricService(healthChecker))
+	searchService := logUtils.NewSearchLogService(metricsUtils.NewSearchMetricService(coinSearcher))
+	coinInfoService := logUtils.NewCoinInfoLogService(metricsUtils.NewCoinInfoMetricService(coinInfoFetcher))
+	tickerService := logUtils.NewTickerLogService(metricsUtils.NewTickerMetricService(exchangeService.NewTickerFetcher()))
+	historyService := logUtils.NewHistoryLogService(metricsUtils.NewHistoryMetricService(historyService.NewHistoryFetcher()))
+	tokenPriceService := logUtils.NewTokenPriceLogService(metricsUtils.NewTokenPriceMetricService(tokenPriceFetcher))
+	quoteService := logUtils.NewQuoteLogService(metricsUtils.NewQuoteMetricService(priceService.NewQuoteFetcher()))
+	portfolioService := logUtils.NewPortfolioLogService(metricsUtils.NewPortfolioMetricService(portfolioService.NewPortfolioValuer(quoteService, *portfolioStaleAfter)))
+	globalService := logUtils.NewGlobalLogService(metricsUtils.NewGlobalMetricService(cacheUtils.NewGlobalCacheService(globalFetcher, *globalTTL)))
 
-	// Create a JSON API server instance with the specified services and listening address.
-	server := coinApi.NewJSONAPIServer(*listenAddr, coinService, healthService)
+	// The poller feeds the streaming endpoints from one shared, batched upstream request per interval.
+	poller := pollerService.NewPoller(coinService, *pollInterval)
+	eventBroker := pollerService.NewEventBroker(poller, *eventsThreshold, *eventsReplay)
+
+	workers := []coinApi.Option{
+		coinApi.WithWorker("coin-index", coinIndex.Run),
+		coinApi.WithWorker("price-poller", poller.Run),
+		coinApi.WithWorker("price-events", eventBroker.Run),
+	}
+
+	// The alert engine evaluates its rules on the poller's quotes, and is stopped before the webhook dispatcher it feeds.
+	webhooks, err := webhookUtils.NewDispatcher(*webhooksFile, webhookUtils.Config{
+		MaxAttempts:          *webhookMaxAttempts,
+		Timeout:              *webhookTimeout,
+		AllowPrivateNetworks: *webhookAllowPrivate,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	alertEngine, err := alertService.NewEngine(*alertsFile, poller, webhooks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	workers = append(workers,
+		coinApi.WithWorker("webhooks", webhooks.Run),
+		coinApi.WithWorker("alerts", alertEngine.Run),
+		coinApi.WithWebhooks(webhooks),
+		coinApi.WithAlerts(alertEngine),
+	)
 
-	// Serve the REDOC Swagger UI HTML.
-	http.Handle("/swagger/redoc.html", http.FileServer(http.Dir("./docs")))
+	// The gRPC API is protected by the same credentials, quotas and rate limits as the JSON API.
+	grpcOptions := []coinRpc.Option{coinRpc.WithPriceStream(poller, *streamMaxSubscriptions)}
 
-	// Serve the Fast API-like Swagger UI.
-	http.Handle("/swagger/swagger.html", http.FileServer(http.Dir("./docs")))
+	// API keys are optional; without a key file the API stays open.
+	if *apiKeysFile != "" {
+		apiKeys, err := authUtils.LoadKeyFile(*apiKeysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		quotas, err := authUtils.NewQuotaTracker(*quotaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcOptions = append(grpcOptions, coinRpc.WithAPIKeys(apiKeys, quotas))
+		workers = append(workers,
+			coinApi.WithAPIKeys(apiKeys, quotas),
+			coinApi.WithWorker("api-quotas", quotas.Run),
+		)
+	}
+
+	// Bearer tokens can be used instead of, or alongside, API keys.
+	if *jwtJWKS != "" {
+		scopeMapping, err := authUtils.ParseScopeMapping(*jwtScopeMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		verifier, err := authUtils.NewJWTVerifier(context.Background(), authUtils.JWTConfig{
+			JWKS:            *jwtJWKS,
+			Issuer:          *jwtIssuer,
+			Audience:        *jwtAudience,
+			ScopeClaim:      *jwtScopeClaim,
+			ScopeMapping:    scopeMapping,
+			Leeway:          *jwtLeeway,
+			RefreshInterval: *jwtRefresh,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcOptions = append(grpcOptions, coinRpc.WithBearerTokens(verifier))
+		workers = append(workers,
+			coinApi.WithBearerTokens(verifier),
+			coinApi.WithWorker("jwks", verifier.Run),
+		)
+	}
+
+	if *rateLimitsFile != "" {
+		limiter, err := rateLimitUtils.LoadLimiter(*rateLimitsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcOptions = append(grpcOptions, coinRpc.WithRateLimiter(limiter))
+		workers = append(workers,
+			coinApi.WithRateLimiter(limiter),
+			coinApi.WithWorker("rate-limits", limiter.Run),
+		)
+	}
+
+	// The gRPC API shares the decorated services and the poller, and is stopped before them on shutdown.
+	var grpcServer *coinRpc.GRPCServer
+	if *grpcListenAddr != "" {
+		grpcServer = coinRpc.NewGRPCServer(*grpcListenAddr, coinService, healthService, grpcOptions...)
+		workers = append(workers, coinApi.WithWorker("grpc", grpcServer.Run))
+	}
+
+	if *validateRequests {
+		validator, err := coinApi.NewRequestValidator()
+		if err != nil {
+			log.Fatal(err)
+		}
+		workers = append(workers, coinApi.WithRequestValidation(validator))
+	}
+
+	// The admin API shows the effective flags; it redacts secrets itself.
+	effectiveConfig := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		effectiveConfig[f.Name] = f.Value.String()
+	})
+	workers = append(workers, coinApi.WithAdmin(coinApi.AdminConfig{
+		Pollers: map[string]coinApi.Pausable{
+			"price-poller": poller,
+			"coin-index":   coinIndex,
+		},
+		Config: effectiveConfig,
+	}))
+
+	serverConfig := coinApi.DefaultServerConfig()
+	serverConfig.ReadTimeout = *readTimeout
+	serverConfig.WriteTimeout = *writeTimeout
+	serverConfig.IdleTimeout = *idleTimeout
+	serverConfig.ShutdownGracePeriod = *shutdownGrace
+
+	// Create a JSON API server instance with the specified services and listening address.
+	server := coinApi.NewJSONAPIServer(*listenAddr, coinService, healthService, append(workers,
+		coinApi.WithServerConfig(serverConfig),
+		coinApi.WithPriceCaching(*priceTTL),
+		coinApi.WithPriceStream(poller, *streamMaxSubscriptions),
+		coinApi.WithPriceEvents(eventBroker, *eventsKeepAlive),
+		coinApi.WithCoinSearcher(searchService),
+		coinApi.WithGlobalFetcher(globalService),
+		coinApi.WithCoinInfoFetcher(coinInfoService),
+		coinApi.WithTokenPriceFetcher(tokenPriceService),
+		coinApi.WithPortfolioValuer(portfolioService),
+		coinApi.WithTickerFetcher(tickerService),
+		coinApi.WithHistoryFetcher(historyService),
+		coinApi.WithGraphQL(quoteService, coinApi.GraphQLLimits{MaxDepth: *graphQLMaxDepth, MaxComplexity: *graphQLMaxComplexity}),
+	)...)
 
-	// Serve the Swagger JSON file as swagger.json.
-	http.Handle("/swagger/swagger.json", http.FileServer(http.Dir("./docs")))
+	// The OpenAPI document, Swagger UI and ReDoc are compiled in and served by the API server itself.
+	if err := server.CheckOpenAPI(); err != nil {
+		if *checkOpenAPI {
+			log.Fatal(err)
+		}
+		log.Printf("Warning: %v", err)
+	} else if *checkOpenAPI {
+		fmt.Println("OpenAPI document matches the served routes")
+		return
+	}
 
-	// Uncomment the line below if you have a Swagger YAML file as swagger.yaml.
-	// http.Handle("/swagger/swagger.yaml", http.FileServer(http.Dir("./docs")))
+	// Nothing listens until the configuration has been checked.
+	if grpcServer != nil {
+		if err := grpcServer.Listen(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	// Start the API server.
-	server.Run()
+	// Start the API server; it returns once it has shut down after SIGINT or SIGTERM.
+	if err := server.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,190 @@
+package price_rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	coinfetcherv1 "coinfetcher/proto/coinfetcher/v1"
+	authUtils "coinfetcher/services/auth"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyMetadata is the metadata key API keys are sent in, like the X-API-Key header.
+const apiKeyMetadata = "x-api-key"
+
+// WithAPIKeys requires an API key with the price scope on every PriceService method except
+// CheckHealth, and charges the calls to the key's quota like HTTP requests. With
+// WithBearerTokens, a bearer token is accepted instead of a key.
+func WithAPIKeys(keys *authUtils.KeyStore, quotas *authUtils.QuotaTracker) Option {
+	return func(s *GRPCServer) {
+		s.apiKeys = keys
+		s.quotas = quotas
+	}
+}
+
+// WithBearerTokens accepts JWT bearer tokens validated by verifier in the "authorization"
+// metadata, alongside API keys if those are enabled too.
+func WithBearerTokens(verifier *authUtils.JWTVerifier) Option {
+	return func(s *GRPCServer) {
+		s.tokenVerifier = verifier
+	}
+}
+
+// WithRateLimiter applies the rate limits of the HTTP API to gRPC calls. Rules are matched
+// against the full method name, such as "/coinfetcher.v1.PriceService/GetPrice".
+func WithRateLimiter(limiter *rateLimitUtils.Limiter) Option {
+	return func(s *GRPCServer) {
+		s.rateLimiter = limiter
+	}
+}
+
+// authEnabled reports whether callers have to authenticate.
+func (s *GRPCServer) authEnabled() bool {
+	return s.apiKeys != nil || s.tokenVerifier != nil
+}
+
+// requiredScope returns the scope needed to call method, or "" for public methods. The
+// health-checking and reflection services are public, like the health and docs routes.
+func requiredScope(method string) string {
+	if method == coinfetcherv1.PriceService_CheckHealth_FullMethodName ||
+		!strings.HasPrefix(method, "/"+coinfetcherv1.PriceService_ServiceDesc.ServiceName+"/") {
+		return ""
+	}
+	return authUtils.ScopePrice
+}
+
+func (s *GRPCServer) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.admit(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *GRPCServer) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.admit(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// admit applies the checks of the HTTP middlewares to a call of method, in the same order:
+// rate limits by client, authentication, rate limits by caller and finally the quota, so
+// rejected calls aren't charged. It returns the context carrying the caller's principal.
+func (s *GRPCServer) admit(ctx context.Context, method string) (context.Context, error) {
+	if s.rateLimiter != nil {
+		allow := s.rateLimiter.Allow
+		if s.authEnabled() {
+			allow = s.rateLimiter.AllowClient
+		}
+		if err := rateLimited(ctx, method, allow); err != nil {
+			return nil, err
+		}
+	}
+
+	scope := requiredScope(method)
+	if !s.authEnabled() || scope == "" {
+		return ctx, nil
+	}
+
+	principal, key, message := s.credentials(ctx)
+	if principal == nil {
+		// Like over HTTP, bad credentials count against the limits of anonymous callers.
+		if s.rateLimiter != nil {
+			if err := rateLimited(ctx, method, s.rateLimiter.AllowCaller); err != nil {
+				return nil, err
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, message)
+	}
+	if !principal.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "credentials lack the %q scope", scope)
+	}
+
+	ctx = authUtils.WithPrincipal(ctx, principal)
+	if s.rateLimiter != nil {
+		if err := rateLimited(ctx, method, s.rateLimiter.AllowCaller); err != nil {
+			return nil, err
+		}
+	}
+
+	// Quotas are attached to API keys; token holders are only subject to rate limits.
+	if key != nil {
+		if _, ok := s.quotas.Allow(key, time.Now()); !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "%s quota of %d requests exhausted", key.Quota.Period, key.Quota.Limit)
+		}
+	}
+	return ctx, nil
+}
+
+// credentials authenticates the caller by bearer token or API key metadata. The key is nil
+// for token holders. If neither is valid, the principal is nil and the message says why.
+func (s *GRPCServer) credentials(ctx context.Context) (*authUtils.Principal, *authUtils.Key, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+		return ""
+	}
+
+	if scheme, token, ok := strings.Cut(first("authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") && s.tokenVerifier != nil {
+		principal, err := s.tokenVerifier.Verify(ctx, strings.TrimSpace(token))
+		if errors.Is(err, authUtils.ErrInvalidToken) {
+			return nil, nil, err.Error()
+		}
+		if err != nil {
+			// The key set couldn't be loaded; that's our problem, not the caller's.
+			log.WithFields(log.Fields{"err": err}).Error("Error verifying bearer token")
+			return nil, nil, "token could not be verified, try again later"
+		}
+		return principal, nil, ""
+	}
+
+	if raw := first(apiKeyMetadata); raw != "" && s.apiKeys != nil {
+		key, ok := s.apiKeys.Lookup(raw)
+		if !ok {
+			return nil, nil, "invalid API key"
+		}
+		return authUtils.NewPrincipal(key.ID, key.Scopes), key, ""
+	}
+
+	var accepted []string
+	if s.tokenVerifier != nil {
+		accepted = append(accepted, "a bearer token in the authorization metadata")
+	}
+	if s.apiKeys != nil {
+		accepted = append(accepted, "an API key in the "+apiKeyMetadata+" metadata")
+	}
+	return nil, nil, strings.Join(accepted, " or ") + " is required"
+}
+
+// rateLimited returns a ResourceExhausted error if allow rejects the call. The limiter works
+// on HTTP requests, so the call is described as one: the method is its path and the peer its
+// remote address.
+func rateLimited(ctx context.Context, method string, allow func(*http.Request, time.Time) rateLimitUtils.Decision) error {
+	r := (&http.Request{Method: http.MethodPost, URL: &url.URL{Path: method}, Header: http.Header{}}).WithContext(ctx)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	decision := allow(r, time.Now())
+	if decision.Allowed {
+		return nil
+	}
+	return status.Error(codes.ResourceExhausted, fmt.Sprintf("rate limit %q exceeded, retry in %.0fs", decision.Rule, math.Ceil(decision.RetryAfter.Seconds())))
+}
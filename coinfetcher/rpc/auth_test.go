@@ -0,0 +1,145 @@
+package price_rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coinfetcherv1 "coinfetcher/proto/coinfetcher/v1"
+	authUtils "coinfetcher/services/auth"
+	pollerService "coinfetcher/services/poller"
+	"coinfetcher/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// stubPricing is a PriceFetcher quoting every coin at 64000.
+type stubPricing struct{}
+
+func (stubPricing) FetchPrice(ctx context.Context, ticker string) (float64, float64, time.Time, error) {
+	return 64000, 1e9, time.Now().UTC(), nil
+}
+
+func (stubPricing) FetchPrices(ctx context.Context, tickers []string) ([]types.PriceResponse, error) {
+	prices := make([]types.PriceResponse, len(tickers))
+	for i, ticker := range tickers {
+		prices[i] = types.PriceResponse{Ticker: ticker, Price: 64000, Timestamp: time.Now().UTC()}
+	}
+	return prices, nil
+}
+
+// stubHealth is a HealthChecker reporting the upstream as up.
+type stubHealth struct{}
+
+func (stubHealth) CheckHealth(ctx context.Context) (string, string, time.Time, error) {
+	return "ok", "(V3) To the Moon!", time.Now().UTC(), nil
+}
+
+// newAuthClient serves a GRPCServer requiring API keys and returns a connection to it. The
+// key "price-key" may make two calls, "history-key" lacks the price scope.
+func newAuthClient(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	keys, err := authUtils.NewKeyStore([]authUtils.Key{
+		{
+			ID:     "price",
+			Hash:   authUtils.HashKey("price-key"),
+			Scopes: []string{authUtils.ScopePrice},
+			Quota:  authUtils.Quota{Limit: 2, Period: authUtils.PeriodDaily},
+		},
+		{ID: "history", Hash: authUtils.HashKey("history-key"), Scopes: []string{authUtils.ScopeHistory}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, err := authUtils.NewQuotaTracker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poller := pollerService.NewPoller(stubPricing{}, time.Hour)
+	s := NewGRPCServer("127.0.0.1:0", stubPricing{}, stubHealth{}, WithPriceStream(poller, 10), WithAPIKeys(keys, quotas))
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	conn, err := grpc.Dial(s.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestCallsNeedCredentialsWithTheirScope(t *testing.T) {
+	conn := newAuthClient(t)
+	client := coinfetcherv1.NewPriceServiceClient(conn)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, key)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"no key", context.Background(), codes.Unauthenticated},
+		{"unknown key", withKey("guessed-key"), codes.Unauthenticated},
+		{"key without the price scope", withKey("history-key"), codes.PermissionDenied},
+		{"valid key", withKey("price-key"), codes.OK},
+	} {
+		_, err := client.GetPrice(tc.ctx, &coinfetcherv1.GetPriceRequest{Ticker: "bitcoin"})
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("GetPrice with %s: code = %s, want %s (%v)", tc.name, code, tc.code, err)
+		}
+	}
+
+	stream, err := client.WatchPrices(context.Background(), &coinfetcherv1.WatchPricesRequest{Tickers: []string{"bitcoin"}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("WatchPrices without a key: code = %s, want %s", code, codes.Unauthenticated)
+	}
+
+	// Health checks stay public.
+	if _, err := client.CheckHealth(context.Background(), &coinfetcherv1.CheckHealthRequest{}); err != nil {
+		t.Errorf("CheckHealth without a key: %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("health check without a key: %v", err)
+	}
+}
+
+func TestCallsAreChargedToTheQuota(t *testing.T) {
+	client := coinfetcherv1.NewPriceServiceClient(newAuthClient(t))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, "price-key")
+
+	// Rejected calls aren't charged.
+	if _, err := client.GetPrice(metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, "history-key"), &coinfetcherv1.GetPriceRequest{Ticker: "bitcoin"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("GetPrice without the scope: %v", err)
+	}
+
+	var codesSeen []codes.Code
+	for i := 0; i < 3; i++ {
+		_, err := client.GetPrices(ctx, &coinfetcherv1.GetPricesRequest{Tickers: []string{"bitcoin"}})
+		codesSeen = append(codesSeen, status.Code(err))
+	}
+	if codesSeen[0] != codes.OK || codesSeen[1] != codes.OK || codesSeen[2] != codes.ResourceExhausted {
+		t.Errorf("codes = %v, want two OKs and ResourceExhausted", codesSeen)
+	}
+}
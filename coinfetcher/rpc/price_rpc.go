@@ -0,0 +1,317 @@
+package price_rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	coinfetcherv1 "coinfetcher/proto/coinfetcher/v1"
+	authUtils "coinfetcher/services/auth"
+	healthService "coinfetcher/services/health"
+	pollerService "coinfetcher/services/poller"
+	priceService "coinfetcher/services/price"
+	rateLimitUtils "coinfetcher/services/ratelimit"
+	requestUtils "coinfetcher/services/request"
+	"coinfetcher/types"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// requestIDKey is the metadata key request IDs are read from and echoed in, like the X-Request-ID header.
+var requestIDKey = strings.ToLower(requestUtils.HeaderName)
+
+// GRPCServer serves the PriceService gRPC API on its own listen address.
+type GRPCServer struct {
+	coinfetcherv1.UnimplementedPriceServiceServer
+
+	listenAddr     string
+	pricingService priceService.PriceFetcher
+	statusService  healthService.HealthChecker
+
+	// Optional, enables WatchPrices.
+	poller           *pollerService.Poller
+	maxSubscriptions int
+
+	// Optional, authenticate callers and charge their API key quotas.
+	apiKeys       *authUtils.KeyStore
+	quotas        *authUtils.QuotaTracker
+	tokenVerifier *authUtils.JWTVerifier
+	rateLimiter   *rateLimitUtils.Limiter
+
+	server   *grpc.Server
+	health   *health.Server
+	listener net.Listener
+	stopping chan struct{} // Closed on shutdown so open streams end and GracefulStop can return.
+}
+
+// Option configures optional features of the GRPCServer.
+type Option func(*GRPCServer)
+
+// WithPriceStream enables WatchPrices fed by the given poller.
+// maxSubscriptions caps the number of tickers a single call may watch.
+func WithPriceStream(poller *pollerService.Poller, maxSubscriptions int) Option {
+	return func(s *GRPCServer) {
+		s.poller = poller
+		s.maxSubscriptions = maxSubscriptions
+	}
+}
+
+// NewGRPCServer creates a gRPC server backed by the given price and health services.
+// Besides PriceService it registers the standard health-checking and reflection services.
+func NewGRPCServer(listenAddr string, pricing priceService.PriceFetcher, status healthService.HealthChecker, opts ...Option) *GRPCServer {
+	s := &GRPCServer{
+		listenAddr:     listenAddr,
+		pricingService: pricing,
+		statusService:  status,
+		health:         health.NewServer(),
+		stopping:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryRequestID, s.unaryAuth),
+		grpc.ChainStreamInterceptor(streamRequestID, s.streamAuth),
+	)
+	coinfetcherv1.RegisterPriceServiceServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+
+	return s
+}
+
+// Listen binds the listen address, so a port that is already in use is reported before anything runs.
+func (s *GRPCServer) Listen() error {
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("gRPC server failed to listen: %v", err)
+	}
+	s.listener = listener
+	return nil
+}
+
+// Run serves gRPC requests until ctx is cancelled, then stops gracefully.
+// It has the signature of a server worker; Listen must have been called first.
+func (s *GRPCServer) Run(ctx context.Context) {
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(coinfetcherv1.PriceService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.server.Serve(s.listener)
+	}()
+
+	select {
+	case <-serveErr:
+		return // The listener failed; there is nothing left to stop.
+	case <-ctx.Done():
+	}
+
+	// Tell health-checking clients to go elsewhere, end the open streams and drain the rest.
+	s.health.Shutdown()
+	close(s.stopping)
+	s.server.GracefulStop()
+}
+
+// GetPrice method of GRPCServer.
+// It returns the latest price of a single ticker.
+func (s *GRPCServer) GetPrice(ctx context.Context, req *coinfetcherv1.GetPriceRequest) (*coinfetcherv1.Price, error) {
+	ticker := strings.ToLower(strings.TrimSpace(req.GetTicker()))
+	if ticker == "" {
+		return nil, status.Error(codes.InvalidArgument, "ticker is required")
+	}
+
+	price, vol24Hr, timestamp, err := s.pricingService.FetchPrice(ctx, ticker)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toPrice(types.PriceResponse{Ticker: ticker, Price: price, Timestamp: timestamp, Vol24Hr: vol24Hr}), nil
+}
+
+// GetPrices method of GRPCServer.
+// It returns the latest prices of several tickers fetched with one upstream request.
+func (s *GRPCServer) GetPrices(ctx context.Context, req *coinfetcherv1.GetPricesRequest) (*coinfetcherv1.GetPricesResponse, error) {
+	tickers := normalizeTickers(req.GetTickers())
+	if len(tickers) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one ticker is required")
+	}
+
+	prices, err := s.pricingService.FetchPrices(ctx, tickers)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	resp := &coinfetcherv1.GetPricesResponse{}
+	found := make(map[string]bool, len(prices))
+	for _, price := range prices {
+		found[price.Ticker] = true
+		resp.Prices = append(resp.Prices, toPrice(price))
+	}
+	for _, ticker := range tickers {
+		if !found[ticker] {
+			resp.Missing = append(resp.Missing, ticker)
+		}
+	}
+	return resp, nil
+}
+
+// CheckHealth method of GRPCServer.
+// It reports whether the CoinGecko API is reachable.
+func (s *GRPCServer) CheckHealth(ctx context.Context, _ *coinfetcherv1.CheckHealthRequest) (*coinfetcherv1.CheckHealthResponse, error) {
+	apiStatus, geckoStatus, timestamp, err := s.statusService.CheckHealth(ctx)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &coinfetcherv1.CheckHealthResponse{
+		Status:         apiStatus,
+		GeckoApiStatus: geckoStatus,
+		Timestamp:      timestamppb.New(timestamp),
+	}, nil
+}
+
+// WatchPrices method of GRPCServer.
+// It sends the known prices of the requested tickers, then every price change
+// picked up by the poller. Changes are coalesced per ticker like on "/v1/stream".
+func (s *GRPCServer) WatchPrices(req *coinfetcherv1.WatchPricesRequest, stream coinfetcherv1.PriceService_WatchPricesServer) error {
+	if s.poller == nil {
+		return status.Error(codes.Unimplemented, "price streaming is not enabled")
+	}
+
+	tickers := normalizeTickers(req.GetTickers())
+	if len(tickers) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one ticker is required")
+	}
+	if s.maxSubscriptions > 0 && len(tickers) > s.maxSubscriptions {
+		return status.Errorf(codes.InvalidArgument, "at most %d tickers can be watched per call", s.maxSubscriptions)
+	}
+
+	sub := s.poller.Subscribe()
+	defer sub.Close()
+
+	send := func(prices []types.PriceResponse) error {
+		for _, price := range prices {
+			if err := stream.Send(toPrice(price)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := send(sub.Watch(tickers...)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.stopping:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-sub.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-sub.Ready():
+			if err := send(sub.Drain()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toPrice converts a price to its protobuf message.
+func toPrice(price types.PriceResponse) *coinfetcherv1.Price {
+	return &coinfetcherv1.Price{
+		Ticker:    price.Ticker,
+		Price:     price.Price,
+		Vol_24H:   price.Vol24Hr,
+		Timestamp: timestamppb.New(price.Timestamp),
+	}
+}
+
+// toStatus maps a service error to a gRPC status, mirroring the status codes of the v2 JSON API.
+// Like the JSON API, failures of the upstream are logged in full, but their details, such as
+// CoinGecko URLs and network errors, are kept from the caller.
+func toStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, priceService.ErrTickerNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	log.WithFields(log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx),
+		"err":       err,
+	}).Error("call failed")
+	return status.Error(codes.Unavailable, "fetching data from CoinGecko failed")
+}
+
+// normalizeTickers lowercases, trims and de-duplicates tickers.
+func normalizeTickers(tickers []string) []string {
+	seen := make(map[string]bool, len(tickers))
+	out := make([]string, 0, len(tickers))
+	for _, ticker := range tickers {
+		ticker = strings.ToLower(strings.TrimSpace(ticker))
+		if ticker != "" && !seen[ticker] {
+			seen[ticker] = true
+			out = append(out, ticker)
+		}
+	}
+	return out
+}
+
+// withRequestID stores the caller's request ID, or a new one, in ctx and echoes it in the response header metadata.
+// Callers set it with the "x-request-id" or "traceparent" metadata keys, just like the HTTP headers.
+func withRequestID(ctx context.Context) context.Context {
+	h := http.Header{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range []string{requestIDKey, "traceparent"} {
+			if values := md.Get(key); len(values) > 0 {
+				h.Set(key, values[0])
+			}
+		}
+	}
+
+	id := requestUtils.FromHeaders(h)
+	if id == "" {
+		id = requestUtils.NewRequestID()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return requestUtils.WithRequestID(ctx, id)
+}
+
+// unaryRequestID gives every unary call a request ID.
+func unaryRequestID(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestID(ctx), req)
+}
+
+// streamRequestID gives every streaming call a request ID.
+func streamRequestID(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overriding context.
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
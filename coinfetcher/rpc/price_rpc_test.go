@@ -0,0 +1,34 @@
+package price_rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	priceService "coinfetcher/services/price"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatusHidesUpstreamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{fmt.Errorf("%w: nocoin", priceService.ErrTickerNotFound), codes.NotFound},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{errors.New(`Get "https://api.coingecko.com/api/v3/simple/price": dial tcp: connection refused`), codes.Unavailable},
+	} {
+		st := status.Convert(toStatus(context.Background(), tc.err))
+		if st.Code() != tc.code {
+			t.Errorf("%v: code = %s, want %s", tc.err, st.Code(), tc.code)
+		}
+		if tc.code == codes.Unavailable && strings.Contains(st.Message(), "coingecko.com") {
+			t.Errorf("%v: message %q leaks the upstream error", tc.err, st.Message())
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package alert_service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	fileUtils "coinfetcher/services/file"
+	pollerService "coinfetcher/services/poller"
+	webhookUtils "coinfetcher/services/webhook"
+	"coinfetcher/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of alert rules.
+const (
+	KindAbove         = "above"          // The price crossed above Threshold.
+	KindBelow         = "below"          // The price crossed below Threshold.
+	KindPercentChange = "percent_change" // The price moved by Threshold percent within Window; negative thresholds watch drops.
+	KindVolumeSpike   = "volume_spike"   // The 24h volume reached Threshold times its average within Window.
+)
+
+// EventTriggered is the webhook event sent when a rule fires.
+const EventTriggered = "alert.triggered"
+
+const (
+	defaultWindow    = time.Hour
+	maxWindow        = 24 * time.Hour
+	defaultCooldown  = 15 * time.Minute
+	maxRulesPerOwner = 100
+	saveInterval     = 30 * time.Second
+)
+
+// ErrRuleNotFound is returned for rule IDs that don't exist, or belong to someone else.
+var ErrRuleNotFound = errors.New("alert rule not found")
+
+// ErrInvalidRule is wrapped by the errors describing why a rule was rejected.
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// ErrNotSaved is wrapped by the errors of changes that were undone because the rules couldn't be saved.
+var ErrNotSaved = errors.New("alert rules could not be saved")
+
+// stats publishes the engine counters under "alerts" in expvar.
+var stats = expvar.NewMap("alerts")
+
+// tickerPattern matches CoinGecko coin IDs.
+var tickerPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// rule is a validated rule with its parsed durations and evaluation state.
+type rule struct {
+	types.AlertRule
+	window    time.Duration
+	cooldown  time.Duration
+	lastPrice float64 // Price at the previous evaluation, for crossings; 0 before the first one.
+}
+
+// sample is a quote remembered for window based rules.
+type sample struct {
+	at     time.Time
+	price  float64
+	volume float64
+}
+
+// Engine keeps the alert rules, evaluates them against every quote the poller fetches for
+// their tickers, and sends the rules that fire to their webhooks. Rules are persisted to
+// a file so they survive restarts. A rule that fired stays quiet for its cooldown, so a
+// price hovering around a level doesn't cause an alert storm.
+type Engine struct {
+	path     string // File rules are persisted to; empty keeps them in memory only.
+	sub      *pollerService.Subscription
+	webhooks *webhookUtils.Dispatcher
+
+	mu      sync.Mutex
+	rules   map[string]*rule    // By ID.
+	refs    map[string]int      // Number of rules per ticker.
+	history map[string][]sample // Recent quotes per ticker, oldest first.
+	dirty   bool                // Trigger times changed since the last save.
+}
+
+// NewEngine creates an engine persisting to path, loading the rules saved there, and watching
+// their tickers on poller. A missing file is not an error. Saved rules that are no longer
+// valid, or whose endpoint is gone, are skipped with a warning; rules saved with a webhook
+// URL instead of an endpoint get an endpoint created for each distinct owner and URL.
+func NewEngine(path string, poller *pollerService.Poller, webhooks *webhookUtils.Dispatcher) (*Engine, error) {
+	e := &Engine{
+		path:     path,
+		sub:      poller.Subscribe(),
+		webhooks: webhooks,
+		rules:    make(map[string]*rule),
+		refs:     make(map[string]int),
+		history:  make(map[string][]sample),
+	}
+	webhooks.AddReferrer(e.usesEndpoint)
+	if path == "" {
+		return e, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alerts file: %v", err)
+	}
+	var saved struct {
+		Rules []savedRule `json:"rules"`
+	}
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse alerts file %s: %v", path, err)
+	}
+	migrated := make(map[[2]string]string) // Endpoint IDs by owner and legacy URL.
+	for _, r := range saved.Rules {
+		// Legacy rules are validated before an endpoint is created for them.
+		legacy := r.WebhookID == "" && r.WebhookURL != ""
+		if legacy {
+			r.WebhookID = r.WebhookURL
+		}
+		compiled, err := compile(r.AlertRule)
+		if err != nil {
+			e.skip(r.AlertRule, err)
+			continue
+		}
+
+		if legacy {
+			key := [2]string{r.Owner, r.WebhookURL}
+			if migrated[key] == "" {
+				endpoint, err := webhooks.CreateEndpoint(r.Owner, r.WebhookURL, "Created for the alert rules that named this URL")
+				if err != nil {
+					e.skip(r.AlertRule, err)
+					continue
+				}
+				migrated[key] = endpoint.ID
+				log.WithFields(log.Fields{"owner": r.Owner, "url": r.WebhookURL, "endpoint": endpoint.ID}).
+					Warn("Created a webhook endpoint for alert rules with a webhookUrl; its deliveries are now signed with the secret in the webhooks file")
+			}
+			compiled.WebhookID = migrated[key]
+			e.dirty = true
+		}
+		if _, err := webhooks.Endpoint(compiled.WebhookID, compiled.Owner, false); err != nil {
+			e.skip(r.AlertRule, err)
+			continue
+		}
+		e.add(compiled)
+	}
+	// Saved right away so a restart doesn't create the migrated endpoints a second time.
+	if e.dirty {
+		if err := e.Save(); err != nil {
+			return nil, fmt.Errorf("failed to save alerts file %s: %v", path, err)
+		}
+	}
+	return e, nil
+}
+
+// savedRule is a rule as read from the alerts file. Rules saved before webhook endpoints
+// existed name the URL they are delivered to instead of an endpoint.
+type savedRule struct {
+	types.AlertRule
+	WebhookURL string `json:"webhookUrl,omitempty"`
+}
+
+// skip reports a saved rule that can't be loaded. It is dropped the next time the rules are saved.
+func (e *Engine) skip(r types.AlertRule, err error) {
+	stats.Add("skipped", 1)
+	e.dirty = true
+	log.WithFields(log.Fields{"file": e.path, "rule": r.ID, "owner": r.Owner}).
+		WithError(err).Warn("Skipping alert rule that can't be loaded")
+}
+
+// compile validates r and parses its durations, filling in the defaults.
+func compile(r types.AlertRule) (*rule, error) {
+	invalid := func(format string, args ...interface{}) (*rule, error) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRule, fmt.Sprintf(format, args...))
+	}
+
+	r.Ticker = strings.ToLower(strings.TrimSpace(r.Ticker))
+	if !tickerPattern.MatchString(r.Ticker) {
+		return invalid("ticker must be a CoinGecko coin ID")
+	}
+
+	compiled := &rule{AlertRule: r, cooldown: defaultCooldown}
+	switch r.Kind {
+	case KindAbove, KindBelow:
+		if r.Threshold <= 0 {
+			return invalid("threshold must be a positive price")
+		}
+		if r.Window != "" {
+			return invalid("%s rules take no window", r.Kind)
+		}
+	case KindPercentChange, KindVolumeSpike:
+		if r.Kind == KindPercentChange && r.Threshold == 0 {
+			return invalid("threshold must be a non-zero percentage")
+		}
+		if r.Kind == KindVolumeSpike && r.Threshold <= 1 {
+			return invalid("threshold must be a volume multiple greater than 1")
+		}
+		compiled.window = defaultWindow
+		if r.Window != "" {
+			window, err := time.ParseDuration(r.Window)
+			if err != nil || window <= 0 || window > maxWindow {
+				return invalid("window must be a duration up to %s, like \"1h\"", maxWindow)
+			}
+			compiled.window = window
+		}
+		compiled.Window = compiled.window.String()
+	default:
+		return invalid("kind must be %q, %q, %q or %q", KindAbove, KindBelow, KindPercentChange, KindVolumeSpike)
+	}
+
+	if r.Cooldown != "" {
+		cooldown, err := time.ParseDuration(r.Cooldown)
+		if err != nil || cooldown < 0 {
+			return invalid("cooldown must be a duration, like \"15m\"")
+		}
+		compiled.cooldown = cooldown
+	}
+	compiled.Cooldown = compiled.cooldown.String()
+
+	if r.WebhookID == "" {
+		return invalid("webhookId must name a webhook endpoint")
+	}
+	return compiled, nil
+}
+
+// compileFor compiles r, which is about to be stored, and checks that its owner owns the
+// webhook endpoint it names.
+func (e *Engine) compileFor(r types.AlertRule) (*rule, error) {
+	compiled, err := compile(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.webhooks.Endpoint(r.WebhookID, r.Owner, false); err != nil {
+		return nil, fmt.Errorf("%w: webhook endpoint %s does not exist", ErrInvalidRule, r.WebhookID)
+	}
+	return compiled, nil
+}
+
+// usesEndpoint reports whether a rule is delivered to the webhook endpoint with id.
+func (e *Engine) usesEndpoint(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.rules {
+		if r.WebhookID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// add stores r and starts watching its ticker. Callers hold e.mu, or own e exclusively.
+func (e *Engine) add(r *rule) {
+	e.rules[r.ID] = r
+	if e.refs[r.Ticker]++; e.refs[r.Ticker] == 1 {
+		e.sub.Watch(r.Ticker)
+	}
+}
+
+// remove deletes r and stops watching its ticker once no rule needs it. Callers hold e.mu.
+func (e *Engine) remove(r *rule) {
+	delete(e.rules, r.ID)
+	if e.refs[r.Ticker]--; e.refs[r.Ticker] <= 0 {
+		delete(e.refs, r.Ticker)
+		delete(e.history, r.Ticker)
+		e.sub.Unwatch(r.Ticker)
+	}
+}
+
+// Rules returns the rules of owner sorted by creation, or every rule if all is true.
+func (e *Engine) Rules(owner string, all bool) []types.AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := []types.AlertRule{}
+	for _, r := range e.rules {
+		if all || r.Owner == owner {
+			rules = append(rules, r.AlertRule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if !rules[i].CreatedAt.Equal(rules[j].CreatedAt) {
+			return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// Rule returns the rule with id if owner may see it; all grants access to every rule.
+func (e *Engine) Rule(id, owner string, all bool) (types.AlertRule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, ok := e.rules[id]
+	if !ok || (!all && r.Owner != owner) {
+		return types.AlertRule{}, ErrRuleNotFound
+	}
+	return r.AlertRule, nil
+}
+
+// Create validates and stores a new rule of owner, and persists the rules. If they can't be
+// saved, the rule is dropped again, so a client retrying the request doesn't create it twice.
+func (e *Engine) Create(owner string, r types.AlertRule) (types.AlertRule, error) {
+	r.ID, r.Owner, r.CreatedAt, r.LastTriggeredAt = newID(), owner, time.Now().UTC(), nil
+	compiled, err := e.compileFor(r)
+	if err != nil {
+		return types.AlertRule{}, err
+	}
+
+	e.mu.Lock()
+	count := 0
+	for _, existing := range e.rules {
+		if existing.Owner == owner {
+			count++
+		}
+	}
+	if count >= maxRulesPerOwner {
+		e.mu.Unlock()
+		return types.AlertRule{}, fmt.Errorf("%w: at most %d rules are allowed per owner", ErrInvalidRule, maxRulesPerOwner)
+	}
+	e.add(compiled)
+	e.mu.Unlock()
+
+	if err := e.Save(); err != nil {
+		e.mu.Lock()
+		e.remove(compiled)
+		e.mu.Unlock()
+		return types.AlertRule{}, fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return compiled.AlertRule, nil
+}
+
+// Update replaces the rule with id by r, keeping its ID, owner and creation time, and
+// persists the rules. The evaluation state starts over, as the conditions may have changed.
+// If the rules can't be saved, the previous rule is put back.
+func (e *Engine) Update(id, owner string, all bool, r types.AlertRule) (types.AlertRule, error) {
+	e.mu.Lock()
+	existing, ok := e.rules[id]
+	if !ok || (!all && existing.Owner != owner) {
+		e.mu.Unlock()
+		return types.AlertRule{}, ErrRuleNotFound
+	}
+	r.ID, r.Owner, r.CreatedAt, r.LastTriggeredAt = existing.ID, existing.Owner, existing.CreatedAt, existing.LastTriggeredAt
+	compiled, err := e.compileFor(r)
+	if err != nil {
+		e.mu.Unlock()
+		return types.AlertRule{}, err
+	}
+	e.remove(existing)
+	e.add(compiled)
+	e.mu.Unlock()
+
+	if err := e.Save(); err != nil {
+		e.mu.Lock()
+		e.remove(compiled)
+		e.add(existing)
+		e.mu.Unlock()
+		return types.AlertRule{}, fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return compiled.AlertRule, nil
+}
+
+// Delete removes the rule with id and persists the rules. If they can't be saved, the rule is kept.
+func (e *Engine) Delete(id, owner string, all bool) error {
+	e.mu.Lock()
+	r, ok := e.rules[id]
+	if !ok || (!all && r.Owner != owner) {
+		e.mu.Unlock()
+		return ErrRuleNotFound
+	}
+	e.remove(r)
+	e.mu.Unlock()
+
+	if err := e.Save(); err != nil {
+		e.mu.Lock()
+		e.add(r)
+		e.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return nil
+}
+
+// DeadLetters returns the alert deliveries given up on for the rules of owner, or for every
+// rule if all is true.
+func (e *Engine) DeadLetters(owner string, all bool) []webhookUtils.Delivery {
+	return e.webhooks.Failed(func(d webhookUtils.Delivery) bool {
+		if d.Event != EventTriggered {
+			return false
+		}
+		var event types.AlertEvent
+		return json.Unmarshal(d.Payload, &event) == nil && (all || event.Rule.Owner == owner)
+	})
+}
+
+// Run evaluates the rules against the poller's quotes until ctx is cancelled or the poller
+// stops, saving trigger times periodically and a last time on the way out.
+func (e *Engine) Run(ctx context.Context) {
+	defer e.sub.Close()
+
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.saveDirty()
+			return
+		case <-e.sub.Done():
+			e.saveDirty()
+			return
+		case <-ticker.C:
+			e.saveDirty()
+		case <-e.sub.Ready():
+			e.evaluate(e.sub.Drain(), time.Now().UTC())
+		}
+	}
+}
+
+// evaluate checks the rules of the tickers in prices and fires those whose condition is met.
+func (e *Engine) evaluate(prices []types.PriceResponse, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, price := range prices {
+		history := e.history[price.Ticker]
+		for _, r := range e.rules {
+			if r.Ticker != price.Ticker {
+				continue
+			}
+			value, message, met := r.check(price, history, now)
+			r.lastPrice = price.Price
+			if !met {
+				continue
+			}
+			if r.LastTriggeredAt != nil && now.Sub(*r.LastTriggeredAt) < r.cooldown {
+				stats.Add("suppressed", 1)
+				continue
+			}
+			e.fire(r, price, value, message, now)
+		}
+		e.history[price.Ticker] = prune(append(history, sample{at: now, price: price.Price, volume: price.Vol24Hr}), now.Add(-maxWindow))
+	}
+}
+
+// check reports whether price meets the rule's condition, with the value compared to the
+// threshold and a message describing it. history holds the ticker's earlier quotes.
+func (r *rule) check(price types.PriceResponse, history []sample, now time.Time) (float64, string, bool) {
+	switch r.Kind {
+	case KindAbove:
+		// Only crossings count; a rule created while the price is already above waits for the next one.
+		met := r.lastPrice != 0 && r.lastPrice < r.Threshold && price.Price >= r.Threshold
+		return price.Price, fmt.Sprintf("%s rose above %g to %g", r.Ticker, r.Threshold, price.Price), met
+	case KindBelow:
+		met := r.lastPrice != 0 && r.lastPrice > r.Threshold && price.Price <= r.Threshold
+		return price.Price, fmt.Sprintf("%s fell below %g to %g", r.Ticker, r.Threshold, price.Price), met
+	case KindPercentChange:
+		window := prune(history, now.Add(-r.window))
+		if len(window) == 0 || window[0].price == 0 {
+			return 0, "", false
+		}
+		change := (price.Price - window[0].price) / window[0].price * 100
+		met := (r.Threshold > 0 && change >= r.Threshold) || (r.Threshold < 0 && change <= r.Threshold)
+		return change, fmt.Sprintf("%s moved %+.2f%% within %s to %g", r.Ticker, change, r.window, price.Price), met
+	case KindVolumeSpike:
+		window := prune(history, now.Add(-r.window))
+		if len(window) == 0 {
+			return 0, "", false
+		}
+		var total float64
+		for _, s := range window {
+			total += s.volume
+		}
+		average := total / float64(len(window))
+		if average == 0 {
+			return 0, "", false
+		}
+		multiple := price.Vol24Hr / average
+		return multiple, fmt.Sprintf("%s 24h volume reached %.2fx its %s average", r.Ticker, multiple, r.window), multiple >= r.Threshold
+	}
+	return 0, "", false
+}
+
+// fire records that r triggered and queues its webhook. Callers hold e.mu.
+func (e *Engine) fire(r *rule, price types.PriceResponse, value float64, message string, now time.Time) {
+	triggeredAt := now
+	r.LastTriggeredAt = &triggeredAt
+	e.dirty = true
+	stats.Add("triggered", 1)
+
+	event := types.AlertEvent{Rule: r.AlertRule, Quote: price, Value: roundValue(value), Message: message, TriggeredAt: now}
+	if _, err := e.webhooks.Enqueue(r.WebhookID, EventTriggered, event); err != nil {
+		log.WithFields(log.Fields{"rule": r.ID, "owner": r.Owner, "endpoint": r.WebhookID}).
+			WithError(err).Error("Error queueing alert")
+	}
+}
+
+// saveDirty saves the rules if trigger times changed, reporting failures.
+func (e *Engine) saveDirty() {
+	e.mu.Lock()
+	dirty := e.dirty
+	e.mu.Unlock()
+	if !dirty {
+		return
+	}
+	if err := e.Save(); err != nil {
+		log.WithFields(log.Fields{"file": e.path}).WithError(err).Error("Error saving alert rules")
+	}
+}
+
+// Save writes the rules to the engine's file. The file is replaced atomically.
+func (e *Engine) Save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	e.mu.Lock()
+	saved := struct {
+		Rules []types.AlertRule `json:"rules"`
+	}{Rules: make([]types.AlertRule, 0, len(e.rules))}
+	for _, r := range e.rules {
+		saved.Rules = append(saved.Rules, r.AlertRule)
+	}
+	sort.Slice(saved.Rules, func(i, j int) bool { return saved.Rules[i].ID < saved.Rules[j].ID })
+	raw, err := json.MarshalIndent(saved, "", "  ")
+	e.dirty = false
+	e.mu.Unlock()
+
+	if err == nil {
+		err = fileUtils.WriteAtomic(e.path, raw)
+	}
+	if err != nil {
+		e.mu.Lock()
+		e.dirty = true // Retry on the next save.
+		e.mu.Unlock()
+	}
+	return err
+}
+
+// prune drops the samples taken before since.
+func prune(samples []sample, since time.Time) []sample {
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].at.Before(since) })
+	return samples[i:]
+}
+
+// roundValue rounds the value reported with an event to 8 significant decimals.
+func roundValue(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
+
+// newID returns a random rule ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,234 @@
+package alert_service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pollerService "coinfetcher/services/poller"
+	webhookUtils "coinfetcher/services/webhook"
+	"coinfetcher/types"
+)
+
+// newTestEngine creates an engine loading the rules in raw, and the dispatcher it delivers to.
+func newTestEngine(t *testing.T, raw string) (*Engine, *webhookUtils.Dispatcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "alerts.json")
+	if raw != "" {
+		if err := os.WriteFile(path, []byte(raw), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	webhooks, err := webhookUtils.NewDispatcher(filepath.Join(dir, "webhooks.json"), webhookUtils.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(path, pollerService.NewPoller(nil, time.Minute), webhooks)
+	if err != nil {
+		t.Fatalf("NewEngine = %v", err)
+	}
+	return engine, webhooks, path
+}
+
+func TestNewEngineMigratesWebhookURLs(t *testing.T) {
+	engine, webhooks, path := newTestEngine(t, `{"rules": [
+		{"id": "r1", "owner": "alice", "ticker": "bitcoin", "kind": "above", "threshold": 70000, "webhookUrl": "https://hooks.example.com/a"},
+		{"id": "r2", "owner": "alice", "ticker": "ethereum", "kind": "below", "threshold": 2000, "webhookUrl": "https://hooks.example.com/a"},
+		{"id": "r3", "owner": "bob", "ticker": "bitcoin", "kind": "above", "threshold": 70000, "webhookUrl": "https://hooks.example.com/a"},
+		{"id": "r4", "owner": "bob", "ticker": "bitcoin", "kind": "sideways", "threshold": 1, "webhookUrl": "https://hooks.example.com/b"},
+		{"id": "r5", "owner": "bob", "ticker": "bitcoin", "kind": "above", "threshold": 1, "webhookId": "gone"},
+		{"id": "r6", "owner": "bob", "ticker": "bitcoin", "kind": "above", "threshold": 1, "webhookUrl": "http://169.254.169.254/"}
+	]}`)
+
+	rules := engine.Rules("", true)
+	if len(rules) != 3 {
+		t.Fatalf("loaded %d rules, want r1, r2 and r3: %+v", len(rules), rules)
+	}
+	byID := make(map[string]string)
+	for _, r := range rules {
+		byID[r.ID] = r.WebhookID
+		if _, err := webhooks.Endpoint(r.WebhookID, r.Owner, false); err != nil {
+			t.Errorf("rule %s names endpoint %q of someone else: %v", r.ID, r.WebhookID, err)
+		}
+	}
+	if byID["r1"] != byID["r2"] || byID["r1"] == byID["r3"] {
+		t.Errorf("endpoints = %v, want one per owner and URL", byID)
+	}
+	if n := len(webhooks.Endpoints("", true)); n != 2 {
+		t.Errorf("created %d endpoints, want 2", n)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "webhookUrl") || !strings.Contains(string(raw), byID["r1"]) {
+		t.Errorf("alerts file was not rewritten with the endpoints:\n%s", raw)
+	}
+}
+
+func TestEndpointsInUseCanNotBeDeleted(t *testing.T) {
+	engine, webhooks, _ := newTestEngine(t, "")
+	endpoint, err := webhooks.CreateEndpoint("alice", "https://hooks.example.com/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := engine.Create("alice", types.AlertRule{Ticker: "bitcoin", Kind: KindAbove, Threshold: 70000, WebhookID: endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := webhooks.DeleteEndpoint(endpoint.ID, "alice", false); !errors.Is(err, webhookUtils.ErrEndpointInUse) {
+		t.Fatalf("DeleteEndpoint of a used endpoint = %v, want ErrEndpointInUse", err)
+	}
+	if err := engine.Delete(r.ID, "alice", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.DeleteEndpoint(endpoint.ID, "alice", false); err != nil {
+		t.Errorf("DeleteEndpoint of an unused endpoint = %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := []sample{
+		{at: now.Add(-2 * time.Hour), price: 50000, volume: 100},
+		{at: now.Add(-30 * time.Minute), price: 60000, volume: 100},
+		{at: now.Add(-10 * time.Minute), price: 62000, volume: 200},
+	}
+	compileRule := func(r types.AlertRule) *rule {
+		r.Ticker, r.WebhookID = "bitcoin", "hook"
+		compiled, err := compile(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compiled
+	}
+	above := types.AlertRule{Kind: KindAbove, Threshold: 70000}
+	below := types.AlertRule{Kind: KindBelow, Threshold: 60000}
+
+	for _, tc := range []struct {
+		name      string
+		rule      types.AlertRule
+		lastPrice float64
+		price     float64
+		volume    float64
+		value     float64
+		met       bool
+	}{
+		{"first quote above", above, 0, 71000, 0, 71000, false},
+		{"crossing above", above, 69000, 71000, 0, 71000, true},
+		{"reaching the threshold", above, 69000, 70000, 0, 70000, true},
+		{"staying above", above, 71000, 72000, 0, 72000, false},
+		{"staying below the threshold", above, 68000, 69000, 0, 69000, false},
+		{"crossing below", below, 61000, 59000, 0, 59000, true},
+		{"first quote below", below, 0, 59000, 0, 59000, false},
+		{"rising from below", below, 59000, 61000, 0, 61000, false},
+		// Compared to the oldest quote within the window, 60000 half an hour ago.
+		{"rise within the window", types.AlertRule{Kind: KindPercentChange, Threshold: 5}, 0, 63000, 0, 5, true},
+		{"small rise within the window", types.AlertRule{Kind: KindPercentChange, Threshold: 10}, 0, 63000, 0, 5, false},
+		{"drop within the window", types.AlertRule{Kind: KindPercentChange, Threshold: -10}, 0, 54000, 0, -10, true},
+		{"rise within a longer window", types.AlertRule{Kind: KindPercentChange, Threshold: 20, Window: "3h"}, 0, 63000, 0, 26, true},
+		// The average volume within the window is 150.
+		{"volume spike", types.AlertRule{Kind: KindVolumeSpike, Threshold: 2}, 0, 62000, 300, 2, true},
+		{"volume below the spike", types.AlertRule{Kind: KindVolumeSpike, Threshold: 2}, 0, 62000, 225, 1.5, false},
+	} {
+		r := compileRule(tc.rule)
+		r.lastPrice = tc.lastPrice
+		value, message, met := r.check(types.PriceResponse{Ticker: "bitcoin", Price: tc.price, Vol24Hr: tc.volume}, history, now)
+		if met != tc.met || roundValue(value) != tc.value {
+			t.Errorf("%s: check = %v, %v (%q), want %v, %v", tc.name, value, met, message, tc.value, tc.met)
+		}
+	}
+
+	if _, _, met := compileRule(types.AlertRule{Kind: KindPercentChange, Threshold: 5}).check(types.PriceResponse{Ticker: "bitcoin", Price: 63000}, nil, now); met {
+		t.Error("percent_change rule met without earlier quotes")
+	}
+}
+
+func TestEvaluateRespectsTheCooldown(t *testing.T) {
+	engine, webhooks, _ := newTestEngine(t, "")
+	endpoint, err := webhooks.CreateEndpoint("alice", "https://hooks.example.com/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := engine.Create("alice", types.AlertRule{Ticker: "bitcoin", Kind: KindAbove, Threshold: 70000, Cooldown: "10m", WebhookID: endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var fired []time.Duration
+	for _, step := range []struct {
+		after time.Duration
+		price float64
+	}{
+		{0, 69000},
+		{time.Minute, 71000},     // Crosses and fires.
+		{2 * time.Minute, 69000}, // Falls back,
+		{3 * time.Minute, 71000}, // and crosses again within the cooldown.
+		{4 * time.Minute, 72000},
+		{12 * time.Minute, 69000},
+		{13 * time.Minute, 71000}, // Crosses after the cooldown and fires again.
+		{14 * time.Minute, 75000},
+	} {
+		before, err := webhooks.Deliveries(endpoint.ID, "alice", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine.evaluate([]types.PriceResponse{
+			{Ticker: "ethereum", Price: 71000}, // Other tickers don't concern the rule.
+			{Ticker: "bitcoin", Price: step.price},
+		}, start.Add(step.after))
+		after, _ := webhooks.Deliveries(endpoint.ID, "alice", false)
+		if len(after) > len(before) {
+			fired = append(fired, step.after)
+		}
+	}
+
+	if len(fired) != 2 || fired[0] != time.Minute || fired[1] != 13*time.Minute {
+		t.Errorf("fired after %v, want after 1m and 13m", fired)
+	}
+	r, err := engine.Rule(created.ID, "alice", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LastTriggeredAt == nil || !r.LastTriggeredAt.Equal(start.Add(13*time.Minute)) {
+		t.Errorf("lastTriggeredAt = %v, want %v", r.LastTriggeredAt, start.Add(13*time.Minute))
+	}
+}
+
+func TestChangesAreUndoneWhenTheRulesCanNotBeSaved(t *testing.T) {
+	engine, webhooks, path := newTestEngine(t, "")
+	endpoint, err := webhooks.CreateEndpoint("alice", "https://hooks.example.com/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := engine.Create("alice", types.AlertRule{Ticker: "bitcoin", Kind: KindAbove, Threshold: 70000, WebhookID: endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.path = filepath.Join(path, "missing", "alerts.json")
+	if _, err := engine.Create("alice", types.AlertRule{Ticker: "ethereum", Kind: KindAbove, Threshold: 5000, WebhookID: endpoint.ID}); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("Create = %v, want ErrNotSaved", err)
+	}
+	if _, err := engine.Update(r.ID, "alice", false, types.AlertRule{Ticker: "bitcoin", Kind: KindBelow, Threshold: 60000, WebhookID: endpoint.ID}); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("Update = %v, want ErrNotSaved", err)
+	}
+	if err := engine.Delete(r.ID, "alice", false); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("Delete = %v, want ErrNotSaved", err)
+	}
+
+	rules := engine.Rules("alice", false)
+	if len(rules) != 1 || rules[0].ID != r.ID || rules[0].Kind != KindAbove {
+		t.Errorf("rules = %+v, want only the original rule", rules)
+	}
+	if engine.refs["ethereum"] != 0 || engine.refs["bitcoin"] != 1 {
+		t.Errorf("watched tickers = %v, want bitcoin only", engine.refs)
+	}
+}
@@ -0,0 +1,171 @@
+package auth_utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopePrice   = "price"   // Prices, search, metadata and the other market data endpoints.
+	ScopeHistory = "history" // Historical series.
+	ScopeAdmin   = "admin"   // Administrative endpoints.
+)
+
+// knownScopes lists the valid scopes.
+var knownScopes = map[string]bool{ScopePrice: true, ScopeHistory: true, ScopeAdmin: true}
+
+// Quota periods.
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// hashPrefix marks the hashing scheme of stored keys.
+const hashPrefix = "sha256:"
+
+// Quota limits the number of requests a key may make per calendar period (UTC).
+type Quota struct {
+	Limit  int64  `json:"limit"`  // Requests allowed per period; 0 means unlimited.
+	Period string `json:"period"` // PeriodDaily or PeriodMonthly.
+}
+
+// Key is an API key as stored: only the hash of the secret is kept.
+type Key struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"` // HashKey of the secret.
+	Scopes []string `json:"scopes"`
+	Quota  Quota    `json:"quota"`
+}
+
+// HashKey returns the stored form of a raw API key.
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// KeyStore looks up API keys by their secret.
+type KeyStore struct {
+	byHash map[string]*Key
+}
+
+// NewKeyStore creates a store holding keys, for keys embedded in code or loaded from elsewhere.
+func NewKeyStore(keys []Key) (*KeyStore, error) {
+	s := &KeyStore{byHash: make(map[string]*Key, len(keys))}
+	ids := make(map[string]bool, len(keys))
+
+	for i := range keys {
+		key := keys[i]
+		if err := validateKey(key); err != nil {
+			return nil, err
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("duplicate API key id %q", key.ID)
+		}
+		hash := strings.ToLower(key.Hash)
+		if _, ok := s.byHash[hash]; ok {
+			return nil, fmt.Errorf("API key %q has the same secret as another key", key.ID)
+		}
+		ids[key.ID] = true
+		s.byHash[hash] = &key
+	}
+	return s, nil
+}
+
+// LoadKeyFile reads a JSON key file of the form {"keys": [{"id": ..., "hash": "sha256:...", ...}]}.
+func LoadKeyFile(path string) (*KeyStore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %v", err)
+	}
+
+	var file struct {
+		Keys []Key `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API key file %s: %v", path, err)
+	}
+	return NewKeyStore(file.Keys)
+}
+
+// validateKey checks a stored key for mistakes that would otherwise only show up at request time.
+func validateKey(key Key) error {
+	if key.ID == "" {
+		return fmt.Errorf("API key without id")
+	}
+	hash := strings.ToLower(key.Hash)
+	if !strings.HasPrefix(hash, hashPrefix) || len(hash) != len(hashPrefix)+2*sha256.Size {
+		return fmt.Errorf("API key %q: hash must be %q followed by 64 hex digits", key.ID, hashPrefix)
+	}
+	if _, err := hex.DecodeString(strings.TrimPrefix(hash, hashPrefix)); err != nil {
+		return fmt.Errorf("API key %q: hash is not hexadecimal", key.ID)
+	}
+	for _, scope := range key.Scopes {
+		if !knownScopes[scope] {
+			return fmt.Errorf("API key %q: unknown scope %q", key.ID, scope)
+		}
+	}
+	if key.Quota.Limit < 0 {
+		return fmt.Errorf("API key %q: quota limit must not be negative", key.ID)
+	}
+	if key.Quota.Limit > 0 && key.Quota.Period != PeriodDaily && key.Quota.Period != PeriodMonthly {
+		return fmt.Errorf("API key %q: quota period must be %q or %q", key.ID, PeriodDaily, PeriodMonthly)
+	}
+	return nil
+}
+
+// Lookup returns the key whose secret is raw.
+func (s *KeyStore) Lookup(raw string) (*Key, bool) {
+	if raw == "" {
+		return nil, false
+	}
+	key, ok := s.byHash[HashKey(raw)]
+	return key, ok
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string          // Key ID or token subject.
+	Scopes  map[string]bool // Granted scopes.
+}
+
+// NewPrincipal creates a principal with the given scopes.
+func NewPrincipal(subject string, scopes []string) *Principal {
+	p := &Principal{Subject: subject, Scopes: make(map[string]bool, len(scopes))}
+	for _, scope := range scopes {
+		p.Scopes[scope] = true
+	}
+	return p
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && p.Scopes[scope]
+}
+
+// principalKey is the context key the principal is stored under.
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx, or nil if the request is anonymous.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// SubjectFromContext returns the subject of the principal stored in ctx, or "" if the request is anonymous.
+func SubjectFromContext(ctx context.Context) string {
+	if p := PrincipalFromContext(ctx); p != nil {
+		return p.Subject
+	}
+	return ""
+}
@@ -0,0 +1,486 @@
+package auth_utils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // Registers SHA-256 for crypto.Hash.
+	_ "crypto/sha512" // Registers SHA-384 and SHA-512 for crypto.Hash.
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jwksFetchTimeout bounds a JWKS download.
+const jwksFetchTimeout = 10 * time.Second
+
+// jwksMinRefetch is how long a token signed with an unknown key has to wait before it may
+// trigger another JWKS download, so garbage tokens can't hammer the identity provider.
+const jwksMinRefetch = time.Minute
+
+// ErrInvalidToken is wrapped by all errors about the token itself, as opposed to key set failures.
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures the validation of bearer tokens issued by an OIDC identity provider.
+type JWTConfig struct {
+	JWKS            string              // Path or http(s) URL of the JSON Web Key Set the tokens are signed with.
+	Issuer          string              // Required "iss" claim.
+	Audience        string              // Required entry of the "aud" claim.
+	ScopeClaim      string              // Claim holding the granted scopes or roles; "scope" if empty.
+	ScopeMapping    map[string][]string // Maps claim values to scopes; if empty, values naming a scope grant it.
+	Leeway          time.Duration       // Clock skew tolerated when checking "exp" and "nbf".
+	RefreshInterval time.Duration       // How often the key set is reloaded; 0 disables reloading.
+}
+
+// ParseScopeMapping parses a mapping of the form "value=scope,value=scope", where a value may
+// appear several times to grant several scopes.
+func ParseScopeMapping(s string) (map[string][]string, error) {
+	mapping := make(map[string][]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		value, scope, ok := strings.Cut(pair, "=")
+		value, scope = strings.TrimSpace(value), strings.TrimSpace(scope)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid scope mapping %q, want value=scope", pair)
+		}
+		if !knownScopes[scope] {
+			return nil, fmt.Errorf("scope mapping %q: unknown scope %q", pair, scope)
+		}
+		mapping[value] = append(mapping[value], scope)
+	}
+	return mapping, nil
+}
+
+// JWTVerifier validates bearer tokens against a JSON Web Key Set.
+type JWTVerifier struct {
+	config JWTConfig
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey // By key ID.
+	lastFetch time.Time
+
+	reloadMu   sync.Mutex // Held while a token with an unknown key reloads the key set.
+	lastReload time.Time  // When such a reload was last attempted, guarded by reloadMu.
+}
+
+// NewJWTVerifier creates a verifier and loads its key set, so a bad JWKS location is reported at startup.
+func NewJWTVerifier(ctx context.Context, config JWTConfig) (*JWTVerifier, error) {
+	if config.JWKS == "" || config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("a JWKS, an issuer and an audience are required to verify tokens")
+	}
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = "scope"
+	}
+
+	v := &JWTVerifier{config: config, client: &http.Client{Timeout: jwksFetchTimeout}}
+	if err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Run reloads the key set every RefreshInterval until ctx is cancelled, so rotated keys are picked up.
+func (v *JWTVerifier) Run(ctx context.Context) {
+	if v.config.RefreshInterval <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(v.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.refresh(ctx); err != nil {
+				// Keep the keys we have.
+				log.WithFields(log.Fields{"jwks": v.config.JWKS, "err": err}).Error("Error reloading JWKS")
+			}
+		}
+	}
+}
+
+// refresh loads the key set and replaces the current keys with it.
+func (v *JWTVerifier) refresh(ctx context.Context) error {
+	raw, err := v.readJWKS(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// readJWKS reads the key set from its file or URL.
+func (v *JWTVerifier) readJWKS(ctx context.Context) ([]byte, error) {
+	location := v.config.JWKS
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		raw, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %v", err)
+		}
+		return raw, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS URL: %v", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	return raw, nil
+}
+
+// jwk is a single JSON Web Key. Only the public parts of RSA and EC keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JSON Web Key Set into public keys by key ID.
+// Keys not meant for signatures and key types other than RSA and EC are skipped.
+func ParseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS holds no usable signing keys")
+	}
+	return keys, nil
+}
+
+// rsaKey decodes an RSA public key.
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, fmt.Errorf("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+	}
+	return key, nil
+}
+
+// ecKey decodes an elliptic curve public key.
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("invalid coordinates")
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+	return key, nil
+}
+
+// signingAlgorithms lists the accepted "alg" values with their hash.
+// Symmetric algorithms and "none" are deliberately missing.
+var signingAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a compact JWT and returns
+// the principal it identifies, with its claims mapped to scopes.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	hash, ok := signingAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, hash, h.Sum(nil), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return NewPrincipal(subject, v.scopes(claims)), nil
+}
+
+// key returns the key with the given ID, reloading the key set once if it is unknown,
+// as the identity provider may have rotated its keys. Tokens without a key ID can only
+// be used with single-key sets.
+func (v *JWTVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	lookup := func() (crypto.PublicKey, bool, bool) {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+
+		stale := time.Since(v.lastFetch) > jwksMinRefetch
+		if kid == "" && len(v.keys) == 1 {
+			for _, key := range v.keys {
+				return key, true, stale
+			}
+		}
+		key, ok := v.keys[kid]
+		return key, ok, stale
+	}
+
+	key, ok, stale := lookup()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+
+	// Only one caller reloads the key set. The others wait for it and look again, rather than
+	// downloading it once each, and failed reloads aren't retried before jwksMinRefetch either.
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+	if key, ok, stale = lookup(); ok {
+		return key, nil
+	}
+	if stale && time.Since(v.lastReload) > jwksMinRefetch {
+		v.lastReload = time.Now()
+		if err := v.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok, _ = lookup(); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+// verifySignature checks signature over digest with key, which must suit alg.
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) error {
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the key type", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the key type", alg)
+		}
+		// JWS signatures are the fixed-size concatenation of r and s.
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("signature verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// checkClaims validates the issuer, audience and lifetime claims at now.
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	audienceOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audienceOK = aud == v.config.Audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == v.config.Audience {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return fmt.Errorf("token is not meant for audience %q", v.config.Audience)
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("missing expiry")
+	}
+	if now.After(exp.Add(v.config.Leeway)) {
+		return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.config.Leeway).Before(nbf) {
+		return fmt.Errorf("token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// scopes maps the values of the scope claim to scopes. The claim may be a space-separated
+// string, as OAuth's "scope", or a list, as "scp" or "roles".
+func (v *JWTVerifier) scopes(claims map[string]interface{}) []string {
+	var values []string
+	switch claim := claims[v.config.ScopeClaim].(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var scopes []string
+	for _, value := range values {
+		if len(v.config.ScopeMapping) > 0 {
+			scopes = append(scopes, v.config.ScopeMapping[value]...)
+		} else if knownScopes[value] {
+			scopes = append(scopes, value)
+		}
+	}
+	return scopes
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into out.
+func decodeSegment(segment string, out interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// numericDate converts a JWT NumericDate claim, seconds since the epoch, to a time.
+func numericDate(claim interface{}) (time.Time, bool) {
+	n, ok := claim.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
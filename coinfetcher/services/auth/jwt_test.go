@@ -0,0 +1,210 @@
+package auth_utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com/"
+	testAudience = "coinfetcher"
+)
+
+// testKeys are an RSA and an EC signing key, published in a JWKS as "rsa" and "ec".
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// jwks returns the key set publishing the public keys.
+func (k testKeys) jwks(t *testing.T) []byte {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	raw, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(k.ec.X.FillBytes(make([]byte, 32))), "y": b64(k.ec.Y.FillBytes(make([]byte, 32)))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// newTestVerifier creates a verifier reading the key set of keys from a file.
+func newTestVerifier(t *testing.T, keys testKeys) *JWTVerifier {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keys.jwks(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(context.Background(), JWTConfig{JWKS: path, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// validClaims returns the claims of a token the verifier accepts.
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "price history unknown",
+	}
+}
+
+// sign returns a compact JWT of claims, signed with key under alg. key is ignored for "none".
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch alg {
+	case "none":
+	case "RS256":
+		var err error
+		if signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		t.Fatalf("can't sign with %s", alg)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyAcceptsSignedTokens(t *testing.T) {
+	keys := newTestKeys(t)
+	v := newTestVerifier(t, keys)
+
+	for _, token := range []string{
+		sign(t, "RS256", "rsa", keys.rsa, validClaims()),
+		sign(t, "ES256", "ec", keys.ec, validClaims()),
+	} {
+		principal, err := v.Verify(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.Subject != "alice" || !principal.HasScope(ScopePrice) || !principal.HasScope(ScopeHistory) || len(principal.Scopes) != 2 {
+			t.Errorf("principal = %+v, want alice with the price and history scopes", principal)
+		}
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	keys := newTestKeys(t)
+	v := newTestVerifier(t, keys)
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	// An HS256 token "signed" with the public RSA key, as in the classic algorithm confusion attack.
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"rsa"}`))
+	payload, _ := json.Marshal(validClaims())
+	input := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, keys.rsa.PublicKey.N.Bytes())
+	mac.Write([]byte(input))
+	hs256 := input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	other := newTestKeys(t)
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"wrong issuer", sign(t, "RS256", "rsa", keys.rsa, with("iss", "https://evil.example.com/"))},
+		{"wrong audience", sign(t, "ES256", "ec", keys.ec, with("aud", "someone-else"))},
+		{"expired", sign(t, "RS256", "rsa", keys.rsa, with("exp", time.Now().Add(-time.Minute).Unix()))},
+		{"not yet valid", sign(t, "ES256", "ec", keys.ec, with("nbf", time.Now().Add(time.Hour).Unix()))},
+		{"no expiry", sign(t, "RS256", "rsa", keys.rsa, with("exp", nil))},
+		{"no subject", sign(t, "RS256", "rsa", keys.rsa, with("sub", ""))},
+		{"alg none", sign(t, "none", "rsa", nil, validClaims())},
+		{"HS256", hs256},
+		{"wrong key", sign(t, "RS256", "rsa", other.rsa, validClaims())},
+		{"key of another type", sign(t, "ES256", "rsa", keys.ec, validClaims())},
+		{"unknown key", sign(t, "RS256", "rotated", keys.rsa, validClaims())},
+		{"malformed", "not.a-token"},
+	} {
+		if _, err := v.Verify(context.Background(), tc.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want an invalid token", tc.name, err)
+		}
+	}
+}
+
+func TestUnknownKeysReloadTheKeySetOnce(t *testing.T) {
+	keys := newTestKeys(t)
+	jwks := keys.jwks(t)
+	var fetches int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(50 * time.Millisecond) // Lets the other callers pile up.
+		w.Write(jwks)
+	}))
+	defer idp.Close()
+
+	v, err := NewJWTVerifier(context.Background(), JWTConfig{JWKS: idp.URL, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.mu.Lock()
+	v.lastFetch = time.Now().Add(-2 * jwksMinRefetch)
+	v.mu.Unlock()
+
+	token := sign(t, "RS256", "rotated", keys.rsa, validClaims())
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Verify(context.Background(), token)
+		}()
+	}
+	wg.Wait()
+	v.Verify(context.Background(), token)
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("key set fetched %d times, want once at startup and once for the unknown key", n)
+	}
+}
@@ -0,0 +1,145 @@
+package auth_utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	fileUtils "coinfetcher/services/file"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// quotaSaveInterval is how often usage is written to disk while the server runs.
+const quotaSaveInterval = 30 * time.Second
+
+// QuotaStatus describes a key's quota after a request was counted.
+type QuotaStatus struct {
+	Limit     int64     // Requests allowed per period; 0 means unlimited.
+	Remaining int64     // Requests left in the current period.
+	Reset     time.Time // Start of the next period.
+}
+
+// quotaUsage is the number of requests a key made in one period.
+type quotaUsage struct {
+	Period string `json:"period"` // "2006-01-02" for daily quotas, "2006-01" for monthly ones.
+	Count  int64  `json:"count"`
+}
+
+// QuotaTracker counts requests per key and period, and persists the counts so restarts
+// don't hand out fresh quotas.
+type QuotaTracker struct {
+	path string // File usage is persisted to; empty keeps it in memory only.
+
+	mu    sync.Mutex
+	usage map[string]quotaUsage // By key ID.
+	dirty bool
+}
+
+// NewQuotaTracker creates a tracker persisting to path, loading the usage saved there.
+// A missing file is not an error.
+func NewQuotaTracker(path string) (*QuotaTracker, error) {
+	t := &QuotaTracker{path: path, usage: make(map[string]quotaUsage)}
+	if path == "" {
+		return t, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota file: %v", err)
+	}
+	if err := json.Unmarshal(raw, &t.usage); err != nil {
+		return nil, fmt.Errorf("failed to parse quota file %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// Allow counts a request by key at now and reports whether it is within the key's quota.
+// Rejected requests are not counted.
+func (t *QuotaTracker) Allow(key *Key, now time.Time) (QuotaStatus, bool) {
+	if key.Quota.Limit == 0 {
+		return QuotaStatus{}, true
+	}
+
+	period, reset := quotaPeriod(key.Quota.Period, now)
+	status := QuotaStatus{Limit: key.Quota.Limit, Reset: reset}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := t.usage[key.ID]
+	if usage.Period != period {
+		usage = quotaUsage{Period: period} // A new period started.
+	}
+	if usage.Count >= key.Quota.Limit {
+		return status, false
+	}
+
+	usage.Count++
+	t.usage[key.ID] = usage
+	t.dirty = true
+
+	status.Remaining = key.Quota.Limit - usage.Count
+	return status, true
+}
+
+// quotaPeriod returns the name of the period containing now and the start of the next one.
+func quotaPeriod(period string, now time.Time) (string, time.Time) {
+	now = now.UTC()
+	if period == PeriodMonthly {
+		return now.Format("2006-01"), time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return now.Format("2006-01-02"), time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Run saves usage periodically until ctx is cancelled, then saves it a last time.
+func (t *QuotaTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(quotaSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Save(); err != nil {
+				log.WithFields(log.Fields{"file": t.path, "err": err}).Error("Error saving quota usage")
+			}
+			return
+		case <-ticker.C:
+			if err := t.Save(); err != nil {
+				log.WithFields(log.Fields{"file": t.path, "err": err}).Error("Error saving quota usage")
+			}
+		}
+	}
+}
+
+// Save writes the usage to the tracker's file if it changed. The file is replaced atomically.
+func (t *QuotaTracker) Save() error {
+	if t.path == "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	raw, err := json.Marshal(t.usage)
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err == nil {
+		err = fileUtils.WriteAtomic(t.path, raw)
+	}
+	if err != nil {
+		t.mu.Lock()
+		t.dirty = true // Retry on the next save.
+		t.mu.Unlock()
+	}
+	return err
+}
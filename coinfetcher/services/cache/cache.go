@@ -0,0 +1,246 @@
+package cache_utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	coinService "coinfetcher/services/coin"
+	fileUtils "coinfetcher/services/file"
+	globalService "coinfetcher/services/global"
+	priceService "coinfetcher/services/price"
+	"coinfetcher/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheEntry holds a cached value together with the time it was stored.
+type cacheEntry[V any] struct {
+	value    V
+	storedAt time.Time
+}
+
+// ttlCache is a small concurrency-safe map whose entries expire after ttl.
+type ttlCache[K comparable, V any] struct {
+	name    string
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[K]cacheEntry[V]
+}
+
+// newTTLCache creates an empty cache whose entries live for ttl, and registers it under name.
+func newTTLCache[K comparable, V any](name string, ttl time.Duration) *ttlCache[K, V] {
+	c := &ttlCache[K, V]{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[K]cacheEntry[V]),
+	}
+	register(c)
+	return c
+}
+
+// get returns the value stored under key if it has not expired yet.
+func (c *ttlCache[K, V]) get(key K) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.storedAt) > c.ttl {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set stores value under key, replacing any previous entry.
+func (c *ttlCache[K, V]) set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry[V]{value: value, storedAt: time.Now()}
+}
+
+// persistedEntry is the on-disk form of a cache entry.
+type persistedEntry[V any] struct {
+	Value    V         `json:"value"`
+	StoredAt time.Time `json:"storedAt"`
+}
+
+// load reads previously saved entries from path, skipping the ones that have already expired.
+// A missing file is not an error; the cache simply starts empty.
+func (c *ttlCache[K, V]) load(path string) error {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var persisted map[K]persistedEntry[V]
+	if err := json.Unmarshal(raw, &persisted); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range persisted {
+		if time.Since(entry.StoredAt) <= c.ttl {
+			c.entries[key] = cacheEntry[V]{value: entry.Value, storedAt: entry.StoredAt}
+		}
+	}
+	return nil
+}
+
+// save writes every entry to path, replacing the file atomically.
+func (c *ttlCache[K, V]) save(path string) error {
+	c.mu.RLock()
+	persisted := make(map[K]persistedEntry[V], len(c.entries))
+	for key, entry := range c.entries {
+		persisted[key] = persistedEntry[V]{Value: entry.value, StoredAt: entry.storedAt}
+	}
+	c.mu.RUnlock()
+
+	raw, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+
+	return fileUtils.WriteAtomic(path, raw)
+}
+
+// PriceCacheName is the name the price cache is registered under.
+const PriceCacheName = "price"
+
+// Definition of the cachePriceService struct, which extends priceService.PriceFetcher.
+type cachePriceService struct {
+	next  priceService.PriceFetcher // The 'next' field holds an instance of the underlying price service.
+	cache *ttlCache[string, types.PriceResponse]
+}
+
+// Factory function to create a new cachePriceService instance.
+// It accepts the underlying price service and how long a quote stays fresh, and returns a priceService.PriceFetcher.
+func NewPriceCacheService(next priceService.PriceFetcher, ttl time.Duration) priceService.PriceFetcher {
+	return &cachePriceService{
+		next:  next,
+		cache: newTTLCache[string, types.PriceResponse](PriceCacheName, ttl),
+	}
+}
+
+// FetchPrice method of cachePriceService.
+// It serves a quote from the cache while fresh and delegates to the underlying service otherwise.
+func (s *cachePriceService) FetchPrice(ctx context.Context, ticker string) (float64, float64, time.Time, error) {
+	if price, ok := s.cache.get(ticker); ok {
+		return price.Price, price.Vol24Hr, price.Timestamp, nil
+	}
+
+	price, vol24Hr, timestamp, err := s.next.FetchPrice(ctx, ticker)
+	if err != nil {
+		return price, vol24Hr, timestamp, err
+	}
+
+	s.cache.set(ticker, types.PriceResponse{Ticker: ticker, Price: price, Timestamp: timestamp, Vol24Hr: vol24Hr})
+	return price, vol24Hr, timestamp, nil
+}
+
+// FetchPrices method of cachePriceService.
+// Batches always go to the underlying service, since their callers (such as the poller) want
+// the latest quotes, but the quotes they return refresh the cache for single lookups.
+func (s *cachePriceService) FetchPrices(ctx context.Context, tickers []string) ([]types.PriceResponse, error) {
+	prices, err := s.next.FetchPrices(ctx, tickers)
+	if err != nil {
+		return prices, err
+	}
+
+	for _, price := range prices {
+		s.cache.set(price.Ticker, price)
+	}
+	return prices, nil
+}
+
+// globalCacheKey is the single key used by the global market cache.
+const globalCacheKey = "global"
+
+// Definition of the cacheGlobalService struct, which extends globalService.GlobalFetcher.
+type cacheGlobalService struct {
+	next  globalService.GlobalFetcher // The 'next' field holds an instance of the underlying global service.
+	cache *ttlCache[string, types.GlobalMarketResponse]
+}
+
+// Factory function to create a new cacheGlobalService instance.
+// It accepts the underlying global service and how long a response stays fresh, and returns a globalService.GlobalFetcher.
+func NewGlobalCacheService(next globalService.GlobalFetcher, ttl time.Duration) globalService.GlobalFetcher {
+	return &cacheGlobalService{
+		next:  next,
+		cache: newTTLCache[string, types.GlobalMarketResponse]("global", ttl),
+	}
+}
+
+// FetchGlobal method of cacheGlobalService.
+// It serves global market data from the cache while fresh and delegates to the underlying service otherwise.
+func (s *cacheGlobalService) FetchGlobal(ctx context.Context) (types.GlobalMarketResponse, error) {
+	if global, ok := s.cache.get(globalCacheKey); ok {
+		return global, nil
+	}
+
+	global, err := s.next.FetchGlobal(ctx)
+	if err != nil {
+		return global, err
+	}
+
+	s.cache.set(globalCacheKey, global)
+	return global, nil
+}
+
+// Definition of the cacheCoinInfoService struct, which extends coinService.CoinInfoFetcher.
+type cacheCoinInfoService struct {
+	next        coinService.CoinInfoFetcher // The 'next' field holds an instance of the underlying coin info service.
+	cache       *ttlCache[string, types.CoinInfo]
+	persistPath string     // File the cache is persisted to; empty disables persistence.
+	saveMu      sync.Mutex // Serialises writes to persistPath.
+}
+
+// Factory function to create a new cacheCoinInfoService instance.
+// It accepts the underlying coin info service, how long metadata stays fresh and an optional file
+// to persist the cache to so restarts don't refetch. It returns a coinService.CoinInfoFetcher.
+func NewCoinInfoCacheService(next coinService.CoinInfoFetcher, ttl time.Duration, persistPath string) (coinService.CoinInfoFetcher, error) {
+	s := &cacheCoinInfoService{
+		next:        next,
+		cache:       newTTLCache[string, types.CoinInfo]("coininfo", ttl),
+		persistPath: persistPath,
+	}
+	if persistPath != "" {
+		if err := s.cache.load(persistPath); err != nil {
+			return nil, fmt.Errorf("failed to load coin info cache from %s: %v", persistPath, err)
+		}
+	}
+	return s, nil
+}
+
+// FetchCoinInfo method of cacheCoinInfoService.
+// It serves coin metadata from the cache while fresh and delegates to the underlying service otherwise.
+func (s *cacheCoinInfoService) FetchCoinInfo(ctx context.Context, id string) (types.CoinInfo, error) {
+	if info, ok := s.cache.get(id); ok {
+		return info, nil
+	}
+
+	info, err := s.next.FetchCoinInfo(ctx, id)
+	if err != nil {
+		return info, err
+	}
+
+	s.cache.set(id, info)
+	if s.persistPath != "" {
+		s.saveMu.Lock()
+		defer s.saveMu.Unlock()
+		// A failed save only costs a refetch after the next restart, so the response is still served.
+		if err := s.cache.save(s.persistPath); err != nil {
+			log.WithFields(log.Fields{"file": s.persistPath, "err": err}).Error("Error persisting coin info cache")
+		}
+	}
+	return info, nil
+}
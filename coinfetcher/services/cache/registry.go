@@ -0,0 +1,131 @@
+package cache_utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EntryInfo describes a cache entry without its value.
+type EntryInfo struct {
+	Key       string    `json:"key"`
+	StoredAt  time.Time `json:"storedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Expired   bool      `json:"expired"` // Expired entries are kept until they are overwritten or flushed.
+}
+
+// Cache is the operator's view of one of the caches created by this package.
+type Cache interface {
+	Name() string
+	TTL() time.Duration
+	Entries() []EntryInfo
+	Entry(key string) (interface{}, EntryInfo, bool)
+	Flush(key string) bool // Removes a single entry and reports whether it existed.
+	FlushAll() int         // Removes every entry and returns how many there were.
+}
+
+// registry holds every cache by name, so they can be inspected and flushed at runtime.
+var registry = struct {
+	sync.Mutex
+	caches map[string]Cache
+}{caches: make(map[string]Cache)}
+
+// register adds c to the registry, replacing an earlier cache of the same name.
+func register(c Cache) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.caches[c.Name()] = c
+}
+
+// Caches returns the registered caches sorted by name.
+func Caches() []Cache {
+	registry.Lock()
+	defer registry.Unlock()
+
+	caches := make([]Cache, 0, len(registry.caches))
+	for _, c := range registry.caches {
+		caches = append(caches, c)
+	}
+	sort.Slice(caches, func(i, j int) bool { return caches[i].Name() < caches[j].Name() })
+	return caches
+}
+
+// LookupCache returns the registered cache called name.
+func LookupCache(name string) (Cache, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	c, ok := registry.caches[name]
+	return c, ok
+}
+
+// Name returns the name the cache is registered under.
+func (c *ttlCache[K, V]) Name() string {
+	return c.name
+}
+
+// TTL returns how long entries stay fresh.
+func (c *ttlCache[K, V]) TTL() time.Duration {
+	return c.ttl
+}
+
+// Entries describes every entry, sorted by key.
+func (c *ttlCache[K, V]) Entries() []EntryInfo {
+	c.mu.RLock()
+	infos := make([]EntryInfo, 0, len(c.entries))
+	for key, entry := range c.entries {
+		infos = append(infos, c.info(key, entry))
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// Entry returns the value stored under the key whose string form is key.
+func (c *ttlCache[K, V]) Entry(key string) (interface{}, EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for k, entry := range c.entries {
+		if fmt.Sprint(k) == key {
+			return entry.value, c.info(k, entry), true
+		}
+	}
+	return nil, EntryInfo{}, false
+}
+
+// Flush removes the entry whose key has the string form key.
+func (c *ttlCache[K, V]) Flush(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if fmt.Sprint(k) == key {
+			delete(c.entries, k)
+			return true
+		}
+	}
+	return false
+}
+
+// FlushAll removes every entry.
+func (c *ttlCache[K, V]) FlushAll() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[K]cacheEntry[V])
+	return n
+}
+
+// info describes entry, stored under key. The caller must hold c.mu.
+func (c *ttlCache[K, V]) info(key K, entry cacheEntry[V]) EntryInfo {
+	expiresAt := entry.storedAt.Add(c.ttl)
+	return EntryInfo{
+		Key:       fmt.Sprint(key),
+		StoredAt:  entry.storedAt,
+		ExpiresAt: expiresAt,
+		Expired:   time.Now().After(expiresAt),
+	}
+}
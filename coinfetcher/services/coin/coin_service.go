@@ -0,0 +1,94 @@
+package coin_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// CoinInfoFetcher is an interface that can fetch coin metadata such as names, logos and links.
+type CoinInfoFetcher interface {
+	FetchCoinInfo(context.Context, string) (types.CoinInfo, error)
+}
+
+// coinInfoFetcher implements the CoinInfoFetcher interface.
+type coinInfoFetcher struct{}
+
+// NewCoinInfoFetcher creates a new instance of the CoinInfoFetcher.
+func NewCoinInfoFetcher() CoinInfoFetcher {
+	return &coinInfoFetcher{}
+}
+
+// FetchCoinInfo method of coinInfoFetcher.
+// It fetches coin metadata from the CoinGecko API for a given coin id.
+func (s *coinInfoFetcher) FetchCoinInfo(ctx context.Context, id string) (types.CoinInfo, error) {
+	if id == "" {
+		return types.CoinInfo{}, errors.New("coin id must not be empty")
+	}
+
+	// Skip every section of the coin document we don't expose to keep the response small.
+	query := url.Values{}
+	query.Set("localization", "false")
+	query.Set("tickers", "false")
+	query.Set("market_data", "false")
+	query.Set("community_data", "false")
+	query.Set("developer_data", "false")
+	query.Set("sparkline", "false")
+
+	var coin struct {
+		ID          string            `json:"id"`
+		Symbol      string            `json:"symbol"`
+		Name        string            `json:"name"`
+		Description map[string]string `json:"description"`
+		Image       types.CoinImage   `json:"image"`
+		Links       struct {
+			Homepage []string `json:"homepage"`
+		} `json:"links"`
+		Categories  []string          `json:"categories"`
+		GenesisDate string            `json:"genesis_date"`
+		Platforms   map[string]string `json:"platforms"`
+	}
+	if err := gecko.GetJSON(ctx, "/coins/"+url.PathEscape(id), query, &coin); err != nil {
+		return types.CoinInfo{}, fmt.Errorf("failed to fetch coin info: %w", err)
+	}
+
+	return types.CoinInfo{
+		ID:          coin.ID,
+		Symbol:      coin.Symbol,
+		Name:        coin.Name,
+		Description: coin.Description["en"],
+		Image:       coin.Image,
+		Homepage:    nonEmpty(coin.Links.Homepage),
+		Categories:  nonEmpty(coin.Categories),
+		GenesisDate: coin.GenesisDate,
+		Platforms:   contractPlatforms(coin.Platforms),
+	}, nil
+}
+
+// nonEmpty drops the blank entries CoinGecko pads its lists with.
+func nonEmpty(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// contractPlatforms keeps only the platforms that carry a contract address.
+// Native coins are reported by CoinGecko with an empty platform and address.
+func contractPlatforms(platforms map[string]string) map[string]string {
+	out := make(map[string]string, len(platforms))
+	for platform, address := range platforms {
+		if platform != "" && address != "" {
+			out[platform] = address
+		}
+	}
+	return out
+}
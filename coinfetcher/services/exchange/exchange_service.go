@@ -0,0 +1,125 @@
+package exchange_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// TickerFetcher is an interface that can fetch the per-exchange tickers of a coin.
+type TickerFetcher interface {
+	FetchTickers(context.Context, string) (types.TickersResponse, error)
+}
+
+// tickerFetcher implements the TickerFetcher interface.
+type tickerFetcher struct{}
+
+// NewTickerFetcher creates a new instance of the TickerFetcher.
+func NewTickerFetcher() TickerFetcher {
+	return &tickerFetcher{}
+}
+
+// FetchTickers method of tickerFetcher.
+// It fetches the exchange tickers of a coin from the CoinGecko API and summarises the best cross-venue prices.
+func (s *tickerFetcher) FetchTickers(ctx context.Context, id string) (types.TickersResponse, error) {
+	if id == "" {
+		return types.TickersResponse{}, errors.New("coin id must not be empty")
+	}
+
+	query := url.Values{}
+	query.Set("include_exchange_logo", "false")
+	query.Set("order", "volume_desc")
+
+	var resp struct {
+		Tickers []struct {
+			Base   string `json:"base"`
+			Target string `json:"target"`
+			Market struct {
+				Name       string `json:"name"`
+				Identifier string `json:"identifier"`
+			} `json:"market"`
+			ConvertedLast   map[string]float64 `json:"converted_last"`
+			ConvertedVolume map[string]float64 `json:"converted_volume"`
+			SpreadPct       float64            `json:"bid_ask_spread_percentage"`
+			TrustScore      string             `json:"trust_score"`
+			Timestamp       time.Time          `json:"timestamp"`
+			IsStale         bool               `json:"is_stale"`
+			IsAnomaly       bool               `json:"is_anomaly"`
+		} `json:"tickers"`
+	}
+	if err := gecko.GetJSON(ctx, "/coins/"+url.PathEscape(id)+"/tickers", query, &resp); err != nil {
+		return types.TickersResponse{}, fmt.Errorf("failed to fetch tickers: %w", err)
+	}
+
+	tickers := make([]types.ExchangeTicker, 0, len(resp.Tickers))
+	for _, t := range resp.Tickers {
+		if t.IsAnomaly {
+			continue // CoinGecko flags these as outliers; they would only produce fake spreads.
+		}
+
+		last := t.ConvertedLast["usd"]
+		bid, ask := estimateQuotes(last, t.SpreadPct)
+		tickers = append(tickers, types.ExchangeTicker{
+			Exchange:   t.Market.Name,
+			ExchangeID: t.Market.Identifier,
+			Base:       t.Base,
+			Target:     t.Target,
+			Last:       last,
+			Bid:        bid,
+			Ask:        ask,
+			SpreadPct:  t.SpreadPct,
+			Vol24Hr:    t.ConvertedVolume["usd"],
+			TrustScore: t.TrustScore,
+			Stale:      t.IsStale,
+			Timestamp:  t.Timestamp,
+		})
+	}
+
+	return types.TickersResponse{
+		ID:      id,
+		Tickers: tickers,
+		Summary: Summarize(tickers),
+	}, nil
+}
+
+// estimateQuotes derives bid and ask prices from the last USD price and the bid/ask spread percentage.
+// CoinGecko only publishes the spread, so the book is assumed to be centred on the last trade.
+func estimateQuotes(last, spreadPct float64) (bid, ask float64) {
+	half := last * spreadPct / 200
+	return last - half, last + half
+}
+
+// Summarize finds the best bid and best ask across venues and the spread between them.
+// Stale tickers and tickers without a price are ignored. A positive cross-venue spread means
+// the best bid is above the best ask, i.e. buying on one venue and selling on another is profitable before fees.
+func Summarize(tickers []types.ExchangeTicker) types.TickerSummary {
+	var summary types.TickerSummary
+	venues := make(map[string]bool)
+
+	for _, t := range tickers {
+		if t.Stale || t.Last <= 0 {
+			continue
+		}
+		venues[t.ExchangeID] = true
+
+		pair := t.Base + "/" + t.Target
+		if t.Bid > summary.BestBid.Price {
+			summary.BestBid = types.VenueQuote{Exchange: t.Exchange, Pair: pair, Price: t.Bid}
+		}
+		if summary.BestAsk.Price == 0 || t.Ask < summary.BestAsk.Price {
+			summary.BestAsk = types.VenueQuote{Exchange: t.Exchange, Pair: pair, Price: t.Ask}
+		}
+	}
+
+	summary.Venues = len(venues)
+	if summary.BestAsk.Price > 0 {
+		summary.CrossVenueSpreadPct = (summary.BestBid.Price - summary.BestAsk.Price) / summary.BestAsk.Price * 100
+		summary.Arbitrage = summary.CrossVenueSpreadPct > 0
+	}
+	return summary
+}
@@ -0,0 +1,30 @@
+package file_utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomicReplacesTheFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := os.ReadFile(path); err != nil || string(raw) != "new" {
+		t.Errorf("file = %q, %v, want %q", raw, err, "new")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d files, want the temporary file removed", len(entries))
+	}
+
+	// A failed write leaves nothing behind.
+	if err := WriteAtomic(filepath.Join(dir, "missing", "state.json"), []byte("new")); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+}
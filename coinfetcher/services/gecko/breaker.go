@@ -0,0 +1,174 @@
+package gecko_utils
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	StateClosed     = "closed"      // Requests flow; failures are counted.
+	StateOpen       = "open"        // Requests fail fast until the cooldown is over.
+	StateHalfOpen   = "half-open"   // A single trial request decides whether to close again.
+	StateForcedOpen = "forced-open" // Tripped by an operator; stays open until Reset.
+)
+
+// ErrCircuitOpen is returned instead of calling an upstream whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerStatus is a snapshot of a circuit breaker.
+type BreakerStatus struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`  // Consecutive failures counted while closed.
+	Threshold int        `json:"threshold"` // Failures that open the circuit.
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`
+}
+
+// Breaker stops calling an upstream after threshold consecutive failures, and lets a single
+// trial request through once cooldown has passed to find out whether it recovered.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial request is in flight.
+}
+
+// breakers holds every breaker by name, so they can be inspected and controlled at runtime.
+var breakers = struct {
+	sync.Mutex
+	byName map[string]*Breaker
+}{byName: make(map[string]*Breaker)}
+
+// NewBreaker creates a closed breaker and registers it under name.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: StateClosed}
+
+	breakers.Lock()
+	breakers.byName[name] = b
+	breakers.Unlock()
+	return b
+}
+
+// Breakers returns the registered breakers sorted by name.
+func Breakers() []*Breaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	list := make([]*Breaker, 0, len(breakers.byName))
+	for _, b := range breakers.byName {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// LookupBreaker returns the registered breaker called name.
+func LookupBreaker(name string) (*Breaker, bool) {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.byName[name]
+	return b, ok
+}
+
+// allow reports whether a request may go upstream. Every allowed request must be followed
+// by a call to done.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateForcedOpen:
+		return ErrCircuitOpen
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		fallthrough
+	case StateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen // Only one trial at a time.
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// done records the outcome of an allowed request. Requests cancelled by their caller say
+// nothing about the upstream and are neither successes nor failures.
+func (b *Breaker) done(failed, cancelled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasTrial := b.trial && b.state == StateHalfOpen
+	if wasTrial {
+		b.trial = false
+	}
+	if cancelled || b.state == StateForcedOpen {
+		return
+	}
+
+	switch {
+	case !failed:
+		b.state, b.failures = StateClosed, 0
+	case wasTrial:
+		b.state, b.openedAt = StateOpen, time.Now() // Still down; wait another cooldown.
+	case b.state == StateClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state, b.openedAt = StateOpen, time.Now()
+		}
+	}
+}
+
+// Trip forces the breaker open until Reset is called.
+func (b *Breaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.openedAt, b.trial = StateForcedOpen, time.Now(), false
+}
+
+// Reset closes the breaker and clears its failure count.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.trial = StateClosed, 0, false
+}
+
+// RetryAfter returns how long until the breaker lets a request through again, zero if it
+// already would. A breaker forced open reports its cooldown, as it is unknown when it is reset.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateForcedOpen:
+		return b.cooldown
+	case StateOpen:
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Status returns a snapshot of the breaker.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{Name: b.name, State: b.state, Failures: b.failures, Threshold: b.threshold}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,94 @@
+package gecko_utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	requestUtils "coinfetcher/services/request"
+)
+
+// BaseURL is the root of the public CoinGecko v3 API.
+const BaseURL = "https://api.coingecko.com/api/v3"
+
+// httpClient is shared by every CoinGecko call so connections are reused.
+var httpClient = &http.Client{Timeout: 10 * time.Second} // Add a timeout for the HTTP client.
+
+// breaker fails CoinGecko calls fast after repeated failures instead of piling up timeouts.
+var breaker = NewBreaker("coingecko", 5, 30*time.Second)
+
+// StatusError is returned when CoinGecko answers with a status other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // From the Retry-After header; zero if there was none.
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status code: %d", e.StatusCode)
+}
+
+// RetryAfter returns how long to wait before calling CoinGecko again after err, when err
+// says so: its circuit breaker is open, or it asked us to back off.
+func RetryAfter(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return breaker.RetryAfter(), true
+	case errors.As(err, &statusErr) && statusErr.RetryAfter > 0:
+		return statusErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// GetJSON performs a GET request against the CoinGecko API and decodes the JSON body into out.
+// The path is relative to BaseURL (for example "/coins/list") and query may be nil.
+func GetJSON(ctx context.Context, path string, query url.Values, out interface{}) error {
+	endpoint := BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	// Create the request bound to the caller's context so cancellations propagate upstream.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	// Forward the request ID so upstream calls can be correlated with ours.
+	if id := requestUtils.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestUtils.HeaderName, id)
+	}
+
+	if err := breaker.allow(); err != nil {
+		return fmt.Errorf("CoinGecko unavailable: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		breaker.done(true, ctx.Err() != nil)
+		return fmt.Errorf("HTTP request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Rate limiting and server errors mean CoinGecko is in trouble; other statuses are our request's fault.
+	breaker.done(resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, false)
+
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &StatusError{StatusCode: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			statusErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return statusErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode JSON response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package global_service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// othersSymbol is the dominance entry that groups every coin outside the configured set.
+const othersSymbol = "others"
+
+// GlobalFetcher is an interface that can fetch global cryptocurrency market data.
+type GlobalFetcher interface {
+	FetchGlobal(context.Context) (types.GlobalMarketResponse, error)
+}
+
+// globalFetcher implements the GlobalFetcher interface.
+type globalFetcher struct {
+	dominanceSymbols []string // Coins broken out individually in the dominance breakdown.
+}
+
+// NewGlobalFetcher creates a new instance of the GlobalFetcher.
+// dominanceSymbols lists the coin symbols (for example "btc", "eth") broken out in the dominance breakdown.
+func NewGlobalFetcher(dominanceSymbols []string) GlobalFetcher {
+	symbols := make([]string, 0, len(dominanceSymbols))
+	for _, symbol := range dominanceSymbols {
+		if symbol = strings.ToLower(strings.TrimSpace(symbol)); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return &globalFetcher{dominanceSymbols: symbols}
+}
+
+// FetchGlobal method of globalFetcher.
+// It fetches global market data from the CoinGecko API and computes the dominance breakdown.
+func (s *globalFetcher) FetchGlobal(ctx context.Context) (types.GlobalMarketResponse, error) {
+	var resp struct {
+		Data struct {
+			ActiveCryptocurrencies int                `json:"active_cryptocurrencies"`
+			Markets                int                `json:"markets"`
+			TotalMarketCap         map[string]float64 `json:"total_market_cap"`
+			TotalVolume            map[string]float64 `json:"total_volume"`
+			MarketCapPercentage    map[string]float64 `json:"market_cap_percentage"`
+			MarketCapChange24HrUSD float64            `json:"market_cap_change_percentage_24h_usd"`
+			UpdatedAt              int64              `json:"updated_at"`
+		} `json:"data"`
+	}
+	if err := gecko.GetJSON(ctx, "/global", nil, &resp); err != nil {
+		return types.GlobalMarketResponse{}, fmt.Errorf("failed to fetch global market data: %w", err)
+	}
+
+	data := resp.Data
+	totalMarketCap := data.TotalMarketCap["usd"]
+
+	return types.GlobalMarketResponse{
+		ActiveCryptocurrencies: data.ActiveCryptocurrencies,
+		Markets:                data.Markets,
+		TotalMarketCap:         totalMarketCap,
+		TotalVol24Hr:           data.TotalVolume["usd"],
+		MarketCapChange24Hr:    data.MarketCapChange24HrUSD,
+		BTCDominance:           data.MarketCapPercentage["btc"],
+		ETHDominance:           data.MarketCapPercentage["eth"],
+		Dominance:              s.dominance(data.MarketCapPercentage, totalMarketCap),
+		Timestamp:              time.Unix(data.UpdatedAt, 0).UTC(),
+	}, nil
+}
+
+// dominance breaks the total market cap down into the configured coins plus an "others" share.
+// Coins CoinGecko doesn't report a percentage for are folded into "others".
+func (s *globalFetcher) dominance(percentages map[string]float64, totalMarketCap float64) []types.DominanceShare {
+	shares := make([]types.DominanceShare, 0, len(s.dominanceSymbols)+1)
+	remaining := 100.0
+
+	for _, symbol := range s.dominanceSymbols {
+		pct, ok := percentages[symbol]
+		if !ok {
+			continue
+		}
+		remaining -= pct
+		shares = append(shares, types.DominanceShare{
+			Symbol:     symbol,
+			Percentage: pct,
+			MarketCap:  totalMarketCap * pct / 100,
+		})
+	}
+
+	if remaining < 0 {
+		remaining = 0 // Guard against rounding in the upstream percentages.
+	}
+	shares = append(shares, types.DominanceShare{
+		Symbol:     othersSymbol,
+		Percentage: remaining,
+		MarketCap:  totalMarketCap * remaining / 100,
+	})
+
+	return shares
+}
@@ -2,16 +2,11 @@ package health_service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
-)
 
-// Creating a structure for status data.
-var data struct {
-	GeckoStatus string `json:"gecko_says"`
-}
+	gecko "coinfetcher/services/gecko"
+)
 
 // HealthChecker is an interface that can check the health of a service.
 type HealthChecker interface {
@@ -30,37 +25,26 @@ func NewHealthChecker() HealthChecker {
 // It checks the health of the CoinGecko API by making an HTTP request.
 func (s *healthChecker) CheckHealth(ctx context.Context) (string, string, time.Time, error) {
 	// Call the CheckGeckoHealth function to check the health of the CoinGecko API.
-	status, geckoStatus, timestamp, err := CheckGeckoHealth()
+	status, geckoStatus, timestamp, err := CheckGeckoHealth(ctx)
 	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to fetch crypto price: %v", err)
+		return "", "", time.Time{}, fmt.Errorf("failed to fetch crypto price: %w", err)
 	}
 	return status, geckoStatus, timestamp, nil
 }
 
 // CheckGeckoHealth function checks the health of the CoinGecko API.
-func CheckGeckoHealth() (string, string, time.Time, error) {
-	const coingeckoAPI = "https://api.coingecko.com/api/v3/ping"
-
-	client := &http.Client{Timeout: 10 * time.Second} // Add a timeout for the HTTP client.
-
-	// Make a GET request to the CoinGecko API.
-	resp, err := client.Get(coingeckoAPI)
-	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("HTTP request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", "", time.Time{}, fmt.Errorf("HTTP request failed with status code: %d", resp.StatusCode)
+// The request is bound to ctx, which also carries the request ID forwarded upstream.
+func CheckGeckoHealth(ctx context.Context) (string, string, time.Time, error) {
+	// Creating a structure for status data.
+	var healthData struct {
+		GeckoStatus string `json:"gecko_says"`
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&data); err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to decode JSON response: %v", err)
+	// Make a GET request to the CoinGecko API.
+	if err := gecko.GetJSON(ctx, "/ping", nil, &healthData); err != nil {
+		return "", "", time.Time{}, err
 	}
 
-	healthData := data
-
 	unixTimeNow := time.Now().UTC().Unix()
 	geckoStatus := healthData.GeckoStatus
 
@@ -0,0 +1,74 @@
+package history_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// MaxDays is the longest history window that can be requested.
+const MaxDays = 365
+
+// HistoryFetcher is an interface that can fetch the price history of a coin.
+type HistoryFetcher interface {
+	FetchHistory(context.Context, string, int) (types.HistoryResponse, error)
+}
+
+// historyFetcher implements the HistoryFetcher interface.
+type historyFetcher struct{}
+
+// NewHistoryFetcher creates a new instance of the HistoryFetcher.
+func NewHistoryFetcher() HistoryFetcher {
+	return &historyFetcher{}
+}
+
+// FetchHistory method of historyFetcher.
+// It fetches the USD price, market cap and volume series of a coin over the last days from the CoinGecko API.
+func (s *historyFetcher) FetchHistory(ctx context.Context, id string, days int) (types.HistoryResponse, error) {
+	if id == "" {
+		return types.HistoryResponse{}, errors.New("coin id must not be empty")
+	}
+	if days < 1 || days > MaxDays {
+		return types.HistoryResponse{}, fmt.Errorf("days must be between 1 and %d", MaxDays)
+	}
+
+	query := url.Values{}
+	query.Set("vs_currency", "usd")
+	query.Set("days", strconv.Itoa(days))
+
+	// Every series is a list of [unix milliseconds, value] pairs sampled at the same instants.
+	var chart struct {
+		Prices       [][2]float64 `json:"prices"`
+		MarketCaps   [][2]float64 `json:"market_caps"`
+		TotalVolumes [][2]float64 `json:"total_volumes"`
+	}
+	if err := gecko.GetJSON(ctx, "/coins/"+url.PathEscape(id)+"/market_chart", query, &chart); err != nil {
+		return types.HistoryResponse{}, fmt.Errorf("failed to fetch price history: %w", err)
+	}
+
+	points := make([]types.HistoryPoint, len(chart.Prices))
+	for i, p := range chart.Prices {
+		points[i] = types.HistoryPoint{
+			Timestamp: time.UnixMilli(int64(p[0])).UTC(),
+			Price:     p[1],
+		}
+		if i < len(chart.MarketCaps) {
+			points[i].MarketCap = chart.MarketCaps[i][1]
+		}
+		if i < len(chart.TotalVolumes) {
+			points[i].Vol24Hr = chart.TotalVolumes[i][1]
+		}
+	}
+
+	return types.HistoryResponse{
+		ID:     id,
+		Days:   days,
+		Points: points,
+	}, nil
+}
@@ -2,11 +2,22 @@ package log_utils
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	// Importing service packages for health and price data.
+	authUtils "coinfetcher/services/auth"
+	coinService "coinfetcher/services/coin"
+	exchangeService "coinfetcher/services/exchange"
+	globalService "coinfetcher/services/global"
 	healthService "coinfetcher/services/health"
+	historyService "coinfetcher/services/history"
+	portfolioService "coinfetcher/services/portfolio"
 	priceService "coinfetcher/services/price"
+	requestUtils "coinfetcher/services/request"
+	searchService "coinfetcher/services/search"
+	tokenService "coinfetcher/services/token"
+	"coinfetcher/types"
 
 	log "github.com/sirupsen/logrus" // Importing the logrus package for logging.
 )
@@ -21,6 +32,46 @@ type logHealthService struct {
 	next healthService.HealthChecker // The 'next' field holds an instance of the underlying health service.
 }
 
+// Definition of the logSearchService struct, which extends searchService.CoinSearcher.
+type logSearchService struct {
+	next searchService.CoinSearcher // The 'next' field holds an instance of the underlying search service.
+}
+
+// Definition of the logGlobalService struct, which extends globalService.GlobalFetcher.
+type logGlobalService struct {
+	next globalService.GlobalFetcher // The 'next' field holds an instance of the underlying global service.
+}
+
+// Definition of the logCoinInfoService struct, which extends coinService.CoinInfoFetcher.
+type logCoinInfoService struct {
+	next coinService.CoinInfoFetcher // The 'next' field holds an instance of the underlying coin info service.
+}
+
+// Definition of the logTokenPriceService struct, which extends tokenService.TokenPriceFetcher.
+type logTokenPriceService struct {
+	next tokenService.TokenPriceFetcher // The 'next' field holds an instance of the underlying token price service.
+}
+
+// Definition of the logTickerService struct, which extends exchangeService.TickerFetcher.
+type logTickerService struct {
+	next exchangeService.TickerFetcher // The 'next' field holds an instance of the underlying ticker service.
+}
+
+// Definition of the logHistoryService struct, which extends historyService.HistoryFetcher.
+type logHistoryService struct {
+	next historyService.HistoryFetcher // The 'next' field holds an instance of the underlying history service.
+}
+
+// Definition of the logQuoteService struct, which extends priceService.QuoteFetcher.
+type logQuoteService struct {
+	next priceService.QuoteFetcher // The 'next' field holds an instance of the underlying quote service.
+}
+
+// Definition of the logPortfolioService struct, which extends portfolioService.PortfolioValuer.
+type logPortfolioService struct {
+	next portfolioService.PortfolioValuer // The 'next' field holds an instance of the underlying portfolio service.
+}
+
 // Factory function to create a new logPriceService instance.
 // It accepts the underlying price service as a parameter and returns a priceService.PriceFetcher.
 func NewPriceLogService(next priceService.PriceFetcher) priceService.PriceFetcher {
@@ -37,6 +88,70 @@ func NewHealthLogService(next healthService.HealthChecker) healthService.HealthC
 	}
 }
 
+// Factory function to create a new logSearchService instance.
+// It accepts the underlying search service as a parameter and returns a searchService.CoinSearcher.
+func NewSearchLogService(next searchService.CoinSearcher) searchService.CoinSearcher {
+	return &logSearchService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logGlobalService instance.
+// It accepts the underlying global service as a parameter and returns a globalService.GlobalFetcher.
+func NewGlobalLogService(next globalService.GlobalFetcher) globalService.GlobalFetcher {
+	return &logGlobalService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logCoinInfoService instance.
+// It accepts the underlying coin info service as a parameter and returns a coinService.CoinInfoFetcher.
+func NewCoinInfoLogService(next coinService.CoinInfoFetcher) coinService.CoinInfoFetcher {
+	return &logCoinInfoService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logTokenPriceService instance.
+// It accepts the underlying token price service as a parameter and returns a tokenService.TokenPriceFetcher.
+func NewTokenPriceLogService(next tokenService.TokenPriceFetcher) tokenService.TokenPriceFetcher {
+	return &logTokenPriceService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logTickerService instance.
+// It accepts the underlying ticker service as a parameter and returns a exchangeService.TickerFetcher.
+func NewTickerLogService(next exchangeService.TickerFetcher) exchangeService.TickerFetcher {
+	return &logTickerService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logHistoryService instance.
+// It accepts the underlying history service as a parameter and returns a historyService.HistoryFetcher.
+func NewHistoryLogService(next historyService.HistoryFetcher) historyService.HistoryFetcher {
+	return &logHistoryService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logQuoteService instance.
+// It accepts the underlying quote service as a parameter and returns a priceService.QuoteFetcher.
+func NewQuoteLogService(next priceService.QuoteFetcher) priceService.QuoteFetcher {
+	return &logQuoteService{
+		next: next,
+	}
+}
+
+// Factory function to create a new logPortfolioService instance.
+// It accepts the underlying portfolio service as a parameter and returns a portfolioService.PortfolioValuer.
+func NewPortfolioLogService(next portfolioService.PortfolioValuer) portfolioService.PortfolioValuer {
+	return &logPortfolioService{
+		next: next,
+	}
+}
+
 // FetchPrice method of logPriceService.
 // It fetches cryptocurrency price, logs metrics, and adds log entries with relevant information.
 func (s *logPriceService) FetchPrice(ctx context.Context, ticker string) (price float64, vol24Hr float64, timestamp time.Time, err error) {
@@ -47,12 +162,13 @@ func (s *logPriceService) FetchPrice(ctx context.Context, ticker string) (price
 
 	// Create log fields to store relevant information.
 	fields := log.Fields{
-		"requestID": ctx.Value("requestID"), // Context value, if available.
-		"took":      time.Since(begin),      // Time taken for the operation.
-		"err":       err,                    // Error, if any.
-		"price":     price,                  // Fetched price.
-		"vol24Hr":   vol24Hr,                // 24-hour volume.
-		"timestamp": timestamp,              // Price timestamp.
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"price":     price,                                  // Fetched price.
+		"vol24Hr":   vol24Hr,                                // 24-hour volume.
+		"timestamp": timestamp,                              // Price timestamp.
 	}
 
 	// Log the information using logrus with the "fetchPrice" log message.
@@ -61,6 +177,30 @@ func (s *logPriceService) FetchPrice(ctx context.Context, ticker string) (price
 	return price, vol24Hr, timestamp, err
 }
 
+// FetchPrices method of logPriceService.
+// It fetches several cryptocurrency prices at once and adds log entries with relevant information.
+func (s *logPriceService) FetchPrices(ctx context.Context, tickers []string) (prices []types.PriceResponse, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the price fetching to the underlying service.
+	prices, err = s.next.FetchPrices(ctx, tickers)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"tickers":   tickers,                                // Requested tickers.
+		"prices":    len(prices),                            // Number of prices found.
+	}
+
+	// Log the information using logrus with the "fetchPrices" log message.
+	log.WithFields(fields).Info("fetchPrices")
+
+	return prices, err
+}
+
 // CheckHealth method of logHealthService.
 // It checks the health of a service, logs metrics, and adds log entries with relevant information.
 func (s *logHealthService) CheckHealth(ctx context.Context) (status string, geckoStatus string, timestamp time.Time, err error) {
@@ -71,12 +211,13 @@ func (s *logHealthService) CheckHealth(ctx context.Context) (status string, geck
 
 	// Create log fields to store relevant information.
 	fields := log.Fields{
-		"requestID":   ctx.Value("requestID"), // Context value, if available.
-		"took":        time.Since(begin),      // Time taken for the operation.
-		"err":         err,                    // Error, if any.
-		"status":      status,                 // Service status.
-		"geckoStatus": geckoStatus,            // Gecko API status.
-		"timestamp":   timestamp,              // Check timestamp.
+		"requestID":   requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":     authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":        time.Since(begin),                      // Time taken for the operation.
+		"err":         err,                                    // Error, if any.
+		"status":      status,                                 // Service status.
+		"geckoStatus": geckoStatus,                            // Gecko API status.
+		"timestamp":   timestamp,                              // Check timestamp.
 	}
 
 	// Log the information using logrus with the "checkHealth" log message.
@@ -84,3 +225,202 @@ func (s *logHealthService) CheckHealth(ctx context.Context) (status string, geck
 
 	return status, geckoStatus, timestamp, err
 }
+
+// SearchCoins method of logSearchService.
+// It searches the coin index and adds log entries with relevant information.
+func (s *logSearchService) SearchCoins(ctx context.Context, query string, limit int) (coins []types.CoinMatch, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the search to the underlying service.
+	coins, err = s.next.SearchCoins(ctx, query, limit)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"query":     query,                                  // Search query.
+		"results":   len(coins),                             // Number of matches returned.
+	}
+
+	// Log the information using logrus with the "searchCoins" log message.
+	log.WithFields(fields).Info("searchCoins")
+
+	return coins, err
+}
+
+// FetchGlobal method of logGlobalService.
+// It fetches global market data and adds log entries with relevant information.
+func (s *logGlobalService) FetchGlobal(ctx context.Context) (global types.GlobalMarketResponse, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the fetching to the underlying service.
+	global, err = s.next.FetchGlobal(ctx)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID":      requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":        authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":           time.Since(begin),                      // Time taken for the operation.
+		"err":            err,                                    // Error, if any.
+		"totalMarketCap": global.TotalMarketCap,                  // Total market cap in USD.
+		"btcDominance":   global.BTCDominance,                    // Bitcoin dominance percentage.
+		"timestamp":      global.Timestamp,                       // Upstream update timestamp.
+	}
+
+	// Log the information using logrus with the "fetchGlobal" log message.
+	log.WithFields(fields).Info("fetchGlobal")
+
+	return global, err
+}
+
+// FetchCoinInfo method of logCoinInfoService.
+// It fetches coin metadata and adds log entries with relevant information.
+func (s *logCoinInfoService) FetchCoinInfo(ctx context.Context, id string) (info types.CoinInfo, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the fetching to the underlying service.
+	info, err = s.next.FetchCoinInfo(ctx, id)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"id":        id,                                     // Requested coin id.
+		"name":      info.Name,                              // Coin name.
+	}
+
+	// Log the information using logrus with the "fetchCoinInfo" log message.
+	log.WithFields(fields).Info("fetchCoinInfo")
+
+	return info, err
+}
+
+// FetchTokenPrices method of logTokenPriceService.
+// It fetches token prices by contract address and adds log entries with relevant information.
+func (s *logTokenPriceService) FetchTokenPrices(ctx context.Context, platform string, contracts []string) (prices []types.PriceResponse, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the price fetching to the underlying service.
+	prices, err = s.next.FetchTokenPrices(ctx, platform, contracts)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"platform":  platform,                               // Asset platform.
+		"contracts": len(contracts),                         // Number of requested contracts.
+		"prices":    len(prices),                            // Number of prices found.
+	}
+
+	// Log the information using logrus with the "fetchTokenPrices" log message.
+	log.WithFields(fields).Info("fetchTokenPrices")
+
+	return prices, err
+}
+
+// FetchTickers method of logTickerService.
+// It fetches exchange tickers and adds log entries with relevant information.
+func (s *logTickerService) FetchTickers(ctx context.Context, id string) (tickers types.TickersResponse, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the fetching to the underlying service.
+	tickers, err = s.next.FetchTickers(ctx, id)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID":           requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":             authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":                time.Since(begin),                      // Time taken for the operation.
+		"err":                 err,                                    // Error, if any.
+		"id":                  id,                                     // Requested coin id.
+		"tickers":             len(tickers.Tickers),                   // Number of exchange tickers.
+		"crossVenueSpreadPct": tickers.Summary.CrossVenueSpreadPct,    // Best bid vs best ask spread.
+	}
+
+	// Log the information using logrus with the "fetchTickers" log message.
+	log.WithFields(fields).Info("fetchTickers")
+
+	return tickers, err
+}
+
+// FetchHistory method of logHistoryService.
+// It fetches a coin's price history and adds log entries with relevant information.
+func (s *logHistoryService) FetchHistory(ctx context.Context, id string, days int) (history types.HistoryResponse, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the fetching to the underlying service.
+	history, err = s.next.FetchHistory(ctx, id, days)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"id":        id,                                     // Requested coin id.
+		"days":      days,                                   // Requested history window.
+		"points":    len(history.Points),                    // Number of data points returned.
+	}
+
+	// Log the information using logrus with the "fetchHistory" log message.
+	log.WithFields(fields).Info("fetchHistory")
+
+	return history, err
+}
+
+// FetchQuotes method of logQuoteService.
+// It fetches coin quotes in several currencies and adds log entries with relevant information.
+func (s *logQuoteService) FetchQuotes(ctx context.Context, ids []string, currencies []string) (quotes []types.Quote, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the fetching to the underlying service.
+	quotes, err = s.next.FetchQuotes(ctx, ids, currencies)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID":  requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":    authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":       time.Since(begin),                      // Time taken for the operation.
+		"err":        err,                                    // Error, if any.
+		"ids":        len(ids),                               // Number of requested coins.
+		"currencies": strings.Join(currencies, ","),          // Requested currencies.
+		"quotes":     len(quotes),                            // Number of quotes found.
+	}
+
+	// Log the information using logrus with the "fetchQuotes" log message.
+	log.WithFields(fields).Info("fetchQuotes")
+
+	return quotes, err
+}
+
+// ValuePortfolio method of logPortfolioService.
+// It values a portfolio and adds log entries with relevant information.
+func (s *logPortfolioService) ValuePortfolio(ctx context.Context, req types.PortfolioRequest) (valuation types.PortfolioValuation, err error) {
+	begin := time.Now() // Record the start time.
+
+	// Delegate the valuation to the underlying service.
+	valuation, err = s.next.ValuePortfolio(ctx, req)
+
+	// Create log fields to store relevant information.
+	fields := log.Fields{
+		"requestID": requestUtils.RequestIDFromContext(ctx), // Request ID, if available.
+		"subject":   authUtils.SubjectFromContext(ctx),      // Authenticated caller, if any.
+		"took":      time.Since(begin),                      // Time taken for the operation.
+		"err":       err,                                    // Error, if any.
+		"holdings":  len(req.Holdings),                      // Number of holdings valued.
+		"currency":  req.Currency,                           // Requested quote currency.
+		"stale":     len(valuation.Stale),                   // Number of coins with stale quotes.
+		"missing":   len(valuation.Missing),                 // Number of coins without a quote.
+	}
+
+	// Log the information using logrus with the "valuePortfolio" log message.
+	log.WithFields(fields).Info("valuePortfolio")
+
+	return valuation, err
+}
@@ -6,8 +6,16 @@ import (
 	"time"
 
 	// Importing service packages for health and price data.
+	coinService "coinfetcher/services/coin"
+	exchangeService "coinfetcher/services/exchange"
+	globalService "coinfetcher/services/global"
 	healthService "coinfetcher/services/health"
+	historyService "coinfetcher/services/history"
+	portfolioService "coinfetcher/services/portfolio"
 	priceService "coinfetcher/services/price"
+	searchService "coinfetcher/services/search"
+	tokenService "coinfetcher/services/token"
+	"coinfetcher/types"
 )
 
 // Definition of the metricPriceService struct, which extends priceService.PriceFetcher.
@@ -20,6 +28,46 @@ type metricHealthService struct {
 	next healthService.HealthChecker // The 'next' field holds an instance of the underlying health service.
 }
 
+// Definition of the metricSearchService struct, which extends searchService.CoinSearcher.
+type metricSearchService struct {
+	next searchService.CoinSearcher // The 'next' field holds an instance of the underlying search service.
+}
+
+// Definition of the metricGlobalService struct, which extends globalService.GlobalFetcher.
+type metricGlobalService struct {
+	next globalService.GlobalFetcher // The 'next' field holds an instance of the underlying global service.
+}
+
+// Definition of the metricCoinInfoService struct, which extends coinService.CoinInfoFetcher.
+type metricCoinInfoService struct {
+	next coinService.CoinInfoFetcher // The 'next' field holds an instance of the underlying coin info service.
+}
+
+// Definition of the metricTokenPriceService struct, which extends tokenService.TokenPriceFetcher.
+type metricTokenPriceService struct {
+	next tokenService.TokenPriceFetcher // The 'next' field holds an instance of the underlying token price service.
+}
+
+// Definition of the metricTickerService struct, which extends exchangeService.TickerFetcher.
+type metricTickerService struct {
+	next exchangeService.TickerFetcher // The 'next' field holds an instance of the underlying ticker service.
+}
+
+// Definition of the metricHistoryService struct, which extends historyService.HistoryFetcher.
+type metricHistoryService struct {
+	next historyService.HistoryFetcher // The 'next' field holds an instance of the underlying history service.
+}
+
+// Definition of the metricQuoteService struct, which extends priceService.QuoteFetcher.
+type metricQuoteService struct {
+	next priceService.QuoteFetcher // The 'next' field holds an instance of the underlying quote service.
+}
+
+// Definition of the metricPortfolioService struct, which extends portfolioService.PortfolioValuer.
+type metricPortfolioService struct {
+	next portfolioService.PortfolioValuer // The 'next' field holds an instance of the underlying portfolio service.
+}
+
 // Factory function to create a new metricPriceService instance.
 // It accepts the underlying price service as a parameter and returns a priceService.PriceFetcher.
 func NewPriceMetricService(next priceService.PriceFetcher) priceService.PriceFetcher {
@@ -36,6 +84,70 @@ func NewHealthMetricService(next healthService.HealthChecker) healthService.Heal
 	}
 }
 
+// Factory function to create a new metricSearchService instance.
+// It accepts the underlying search service as a parameter and returns a searchService.CoinSearcher.
+func NewSearchMetricService(next searchService.CoinSearcher) searchService.CoinSearcher {
+	return &metricSearchService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricGlobalService instance.
+// It accepts the underlying global service as a parameter and returns a globalService.GlobalFetcher.
+func NewGlobalMetricService(next globalService.GlobalFetcher) globalService.GlobalFetcher {
+	return &metricGlobalService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricCoinInfoService instance.
+// It accepts the underlying coin info service as a parameter and returns a coinService.CoinInfoFetcher.
+func NewCoinInfoMetricService(next coinService.CoinInfoFetcher) coinService.CoinInfoFetcher {
+	return &metricCoinInfoService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricTokenPriceService instance.
+// It accepts the underlying token price service as a parameter and returns a tokenService.TokenPriceFetcher.
+func NewTokenPriceMetricService(next tokenService.TokenPriceFetcher) tokenService.TokenPriceFetcher {
+	return &metricTokenPriceService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricTickerService instance.
+// It accepts the underlying ticker service as a parameter and returns a exchangeService.TickerFetcher.
+func NewTickerMetricService(next exchangeService.TickerFetcher) exchangeService.TickerFetcher {
+	return &metricTickerService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricHistoryService instance.
+// It accepts the underlying history service as a parameter and returns a historyService.HistoryFetcher.
+func NewHistoryMetricService(next historyService.HistoryFetcher) historyService.HistoryFetcher {
+	return &metricHistoryService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricQuoteService instance.
+// It accepts the underlying quote service as a parameter and returns a priceService.QuoteFetcher.
+func NewQuoteMetricService(next priceService.QuoteFetcher) priceService.QuoteFetcher {
+	return &metricQuoteService{
+		next: next,
+	}
+}
+
+// Factory function to create a new metricPortfolioService instance.
+// It accepts the underlying portfolio service as a parameter and returns a portfolioService.PortfolioValuer.
+func NewPortfolioMetricService(next portfolioService.PortfolioValuer) portfolioService.PortfolioValuer {
+	return &metricPortfolioService{
+		next: next,
+	}
+}
+
 // FetchPrice method of metricPriceService.
 // It fetches cryptocurrency price and logs metrics, delegating the actual fetching to the underlying service.
 func (s *metricPriceService) FetchPrice(ctx context.Context, ticker string) (price float64, vol24Hr float64, timestamp time.Time, err error) {
@@ -51,6 +163,21 @@ func (s *metricPriceService) FetchPrice(ctx context.Context, ticker string) (pri
 	return price, vol24Hr, timestamp, err
 }
 
+// FetchPrices method of metricPriceService.
+// It fetches several cryptocurrency prices at once and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricPriceService) FetchPrices(ctx context.Context, tickers []string) (prices []types.PriceResponse, err error) {
+	prices, err = s.next.FetchPrices(ctx, tickers) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching prices for tickers %v: %v\n", tickers, err)
+	} else {
+		fmt.Printf("Successfully fetched %d of %d prices:\n", len(prices), len(tickers))
+		for _, p := range prices {
+			fmt.Printf("Ticker: %s Price: %f 24-Hour Volume: %f\n", p.Ticker, p.Price, p.Vol24Hr)
+		}
+	}
+	return prices, err
+}
+
 // CheckHealth method of metricHealthService.
 // It checks the health of a service and logs metrics, delegating the actual check to the underlying service.
 func (s *metricHealthService) CheckHealth(ctx context.Context) (status string, geckoStatus string, timestamp time.Time, err error) {
@@ -65,3 +192,116 @@ func (s *metricHealthService) CheckHealth(ctx context.Context) (status string, g
 	}
 	return status, geckoStatus, timestamp, err
 }
+
+// SearchCoins method of metricSearchService.
+// It searches the coin index and logs metrics, delegating the actual search to the underlying service.
+func (s *metricSearchService) SearchCoins(ctx context.Context, query string, limit int) (coins []types.CoinMatch, err error) {
+	coins, err = s.next.SearchCoins(ctx, query, limit) // Delegates the search to the underlying service.
+	if err != nil {
+		fmt.Printf("Error searching coins for query %q: %v\n", query, err)
+	} else {
+		fmt.Printf("Successfully searched coins for query %q\n", query)
+		fmt.Printf("Matches: %d\n", len(coins))
+	}
+	return coins, err
+}
+
+// FetchGlobal method of metricGlobalService.
+// It fetches global market data and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricGlobalService) FetchGlobal(ctx context.Context) (global types.GlobalMarketResponse, err error) {
+	global, err = s.next.FetchGlobal(ctx) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching global market data: %v\n", err)
+	} else {
+		fmt.Printf("Successfully fetched global market data\n")
+		fmt.Printf("Total Market Cap: %f\n", global.TotalMarketCap)
+		fmt.Printf("24-Hour Volume: %f\n", global.TotalVol24Hr)
+		fmt.Printf("Active Coins: %d\n", global.ActiveCryptocurrencies)
+	}
+	return global, err
+}
+
+// FetchCoinInfo method of metricCoinInfoService.
+// It fetches coin metadata and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricCoinInfoService) FetchCoinInfo(ctx context.Context, id string) (info types.CoinInfo, err error) {
+	info, err = s.next.FetchCoinInfo(ctx, id) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching coin info for %s: %v\n", id, err)
+	} else {
+		fmt.Printf("Successfully fetched coin info for %s:\n", id)
+		fmt.Printf("Name: %s\n", info.Name)
+		fmt.Printf("Symbol: %s\n", info.Symbol)
+	}
+	return info, err
+}
+
+// FetchTokenPrices method of metricTokenPriceService.
+// It fetches token prices by contract address and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricTokenPriceService) FetchTokenPrices(ctx context.Context, platform string, contracts []string) (prices []types.PriceResponse, err error) {
+	prices, err = s.next.FetchTokenPrices(ctx, platform, contracts) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching token prices on %s: %v\n", platform, err)
+	} else {
+		fmt.Printf("Successfully fetched token prices on %s:\n", platform)
+		for _, p := range prices {
+			fmt.Printf("Contract: %s Price: %f 24-Hour Volume: %f\n", p.Ticker, p.Price, p.Vol24Hr)
+		}
+	}
+	return prices, err
+}
+
+// FetchTickers method of metricTickerService.
+// It fetches exchange tickers and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricTickerService) FetchTickers(ctx context.Context, id string) (tickers types.TickersResponse, err error) {
+	tickers, err = s.next.FetchTickers(ctx, id) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching tickers for %s: %v\n", id, err)
+	} else {
+		fmt.Printf("Successfully fetched tickers for %s:\n", id)
+		fmt.Printf("Venues: %d\n", tickers.Summary.Venues)
+		fmt.Printf("Best Bid: %f (%s)\n", tickers.Summary.BestBid.Price, tickers.Summary.BestBid.Exchange)
+		fmt.Printf("Best Ask: %f (%s)\n", tickers.Summary.BestAsk.Price, tickers.Summary.BestAsk.Exchange)
+		fmt.Printf("Cross-Venue Spread: %f%%\n", tickers.Summary.CrossVenueSpreadPct)
+	}
+	return tickers, err
+}
+
+// FetchHistory method of metricHistoryService.
+// It fetches a coin's price history and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricHistoryService) FetchHistory(ctx context.Context, id string, days int) (history types.HistoryResponse, err error) {
+	history, err = s.next.FetchHistory(ctx, id, days) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching %d day history for %s: %v\n", days, id, err)
+	} else {
+		fmt.Printf("Successfully fetched %d day history for %s:\n", days, id)
+		fmt.Printf("Points: %d\n", len(history.Points))
+	}
+	return history, err
+}
+
+// FetchQuotes method of metricQuoteService.
+// It fetches coin quotes in several currencies and logs metrics, delegating the actual fetching to the underlying service.
+func (s *metricQuoteService) FetchQuotes(ctx context.Context, ids []string, currencies []string) (quotes []types.Quote, err error) {
+	quotes, err = s.next.FetchQuotes(ctx, ids, currencies) // Delegates the fetching to the underlying service.
+	if err != nil {
+		fmt.Printf("Error fetching quotes for %d coins: %v\n", len(ids), err)
+	} else {
+		fmt.Printf("Successfully fetched %d quotes:\n", len(quotes))
+		for _, q := range quotes {
+			fmt.Printf("Ticker: %s Currency: %s Price: %f\n", q.Ticker, q.Currency, q.Price)
+		}
+	}
+	return quotes, err
+}
+
+// ValuePortfolio method of metricPortfolioService.
+// It values a portfolio and logs metrics, delegating the actual valuation to the underlying service.
+func (s *metricPortfolioService) ValuePortfolio(ctx context.Context, req types.PortfolioRequest) (valuation types.PortfolioValuation, err error) {
+	valuation, err = s.next.ValuePortfolio(ctx, req) // Delegates the valuation to the underlying service.
+	if err != nil {
+		fmt.Printf("Error valuing portfolio of %d holdings: %v\n", len(req.Holdings), err)
+	} else {
+		fmt.Printf("Successfully valued %d positions at %f %s\n", len(valuation.Positions), valuation.Total, valuation.Currency)
+	}
+	return valuation, err
+}
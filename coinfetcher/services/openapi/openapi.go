@@ -0,0 +1,630 @@
+package openapi_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"coinfetcher/types"
+)
+
+// maxBodyBytes caps the request bodies read for validation.
+const maxBodyBytes = 1 << 20
+
+// Where a parameter or value was found, as reported in types.FieldError.In.
+const (
+	InQuery  = "query"
+	InPath   = "path"
+	InHeader = "header"
+	InBody   = "body"
+)
+
+// document is the part of an OpenAPI 3 document the validator understands.
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*schema    `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+		Responses  map[string]*response  `json:"responses"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *requestBody         `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+// schema is the subset of JSON Schema used by the document.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // true, false or a schema.
+	Items                *schema            `json:"items"`
+	AllOf                []*schema          `json:"allOf"`
+
+	pattern    *regexp.Regexp
+	additional *schema
+}
+
+// pathItem is a path template of the document and its operations by lower-case method.
+type pathItem struct {
+	template   string
+	segments   []string
+	params     int // Number of "{param}" segments; literal matches are preferred.
+	operations map[string]*operation
+}
+
+// Validator checks requests and responses against an OpenAPI 3 document: required
+// parameters, types, enums, patterns, lengths and ranges.
+type Validator struct {
+	doc   document
+	paths []*pathItem
+}
+
+// NewValidator parses the OpenAPI 3 document spec.
+func NewValidator(spec []byte) (*Validator, error) {
+	v := &Validator{}
+	if err := json.Unmarshal(spec, &v.doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+
+	for template, item := range v.doc.Paths {
+		p := &pathItem{template: template, segments: splitPath(template), operations: make(map[string]*operation)}
+		for _, segment := range p.segments {
+			if isParam(segment) {
+				p.params++
+			}
+		}
+		for method, raw := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+			default:
+				continue // Summaries, descriptions and the like.
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %v", method, template, err)
+			}
+			for i, param := range op.Parameters {
+				resolved, err := v.parameter(param)
+				if err != nil {
+					return nil, fmt.Errorf("operation %s %s: %v", method, template, err)
+				}
+				op.Parameters[i] = resolved
+			}
+			p.operations[method] = &op
+		}
+		v.paths = append(v.paths, p)
+	}
+	sort.Slice(v.paths, func(i, j int) bool {
+		if v.paths[i].params != v.paths[j].params {
+			return v.paths[i].params < v.paths[j].params
+		}
+		return v.paths[i].template < v.paths[j].template
+	})
+
+	if err := v.compile(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parameter resolves a "#/components/parameters/..." reference.
+func (v *Validator) parameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	resolved, ok := v.doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+	}
+	return resolved, nil
+}
+
+// response resolves a "#/components/responses/..." reference.
+func (v *Validator) response(r *response) *response {
+	if r == nil || r.Ref == "" {
+		return r
+	}
+	return v.doc.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+}
+
+// schema resolves a "#/components/schemas/..." reference.
+func (v *Validator) schema(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		s = v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// compile checks the references and compiles the patterns of every schema in the document.
+func (v *Validator) compile() error {
+	seen := make(map[*schema]bool)
+	var walk func(s *schema) error
+	walk = func(s *schema) error {
+		if s == nil || seen[s] {
+			return nil
+		}
+		seen[s] = true
+		if s.Ref != "" {
+			if v.schema(s) == nil {
+				return fmt.Errorf("unknown schema %s", s.Ref)
+			}
+			return walk(v.schema(s))
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+			}
+			s.pattern = re
+		}
+		if raw := bytes.TrimSpace(s.AdditionalProperties); len(raw) > 0 && raw[0] == '{' {
+			s.additional = &schema{}
+			if err := json.Unmarshal(raw, s.additional); err != nil {
+				return fmt.Errorf("invalid additionalProperties: %v", err)
+			}
+		}
+		children := append([]*schema{s.Items, s.additional}, s.AllOf...)
+		for _, child := range s.Properties {
+			children = append(children, child)
+		}
+		for _, child := range children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, s := range v.doc.Components.Schemas {
+		if err := walk(s); err != nil {
+			return err
+		}
+	}
+	for _, p := range v.doc.Components.Parameters {
+		if err := walk(p.Schema); err != nil {
+			return err
+		}
+	}
+	for _, p := range v.paths {
+		for _, op := range p.operations {
+			for _, param := range op.Parameters {
+				if err := walk(param.Schema); err != nil {
+					return err
+				}
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					if err := walk(media.Schema); err != nil {
+						return err
+					}
+				}
+			}
+			for _, r := range op.Responses {
+				if r = v.response(r); r == nil {
+					return fmt.Errorf("operation on %s: unknown response", p.template)
+				}
+				for _, media := range r.Content {
+					if err := walk(media.Schema); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// operation returns the operation documented for method on path, with its path parameters.
+func (v *Validator) operation(method, path string) (*operation, map[string]string, bool) {
+	method = strings.ToLower(method)
+	if method == "head" {
+		method = "get"
+	}
+	segments := splitPath(path)
+	for _, p := range v.paths {
+		params, ok := matchPath(p.segments, segments)
+		if !ok {
+			continue
+		}
+		op, ok := p.operations[method]
+		return op, params, ok
+	}
+	return nil, nil, false
+}
+
+// Documented reports whether the document describes method on path.
+func (v *Validator) Documented(method, path string) bool {
+	_, _, ok := v.operation(method, path)
+	return ok
+}
+
+// ValidateRequest checks the query, path and header parameters and the JSON body of r
+// against its operation. Requests for undocumented operations are not checked. The body
+// is read and replaced, so handlers can still decode it.
+func (v *Validator) ValidateRequest(r *http.Request) []types.FieldError {
+	op, pathParams, ok := v.operation(r.Method, r.URL.Path)
+	if !ok {
+		return nil
+	}
+
+	var errs []types.FieldError
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var raw string
+		var present bool
+		switch param.In {
+		case InQuery:
+			if values, ok := query[param.Name]; ok {
+				raw, present = values[0], true
+			}
+		case InPath:
+			raw, present = pathParams[param.Name]
+		case InHeader:
+			if values := r.Header.Values(param.Name); len(values) > 0 {
+				raw, present = values[0], true
+			}
+		default:
+			continue
+		}
+
+		if !present {
+			if param.Required {
+				errs = append(errs, types.FieldError{In: param.In, Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		value, err := v.coerce(param.Schema, raw)
+		if err != nil {
+			errs = append(errs, types.FieldError{In: param.In, Field: param.Name, Message: err.Error()})
+			continue
+		}
+		v.validate(param.Schema, value, param.In, param.Name, &errs)
+	}
+
+	if op.RequestBody != nil {
+		errs = append(errs, v.validateBody(op.RequestBody, r)...)
+	}
+	return errs
+}
+
+// validateBody checks the JSON body of r against body.
+func (v *Validator) validateBody(body *requestBody, r *http.Request) []types.FieldError {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	media := jsonMediaType(body.Content, contentType)
+	if media == nil {
+		return nil // Not a format this validator understands; the handler decides.
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return []types.FieldError{{In: InBody, Message: "could not be read"}}
+	}
+	if len(raw) > maxBodyBytes {
+		return []types.FieldError{{In: InBody, Message: fmt.Sprintf("must be at most %d bytes", maxBodyBytes)}}
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if body.Required {
+			return []types.FieldError{{In: InBody, Message: "is required"}}
+		}
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return []types.FieldError{{In: InBody, Message: "must be valid JSON"}}
+	}
+	var errs []types.FieldError
+	v.validate(media.Schema, value, InBody, "", &errs)
+	return errs
+}
+
+// ValidateResponse checks a JSON response body of the operation documented for method
+// on path against the schema of its status code. Responses in other formats, and
+// responses of undocumented operations or status codes, are not checked.
+func (v *Validator) ValidateResponse(method, path string, status int, contentType string, body []byte) []types.FieldError {
+	op, _, ok := v.operation(method, path)
+	if !ok {
+		return nil
+	}
+	r, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		r, ok = op.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if !ok {
+		r, ok = op.Responses["default"]
+	}
+	if !ok {
+		return nil
+	}
+
+	media := jsonMediaType(v.response(r).Content, contentType)
+	if media == nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []types.FieldError{{In: InBody, Message: "must be valid JSON"}}
+	}
+	var errs []types.FieldError
+	v.validate(media.Schema, value, InBody, "", &errs)
+	return errs
+}
+
+// coerce converts the string value of a parameter to the type of s.
+func (v *Validator) coerce(s *schema, raw string) (interface{}, error) {
+	s = v.schema(s)
+	if s == nil {
+		return raw, nil
+	}
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return float64(n), nil
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// validate checks value, found at field, against s and appends the violations to errs.
+func (v *Validator) validate(s *schema, value interface{}, in, field string, errs *[]types.FieldError) {
+	s = v.schema(s)
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, types.FieldError{In: in, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil && s.Nullable {
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, in, field, errs)
+	}
+	if value == nil {
+		if s.Type != "" {
+			fail("must not be null")
+		}
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		options := make([]string, len(s.Enum))
+		for i, option := range s.Enum {
+			options[i] = fmt.Sprint(option)
+		}
+		fail("must be one of %s", strings.Join(options, ", "))
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must be at least %d characters long", *s.MinLength)
+			}
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && length > 0 && !s.pattern.MatchString(str) {
+			fail("must match %s", s.Pattern)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				fail("must be an RFC 3339 date and time")
+			}
+		}
+
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			fail("must be an integer")
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %s", formatNumber(*s.Minimum))
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be at most %s", formatNumber(*s.Maximum))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be true or false")
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			if *s.MinItems == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must have at least %d items", *s.MinItems)
+			}
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range items {
+			v.validate(s.Items, item, in, fmt.Sprintf("%s[%d]", field, i), errs)
+		}
+
+	case "object", "":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			if s.Type == "object" {
+				fail("must be an object")
+			}
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				*errs = append(*errs, types.FieldError{In: in, Field: join(field, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				v.validate(property, object[name], in, join(field, name), errs)
+			} else if s.additional != nil {
+				v.validate(s.additional, object[name], in, join(field, name), errs)
+			}
+		}
+	}
+}
+
+// jsonMediaType returns the JSON media type of content matching contentType, if any.
+func jsonMediaType(content map[string]*mediaType, contentType string) *mediaType {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	return content[mediaType]
+}
+
+// inEnum reports whether value is one of options.
+func inEnum(options []interface{}, value interface{}) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// formatNumber formats a schema bound without a needless fraction.
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// join appends a property name to a field path.
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// splitPath splits a URL path or path template into its segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// isParam reports whether a template segment is a "{param}".
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// matchPath matches path against a template and returns the captured parameters.
+func matchPath(template, path []string) (map[string]string, bool) {
+	if len(template) != len(path) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range template {
+		if isParam(segment) {
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
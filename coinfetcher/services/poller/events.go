@@ -0,0 +1,184 @@
+package poller_service
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"coinfetcher/types"
+)
+
+// PriceEvent is a price change recorded by the EventBroker. IDs increase monotonically.
+type PriceEvent struct {
+	ID    uint64
+	Price types.PriceResponse
+}
+
+// EventBroker turns the poller's quotes into a log of significant price changes.
+// A quote becomes an event when it moved by at least the threshold since the last
+// event of its ticker. The most recent events are kept in a bounded replay buffer
+// so clients can resume a stream from the last event they saw.
+type EventBroker struct {
+	poller       *Poller
+	thresholdPct float64
+	capacity     int
+
+	mu          sync.Mutex
+	sub         *Subscription
+	refs        map[string]int     // Number of listeners per watched ticker.
+	events      []PriceEvent       // Replay buffer, oldest first, at most capacity long.
+	nextID      uint64             // ID of the next recorded event.
+	lastEmitted map[string]float64 // Price of the last event per ticker.
+	listeners   map[chan struct{}]struct{}
+}
+
+// NewEventBroker creates a broker recording changes of at least thresholdPct percent
+// and keeping the last capacity events for replay.
+func NewEventBroker(poller *Poller, thresholdPct float64, capacity int) *EventBroker {
+	return &EventBroker{
+		poller:       poller,
+		thresholdPct: thresholdPct,
+		capacity:     capacity,
+		sub:          poller.Subscribe(),
+		refs:         make(map[string]int),
+		nextID:       1,
+		lastEmitted:  make(map[string]float64),
+		listeners:    make(map[chan struct{}]struct{}),
+	}
+}
+
+// Run records events from the poller until ctx is cancelled or the poller stops.
+func (b *EventBroker) Run(ctx context.Context) {
+	defer b.sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.sub.Done():
+			return
+		case <-b.sub.Ready():
+			b.record(b.sub.Drain())
+		}
+	}
+}
+
+// record appends the quotes that crossed the threshold to the replay buffer and wakes up listeners.
+func (b *EventBroker) record(prices []types.PriceResponse) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recorded := false
+	for _, price := range prices {
+		last, seen := b.lastEmitted[price.Ticker]
+		if seen && !b.crossed(last, price.Price) {
+			continue
+		}
+		b.lastEmitted[price.Ticker] = price.Price
+
+		b.events = append(b.events, PriceEvent{ID: b.nextID, Price: price})
+		b.nextID++
+		if len(b.events) > b.capacity {
+			b.events = b.events[len(b.events)-b.capacity:]
+		}
+		recorded = true
+	}
+
+	if recorded {
+		for ch := range b.listeners {
+			select {
+			case ch <- struct{}{}:
+			default: // Already notified.
+			}
+		}
+	}
+}
+
+// crossed reports whether the move from last to price reaches the threshold.
+func (b *EventBroker) crossed(last, price float64) bool {
+	if last == 0 {
+		return price != 0
+	}
+	return math.Abs(price-last)/math.Abs(last)*100 >= b.thresholdPct
+}
+
+// Watch starts recording events for tickers. The returned function stops watching them again.
+func (b *EventBroker) Watch(tickers []string) (release func()) {
+	// The subscription is updated under b.mu so concurrent watches and releases can't reorder.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var added []string
+	for _, ticker := range tickers {
+		if b.refs[ticker] == 0 {
+			added = append(added, ticker)
+		}
+		b.refs[ticker]++
+	}
+	if len(added) > 0 {
+		b.sub.Watch(added...)
+	}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		var removed []string
+		for _, ticker := range tickers {
+			if b.refs[ticker]--; b.refs[ticker] <= 0 {
+				delete(b.refs, ticker)
+				removed = append(removed, ticker)
+			}
+		}
+		if len(removed) > 0 {
+			b.sub.Unwatch(removed...)
+		}
+	}
+}
+
+// Listen returns a channel signalled whenever new events were recorded, and a function to stop listening.
+func (b *EventBroker) Listen() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.listeners[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.listeners, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Since returns the buffered events after lastID for the given tickers.
+// complete is false when events after lastID have already been evicted from the
+// buffer, or when lastID was never issued (for example by a previous server run).
+func (b *EventBroker) Since(lastID uint64, tickers map[string]bool) (events []PriceEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID >= b.nextID {
+		return nil, false
+	}
+
+	complete = len(b.events) == 0 || b.events[0].ID <= lastID+1
+	for _, e := range b.events {
+		if e.ID > lastID && tickers[e.Price.Ticker] {
+			events = append(events, e)
+		}
+	}
+	return events, complete
+}
+
+// LastID returns the ID of the most recent event, or 0 if none was recorded yet.
+func (b *EventBroker) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID - 1
+}
+
+// Done is closed when the underlying poller stops.
+func (b *EventBroker) Done() <-chan struct{} {
+	return b.poller.done
+}
@@ -0,0 +1,317 @@
+package poller_service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	priceService "coinfetcher/services/price"
+	"coinfetcher/types"
+)
+
+// Poller periodically fetches the prices of every ticker watched by its subscriptions
+// with a single batched request, and pushes the quotes that changed to the subscribers.
+type Poller struct {
+	fetcher  priceService.PriceFetcher
+	interval time.Duration
+
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	latest        map[string]types.PriceResponse
+	watchlist     map[string]bool // Tickers polled even when nobody subscribed to them.
+	paused        bool
+
+	kick chan struct{} // Asks the poll loop to poll right away, e.g. for a newly watched ticker.
+	done chan struct{} // Closed when Run returns.
+	once sync.Once
+}
+
+// NewPoller creates a poller fetching prices through fetcher every interval.
+func NewPoller(fetcher priceService.PriceFetcher, interval time.Duration) *Poller {
+	return &Poller{
+		fetcher:       fetcher,
+		interval:      interval,
+		subscriptions: make(map[*Subscription]struct{}),
+		latest:        make(map[string]types.PriceResponse),
+		watchlist:     make(map[string]bool),
+		kick:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// Run polls until ctx is cancelled, then signals Done on every subscription.
+func (p *Poller) Run(ctx context.Context) {
+	defer p.stop()
+
+	timer := time.NewTicker(p.interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-p.kick:
+		}
+		p.poll(ctx)
+	}
+}
+
+// stop wakes up every subscriber waiting on Done.
+func (p *Poller) stop() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// poll fetches the watched tickers and delivers the quotes that changed since the last poll.
+func (p *Poller) poll(ctx context.Context) {
+	if p.Paused() {
+		return
+	}
+	tickers := p.watched()
+	if len(tickers) == 0 {
+		return
+	}
+
+	prices, err := p.fetcher.FetchPrices(ctx, tickers)
+	if err != nil {
+		return // The decorators already logged it; the next tick retries.
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, price := range prices {
+		previous, seen := p.latest[price.Ticker]
+		p.latest[price.Ticker] = price
+		if seen && previous.Price == price.Price && previous.Timestamp.Equal(price.Timestamp) {
+			continue // Nothing new for this ticker.
+		}
+		for sub := range p.subscriptions {
+			sub.deliver(price)
+		}
+	}
+}
+
+// watched returns the sorted union of the watchlist and the tickers watched by all subscriptions.
+func (p *Poller) watched() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set := make(map[string]bool, len(p.watchlist))
+	for ticker := range p.watchlist {
+		set[ticker] = true
+	}
+	for sub := range p.subscriptions {
+		for _, ticker := range sub.Tickers() {
+			set[ticker] = true
+		}
+	}
+
+	tickers := make([]string, 0, len(set))
+	for ticker := range set {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// Latest returns the most recent quote polled for ticker.
+func (p *Poller) Latest(ticker string) (types.PriceResponse, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	price, ok := p.latest[ticker]
+	return price, ok
+}
+
+// Watchlist returns the sorted tickers polled regardless of subscriptions.
+func (p *Poller) Watchlist() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tickers := make([]string, 0, len(p.watchlist))
+	for ticker := range p.watchlist {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// AddToWatchlist makes the poller poll tickers even when no subscription watches them,
+// so their latest quotes are always at hand.
+func (p *Poller) AddToWatchlist(tickers ...string) {
+	p.mu.Lock()
+	for _, ticker := range tickers {
+		p.watchlist[ticker] = true
+	}
+	p.mu.Unlock()
+
+	p.requestPoll()
+}
+
+// RemoveFromWatchlist stops polling tickers on their own. Subscriptions watching them are not affected.
+func (p *Poller) RemoveFromWatchlist(tickers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, ticker := range tickers {
+		delete(p.watchlist, ticker)
+	}
+}
+
+// Pause stops polling until Resume is called. Subscribers keep their subscriptions but get no updates.
+func (p *Poller) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+}
+
+// Resume restarts polling after Pause, polling right away.
+func (p *Poller) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.mu.Unlock()
+
+	p.requestPoll()
+}
+
+// Paused reports whether polling is paused.
+func (p *Poller) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// Subscribe creates a subscription with no watched tickers.
+func (p *Poller) Subscribe() *Subscription {
+	sub := &Subscription{
+		poller:  p,
+		tickers: make(map[string]bool),
+		pending: make(map[string]types.PriceResponse),
+		ready:   make(chan struct{}, 1),
+	}
+
+	p.mu.Lock()
+	p.subscriptions[sub] = struct{}{}
+	p.mu.Unlock()
+
+	return sub
+}
+
+// requestPoll asks the poll loop to poll as soon as possible.
+func (p *Poller) requestPoll() {
+	select {
+	case p.kick <- struct{}{}:
+	default: // A poll is already pending.
+	}
+}
+
+// Subscription receives the quotes of the tickers it watches.
+// Quotes are coalesced per ticker, so a slow consumer only ever sees the latest
+// value of each ticker instead of building an unbounded backlog.
+type Subscription struct {
+	poller *Poller
+
+	mu      sync.Mutex
+	tickers map[string]bool
+	pending map[string]types.PriceResponse
+	ready   chan struct{}
+}
+
+// Watch adds tickers to the subscription and returns the snapshot of the ones already known.
+func (s *Subscription) Watch(tickers ...string) []types.PriceResponse {
+	s.mu.Lock()
+	for _, ticker := range tickers {
+		s.tickers[ticker] = true
+	}
+	s.mu.Unlock()
+
+	var snapshot []types.PriceResponse
+	unknown := false
+	for _, ticker := range tickers {
+		if price, ok := s.poller.Latest(ticker); ok {
+			snapshot = append(snapshot, price)
+		} else {
+			unknown = true
+		}
+	}
+	if unknown {
+		s.poller.requestPoll() // Don't make new tickers wait a full interval.
+	}
+	return snapshot
+}
+
+// Unwatch removes tickers from the subscription.
+func (s *Subscription) Unwatch(tickers ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ticker := range tickers {
+		delete(s.tickers, ticker)
+		delete(s.pending, ticker)
+	}
+}
+
+// Tickers returns the sorted list of watched tickers.
+func (s *Subscription) Tickers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tickers := make([]string, 0, len(s.tickers))
+	for ticker := range s.tickers {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// Ready is signalled whenever new quotes are waiting to be drained.
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed when the poller stops; no more quotes will arrive.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.poller.done
+}
+
+// Drain returns and clears the pending quotes, sorted by ticker.
+func (s *Subscription) Drain() []types.PriceResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prices := make([]types.PriceResponse, 0, len(s.pending))
+	for _, price := range s.pending {
+		prices = append(prices, price)
+	}
+	s.pending = make(map[string]types.PriceResponse)
+
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Ticker < prices[j].Ticker })
+	return prices
+}
+
+// Close detaches the subscription from the poller.
+func (s *Subscription) Close() {
+	s.poller.mu.Lock()
+	delete(s.poller.subscriptions, s)
+	s.poller.mu.Unlock()
+}
+
+// deliver queues price if the subscription watches its ticker. It never blocks.
+func (s *Subscription) deliver(price types.PriceResponse) {
+	s.mu.Lock()
+	if !s.tickers[price.Ticker] {
+		s.mu.Unlock()
+		return
+	}
+	s.pending[price.Ticker] = price // Replaces any quote the consumer hasn't read yet.
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default: // The consumer has already been notified.
+	}
+}
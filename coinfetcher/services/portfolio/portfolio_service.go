@@ -0,0 +1,166 @@
+package portfolio_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	priceService "coinfetcher/services/price"
+	"coinfetcher/types"
+)
+
+// MaxHoldings is the largest number of holdings valued at once.
+const MaxHoldings = 200
+
+// DefaultCurrency is the quote currency used when a request names none.
+const DefaultCurrency = "usd"
+
+var (
+	coinPattern     = regexp.MustCompile(`^[a-z0-9._-]+$`)
+	currencyPattern = regexp.MustCompile(`^[a-z]{2,10}$`)
+)
+
+// PortfolioValuer is an interface that can value a portfolio of coin holdings.
+type PortfolioValuer interface {
+	ValuePortfolio(context.Context, types.PortfolioRequest) (types.PortfolioValuation, error)
+}
+
+// portfolioValuer implements the PortfolioValuer interface on top of a QuoteFetcher.
+type portfolioValuer struct {
+	quotes     priceService.QuoteFetcher
+	staleAfter time.Duration // Age beyond which a quote is reported as stale.
+}
+
+// NewPortfolioValuer creates a new instance of the PortfolioValuer. Quotes last updated
+// more than staleAfter ago are reported as stale.
+func NewPortfolioValuer(quotes priceService.QuoteFetcher, staleAfter time.Duration) PortfolioValuer {
+	return &portfolioValuer{quotes: quotes, staleAfter: staleAfter}
+}
+
+// NormalizeRequest lowercases the coins and currency of req, fills in the default currency
+// and checks that every holding can be valued.
+func NormalizeRequest(req types.PortfolioRequest) (types.PortfolioRequest, error) {
+	req.Currency = strings.ToLower(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = DefaultCurrency
+	}
+	if !currencyPattern.MatchString(req.Currency) {
+		return req, fmt.Errorf("currency %q is not a currency code", req.Currency)
+	}
+	if len(req.Holdings) == 0 {
+		return req, errors.New("at least one holding is required")
+	}
+	if len(req.Holdings) > MaxHoldings {
+		return req, fmt.Errorf("at most %d holdings can be valued at once", MaxHoldings)
+	}
+
+	holdings := make([]types.Holding, len(req.Holdings))
+	for i, h := range req.Holdings {
+		h.Coin = strings.ToLower(strings.TrimSpace(h.Coin))
+		if !coinPattern.MatchString(h.Coin) {
+			return req, fmt.Errorf("holdings[%d]: coin must be a CoinGecko coin ID", i)
+		}
+		if h.Amount < 0 || math.IsInf(h.Amount, 0) || math.IsNaN(h.Amount) {
+			return req, fmt.Errorf("holdings[%d]: amount must not be negative", i)
+		}
+		if h.TotalCost != nil && (*h.TotalCost < 0 || math.IsInf(*h.TotalCost, 0) || math.IsNaN(*h.TotalCost)) {
+			return req, fmt.Errorf("holdings[%d]: totalCost must not be negative", i)
+		}
+		holdings[i] = h
+	}
+	req.Holdings = holdings
+	return req, nil
+}
+
+// ValuePortfolio method of portfolioValuer.
+// It fetches the quotes of every coin held with a single batched request and values each
+// position in the quote currency. Coins CoinGecko has no quote for are reported as missing
+// and left out of the total.
+func (s *portfolioValuer) ValuePortfolio(ctx context.Context, req types.PortfolioRequest) (types.PortfolioValuation, error) {
+	req, err := NormalizeRequest(req)
+	if err != nil {
+		return types.PortfolioValuation{}, err
+	}
+
+	// De-duplicate the coins, keeping the caller's order; a coin may be held in several positions.
+	var ids []string
+	seen := make(map[string]bool, len(req.Holdings))
+	for _, h := range req.Holdings {
+		if !seen[h.Coin] {
+			seen[h.Coin] = true
+			ids = append(ids, h.Coin)
+		}
+	}
+
+	quotes, err := s.quotes.FetchQuotes(ctx, ids, []string{req.Currency})
+	if err != nil {
+		return types.PortfolioValuation{}, err
+	}
+	byCoin := make(map[string]types.Quote, len(quotes))
+	for _, q := range quotes {
+		byCoin[q.Ticker] = q
+	}
+
+	now := time.Now().UTC()
+	valuation := types.PortfolioValuation{
+		Currency:  req.Currency,
+		Positions: make([]types.PositionValue, 0, len(req.Holdings)),
+		Stale:     []string{},
+		Missing:   []string{},
+		Timestamp: now,
+	}
+	var totalCost, pnl float64
+	var withCost int
+	reported := make(map[string]bool)
+	for _, h := range req.Holdings {
+		quote, ok := byCoin[h.Coin]
+		if !ok {
+			if !reported[h.Coin] {
+				reported[h.Coin] = true
+				valuation.Missing = append(valuation.Missing, h.Coin)
+			}
+			continue
+		}
+
+		position := types.PositionValue{
+			Coin:           h.Coin,
+			Amount:         h.Amount,
+			Price:          quote.Price,
+			Value:          h.Amount * quote.Price,
+			TotalCost:      h.TotalCost,
+			QuoteTimestamp: quote.Timestamp,
+			Stale:          now.Sub(quote.Timestamp) > s.staleAfter,
+		}
+		if position.Stale && !reported[h.Coin] {
+			reported[h.Coin] = true
+			valuation.Stale = append(valuation.Stale, h.Coin)
+		}
+		if h.TotalCost != nil {
+			positionPnl := position.Value - *h.TotalCost
+			position.UnrealisedPnl = &positionPnl
+			if *h.TotalCost > 0 {
+				pct := positionPnl / *h.TotalCost * 100
+				position.UnrealisedPnlPct = &pct
+			}
+			totalCost += *h.TotalCost
+			pnl += positionPnl
+			withCost++
+		}
+		valuation.Total += position.Value
+		valuation.Positions = append(valuation.Positions, position)
+	}
+
+	for i := range valuation.Positions {
+		if valuation.Total > 0 {
+			valuation.Positions[i].WeightPct = valuation.Positions[i].Value / valuation.Total * 100
+		}
+	}
+	if withCost > 0 {
+		valuation.TotalCost, valuation.UnrealisedPnl = &totalCost, &pnl
+	}
+	return valuation, nil
+}
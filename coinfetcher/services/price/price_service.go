@@ -2,23 +2,23 @@ package price_service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
 )
 
-// Creating a map structure to store data fetched from the CoinGecko API.
-var data map[string]struct {
-	USD           float64 `json:"usd"`
-	LastUpdatedAt int64   `json:"last_updated_at"`
-	Vol24Hr       float64 `json:"usd_24h_vol"`
-}
+// ErrTickerNotFound is returned when CoinGecko has no price data for the requested ticker.
+var ErrTickerNotFound = errors.New("could not find data for ticker")
 
 // PriceFetcher is an interface that can fetch cryptocurrency prices.
 type PriceFetcher interface {
 	FetchPrice(context.Context, string) (float64, float64, time.Time, error)
+	FetchPrices(context.Context, []string) ([]types.PriceResponse, error)
 }
 
 // priceFetcher implements the PriceFetcher interface.
@@ -32,38 +32,35 @@ func NewPriceFetcher() PriceFetcher {
 // FetchPrice method of priceFetcher.
 // It fetches cryptocurrency price data from the CoinGecko API for a given ticker.
 func (s *priceFetcher) FetchPrice(ctx context.Context, ticker string) (float64, float64, time.Time, error) {
-	price, vol24Hr, timestamp, err := FetchCryptoPrice(ticker)
+	price, vol24Hr, timestamp, err := FetchCryptoPrice(ctx, ticker)
 	if err != nil {
-		return 0, 0, time.Time{}, fmt.Errorf("failed to fetch crypto price: %v", err)
+		return 0, 0, time.Time{}, fmt.Errorf("failed to fetch crypto price: %w", err)
 	}
 	return price, vol24Hr, timestamp, nil
 }
 
-// FetchCryptoPrice function retrieves cryptocurrency price data from the CoinGecko API.
-func FetchCryptoPrice(ticker string) (float64, float64, time.Time, error) {
-	const coingeckoAPI = "https://api.coingecko.com/api/v3/simple/price"
-
-	client := &http.Client{Timeout: 10 * time.Second} // Add a timeout for the HTTP client.
-
-	// Make a GET request to the CoinGecko API to fetch cryptocurrency price data.
-	resp, err := client.Get(fmt.Sprintf("%s?ids=%s&vs_currencies=usd&include_24hr_vol=true&include_last_updated_at=true", coingeckoAPI, ticker))
+// FetchPrices method of priceFetcher.
+// It fetches the price data of several tickers with a single CoinGecko request.
+// Tickers CoinGecko has no data for are left out of the result.
+func (s *priceFetcher) FetchPrices(ctx context.Context, tickers []string) ([]types.PriceResponse, error) {
+	prices, err := FetchCryptoPrices(ctx, tickers)
 	if err != nil {
-		return 0, 0, time.Time{}, fmt.Errorf("HTTP request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, 0, time.Time{}, fmt.Errorf("HTTP request failed with status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to fetch crypto prices: %w", err)
 	}
+	return prices, nil
+}
 
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&data); err != nil {
-		return 0, 0, time.Time{}, fmt.Errorf("failed to decode JSON response: %v", err)
+// FetchCryptoPrice function retrieves cryptocurrency price data from the CoinGecko API.
+// The request is bound to ctx, which also carries the request ID forwarded upstream.
+func FetchCryptoPrice(ctx context.Context, ticker string) (float64, float64, time.Time, error) {
+	data, err := fetchSimplePrices(ctx, []string{ticker})
+	if err != nil {
+		return 0, 0, time.Time{}, err
 	}
 
 	priceData, ok := data[ticker]
 	if !ok {
-		return 0, 0, time.Time{}, errors.New("could not find data for ticker")
+		return 0, 0, time.Time{}, ErrTickerNotFound
 	}
 
 	price := priceData.USD
@@ -72,3 +69,55 @@ func FetchCryptoPrice(ticker string) (float64, float64, time.Time, error) {
 
 	return price, vol24Hr, timestamp, nil
 }
+
+// FetchCryptoPrices function retrieves the price data of several tickers from the CoinGecko API in one request.
+func FetchCryptoPrices(ctx context.Context, tickers []string) ([]types.PriceResponse, error) {
+	if len(tickers) == 0 {
+		return nil, errors.New("at least one ticker is required")
+	}
+
+	data, err := fetchSimplePrices(ctx, tickers)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make([]types.PriceResponse, 0, len(tickers))
+	for _, ticker := range tickers {
+		priceData, ok := data[ticker]
+		if !ok {
+			continue
+		}
+		prices = append(prices, types.PriceResponse{
+			Ticker:    ticker,
+			Price:     priceData.USD,
+			Timestamp: time.Unix(priceData.LastUpdatedAt, 0),
+			Vol24Hr:   priceData.Vol24Hr,
+		})
+	}
+	return prices, nil
+}
+
+// simplePrice is the per-coin entry of CoinGecko's "simple/price" response.
+type simplePrice struct {
+	USD           float64 `json:"usd"`
+	LastUpdatedAt int64   `json:"last_updated_at"`
+	Vol24Hr       float64 `json:"usd_24h_vol"`
+}
+
+// fetchSimplePrices calls CoinGecko's "simple/price" endpoint for the given coin ids.
+func fetchSimplePrices(ctx context.Context, tickers []string) (map[string]simplePrice, error) {
+	query := url.Values{}
+	query.Set("ids", strings.Join(tickers, ","))
+	query.Set("vs_currencies", "usd")
+	query.Set("include_24hr_vol", "true")
+	query.Set("include_last_updated_at", "true")
+
+	// Creating a map structure to store data fetched from the CoinGecko API.
+	var data map[string]simplePrice
+
+	// Make a GET request to the CoinGecko API to fetch cryptocurrency price data.
+	if err := gecko.GetJSON(ctx, "/simple/price", query, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
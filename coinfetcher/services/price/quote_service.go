@@ -0,0 +1,74 @@
+package price_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// QuoteFetcher is an interface that can fetch coin quotes in several currencies at once.
+type QuoteFetcher interface {
+	FetchQuotes(context.Context, []string, []string) ([]types.Quote, error)
+}
+
+// quoteFetcher implements the QuoteFetcher interface.
+type quoteFetcher struct{}
+
+// NewQuoteFetcher creates a new instance of the QuoteFetcher.
+func NewQuoteFetcher() QuoteFetcher {
+	return &quoteFetcher{}
+}
+
+// FetchQuotes method of quoteFetcher.
+// It fetches the quotes of every coin id in every currency with a single CoinGecko request.
+// Pairs CoinGecko has no data for are left out of the result.
+func (s *quoteFetcher) FetchQuotes(ctx context.Context, ids []string, currencies []string) ([]types.Quote, error) {
+	if len(ids) == 0 || len(currencies) == 0 {
+		return nil, errors.New("at least one coin id and one currency are required")
+	}
+
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	query.Set("vs_currencies", strings.Join(currencies, ","))
+	query.Set("include_market_cap", "true")
+	query.Set("include_24hr_vol", "true")
+	query.Set("include_24hr_change", "true")
+	query.Set("include_last_updated_at", "true")
+
+	// Every coin maps to flat keys such as "eur", "eur_market_cap" and "last_updated_at".
+	var data map[string]map[string]float64
+	if err := gecko.GetJSON(ctx, "/simple/price", query, &data); err != nil {
+		return nil, fmt.Errorf("failed to fetch quotes: %w", err)
+	}
+
+	quotes := make([]types.Quote, 0, len(ids)*len(currencies))
+	for _, id := range ids {
+		coin, ok := data[id]
+		if !ok {
+			continue
+		}
+		timestamp := time.Unix(int64(coin["last_updated_at"]), 0)
+		for _, currency := range currencies {
+			price, ok := coin[currency]
+			if !ok {
+				continue
+			}
+			quotes = append(quotes, types.Quote{
+				Ticker:     id,
+				Currency:   currency,
+				Price:      price,
+				MarketCap:  coin[currency+"_market_cap"],
+				Vol24Hr:    coin[currency+"_24h_vol"],
+				Change24Hr: coin[currency+"_24h_change"],
+				Timestamp:  timestamp,
+			})
+		}
+	}
+	return quotes, nil
+}
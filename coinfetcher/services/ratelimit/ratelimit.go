@@ -0,0 +1,361 @@
+package ratelimit_utils
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	authUtils "coinfetcher/services/auth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// What a rule's buckets are keyed by.
+const (
+	KeyAPIKey = "api_key" // The authenticated caller; anonymous callers fall back to their IP.
+	KeyIP     = "ip"      // The client IP, see Config.TrustedProxies.
+	KeyRoute  = "route"   // The rule itself: one bucket shared by all callers.
+)
+
+// defaultIdleTimeout is how long unused buckets are kept when the config doesn't say.
+const defaultIdleTimeout = 10 * time.Minute
+
+// evictInterval is how often idle buckets are looked for.
+const evictInterval = time.Minute
+
+// stats publishes the limiter counters under "ratelimit" in expvar.
+var stats = expvar.NewMap("ratelimit")
+
+// Rule limits the requests to the paths starting with PathPrefix.
+type Rule struct {
+	Name       string  `json:"name"`
+	PathPrefix string  `json:"path_prefix"` // Empty matches every path.
+	Key        string  `json:"key"`         // KeyAPIKey, KeyIP or KeyRoute.
+	Rate       float64 `json:"rate"`        // Tokens added per second.
+	Burst      int     `json:"burst"`       // Bucket size, the most requests allowed at once.
+}
+
+// Config is the rate limit configuration, as read from the limits file.
+type Config struct {
+	Rules          []Rule   `json:"rules"`           // Evaluated in order; the first match applies.
+	TrustedProxies []string `json:"trusted_proxies"` // CIDRs whose X-Forwarded-For headers are believed.
+	IdleTimeout    string   `json:"idle_timeout"`    // How long unused buckets are kept, like "10m".
+}
+
+// config is a validated Config.
+type config struct {
+	rules   []Rule
+	proxies []*net.IPNet
+	idle    time.Duration
+}
+
+// parseConfig validates c.
+func parseConfig(c Config) (*config, error) {
+	parsed := &config{rules: c.Rules, idle: defaultIdleTimeout}
+
+	names := make(map[string]bool, len(c.Rules))
+	for _, rule := range c.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rate limit rule without name")
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rate limit rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Key != KeyAPIKey && rule.Key != KeyIP && rule.Key != KeyRoute {
+			return nil, fmt.Errorf("rate limit rule %q: key must be %q, %q or %q", rule.Name, KeyAPIKey, KeyIP, KeyRoute)
+		}
+		if rule.Rate <= 0 || rule.Burst < 1 {
+			return nil, fmt.Errorf("rate limit rule %q: rate and burst must be positive", rule.Name)
+		}
+	}
+
+	for _, cidr := range c.TrustedProxies {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", cidr, err)
+		}
+		parsed.proxies = append(parsed.proxies, network)
+	}
+
+	if c.IdleTimeout != "" {
+		idle, err := time.ParseDuration(c.IdleTimeout)
+		if err != nil || idle <= 0 {
+			return nil, fmt.Errorf("invalid idle timeout %q", c.IdleTimeout)
+		}
+		parsed.idle = idle
+	}
+	return parsed, nil
+}
+
+// bucket is a token bucket. It is refilled lazily when a request arrives.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	Allowed    bool
+	Rule       string        // Name of the matching rule; empty if no rule matched.
+	RetryAfter time.Duration // When a token is available again, for rejected requests.
+}
+
+// Limiter enforces per-client token buckets. Its configuration can be swapped at runtime,
+// which resets all buckets.
+type Limiter struct {
+	path string // File the configuration is reloaded from; empty if it was given in code.
+
+	mu      sync.Mutex
+	config  *config
+	buckets map[string]*bucket // By rule name and client key.
+}
+
+// NewLimiter creates a limiter enforcing c.
+func NewLimiter(c Config) (*Limiter, error) {
+	parsed, err := parseConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Limiter{config: parsed, buckets: make(map[string]*bucket)}
+	stats.Set("buckets", expvar.Func(func() interface{} { return l.bucketCount() }))
+	return l, nil
+}
+
+// LoadLimiter creates a limiter from the JSON config file at path. Reload reads the file again.
+func LoadLimiter(path string) (*Limiter, error) {
+	c, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewLimiter(c)
+	if err != nil {
+		return nil, err
+	}
+	l.path = path
+	return l, nil
+}
+
+// readConfig reads a JSON config file.
+func readConfig(path string) (Config, error) {
+	var c Config
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("failed to read rate limit file: %v", err)
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, fmt.Errorf("failed to parse rate limit file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Reload re-reads the limiter's config file. The current limits stay in place if it is invalid.
+func (l *Limiter) Reload() error {
+	if l.path == "" {
+		return fmt.Errorf("rate limits were not loaded from a file")
+	}
+	c, err := readConfig(l.path)
+	if err != nil {
+		return err
+	}
+	return l.SetConfig(c)
+}
+
+// SetConfig replaces the limits with c and resets all buckets.
+func (l *Limiter) SetConfig(c Config) error {
+	parsed, err := parseConfig(c)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.config = parsed
+	l.buckets = make(map[string]*bucket)
+	l.mu.Unlock()
+
+	stats.Add("reloads", 1)
+	return nil
+}
+
+// Allow takes a token for r from the bucket of the first matching rule.
+// Requests no rule matches are always allowed.
+func (l *Limiter) Allow(r *http.Request, now time.Time) Decision {
+	return l.allow(r, now, nil)
+}
+
+// AllowClient is Allow for requests whose caller isn't authenticated yet. Rules keyed by
+// API key are left to AllowCaller; requests matching one are allowed.
+func (l *Limiter) AllowClient(r *http.Request, now time.Time) Decision {
+	return l.allow(r, now, func(rule Rule) bool { return rule.Key != KeyAPIKey })
+}
+
+// AllowCaller is Allow once the caller of r is known, applying only rules keyed by API key,
+// which AllowClient skipped. Requests without a principal fall back to their IP.
+func (l *Limiter) AllowCaller(r *http.Request, now time.Time) Decision {
+	return l.allow(r, now, func(rule Rule) bool { return rule.Key == KeyAPIKey })
+}
+
+// allow takes a token for r from the bucket of the first matching rule, if applies is nil
+// or returns true for it.
+func (l *Limiter) allow(r *http.Request, now time.Time, applies func(Rule) bool) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rule, ok := l.config.match(r.URL.Path)
+	if !ok || (applies != nil && !applies(rule)) {
+		return Decision{Allowed: true}
+	}
+
+	key := rule.Name + "|" + l.config.clientKey(rule, r)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time passed since the last request, up to the bucket size.
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed*rule.Rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		stats.Add("allowed", 1)
+		return Decision{Allowed: true, Rule: rule.Name}
+	}
+
+	stats.Add("rejected", 1)
+	stats.Add("rejected."+rule.Name, 1)
+	wait := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	return Decision{Rule: rule.Name, RetryAfter: wait}
+}
+
+// match returns the first rule matching path.
+func (c *config) match(path string) (Rule, bool) {
+	for _, rule := range c.rules {
+		if strings.HasPrefix(path, rule.PathPrefix) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// clientKey returns the key identifying the caller of r under rule.
+func (c *config) clientKey(rule Rule, r *http.Request) string {
+	switch rule.Key {
+	case KeyRoute:
+		return ""
+	case KeyAPIKey:
+		if p := authUtils.PrincipalFromContext(r.Context()); p != nil {
+			return "subject:" + p.Subject
+		}
+	}
+	return "ip:" + c.clientIP(r)
+}
+
+// clientIP returns the IP of the client behind r. X-Forwarded-For is only believed when the
+// request comes from a trusted proxy: its entries are walked from the right, and the first
+// one that isn't a trusted proxy is the client.
+func (c *config) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.trusted(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break // Garbage can't be attributed to anyone; use the last trusted hop.
+		}
+		host = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trusted reports whether ip belongs to a trusted proxy.
+func (c *config) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range c.proxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run evicts idle buckets and reloads the config file on SIGHUP until ctx is cancelled.
+// A bucket that was idle for long enough is full again, so evicting it changes nothing
+// as long as the idle timeout exceeds burst/rate.
+func (l *Limiter) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	if l.path != "" {
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+	}
+
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := l.Reload(); err != nil {
+				log.WithFields(log.Fields{"file": l.path, "err": err}).Error("Error reloading rate limits")
+			} else {
+				log.WithFields(log.Fields{"file": l.path}).Info("Reloaded rate limits")
+			}
+		case now := <-ticker.C:
+			l.evict(now)
+		}
+	}
+}
+
+// evict drops the buckets unused for longer than the idle timeout.
+func (l *Limiter) evict(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > l.config.idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// bucketCount returns the number of live buckets.
+func (l *Limiter) bucketCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
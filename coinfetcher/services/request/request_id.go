@@ -0,0 +1,78 @@
+package request_utils
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HeaderName is the header request IDs are read from, echoed in and forwarded upstream with.
+const HeaderName = "X-Request-ID"
+
+// traceparentHeader is the W3C Trace Context header whose trace-id is used when no request ID is given.
+const traceparentHeader = "traceparent"
+
+// requestIDKey is the context key the request ID is stored under.
+type requestIDKey struct{}
+
+var (
+	// Accept the characters gateways commonly use in IDs, and nothing that could break a log line or header.
+	requestIDPattern   = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+	traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromHeaders returns the request ID supplied by the caller: a valid X-Request-ID header,
+// otherwise the trace-id of a valid traceparent header, otherwise "".
+func FromHeaders(h http.Header) string {
+	if id := strings.TrimSpace(h.Get(HeaderName)); requestIDPattern.MatchString(id) {
+		return id
+	}
+
+	if m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(h.Get(traceparentHeader))); m != nil {
+		if m[1] != strings.Repeat("0", 32) { // An all-zero trace-id is invalid per the spec.
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// NewRequestID generates a random (version 4) UUID.
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4.
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant.
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Middleware makes sure every request carries a request ID: it honours the caller's
+// X-Request-ID or traceparent, generates one otherwise, stores it in the request
+// context and echoes it in the X-Request-ID response header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := FromHeaders(r.Header)
+		if id == "" {
+			id = NewRequestID()
+		}
+
+		w.Header().Set(HeaderName, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
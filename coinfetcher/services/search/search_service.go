@@ -0,0 +1,283 @@
+package search_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// retryInterval is how long the index waits before retrying a failed refresh.
+const retryInterval = time.Minute
+
+// ErrIndexNotReady is returned by searches before the coin list was loaded for the first time.
+var ErrIndexNotReady = errors.New("coin index is not ready yet")
+
+// CoinSearcher is an interface that can search coins by id, symbol or name.
+type CoinSearcher interface {
+	SearchCoins(context.Context, string, int) ([]types.CoinMatch, error)
+}
+
+// coinSearcher implements the CoinSearcher interface on top of a CoinIndex.
+type coinSearcher struct {
+	index *CoinIndex
+}
+
+// NewCoinSearcher creates a new instance of the CoinSearcher backed by the given index.
+func NewCoinSearcher(index *CoinIndex) CoinSearcher {
+	return &coinSearcher{index: index}
+}
+
+// SearchCoins method of coinSearcher.
+// It answers the query from the local index so no CoinGecko quota is spent per keystroke.
+func (s *coinSearcher) SearchCoins(ctx context.Context, query string, limit int) ([]types.CoinMatch, error) {
+	return s.index.Search(query, limit)
+}
+
+// indexedCoin keeps a coin together with the lowercased fields used for matching.
+type indexedCoin struct {
+	coin   types.CoinMatch
+	id     string
+	symbol string
+	name   string
+}
+
+// CoinIndex is an in-memory copy of the CoinGecko coin list that is refreshed in the background.
+type CoinIndex struct {
+	mu              sync.RWMutex
+	coins           []indexedCoin
+	updatedAt       time.Time
+	refreshInterval time.Duration
+	marketPages     int
+	paused          atomic.Bool
+}
+
+// NewCoinIndex creates an empty index. marketPages is the number of 250-coin
+// market pages used to enrich the list with market-cap ranks and thumbnails.
+func NewCoinIndex(refreshInterval time.Duration, marketPages int) *CoinIndex {
+	return &CoinIndex{
+		refreshInterval: refreshInterval,
+		marketPages:     marketPages,
+	}
+}
+
+// Run refreshes the index immediately and then on every refresh interval until ctx is cancelled.
+func (i *CoinIndex) Run(ctx context.Context) {
+	for {
+		wait := i.refreshInterval
+		// While paused the index keeps serving the last list.
+		if !i.paused.Load() {
+			if err := i.Refresh(ctx); err != nil && retryInterval < wait {
+				wait = retryInterval // Retry sooner when the refresh failed.
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Pause stops the background refreshes until Resume is called. Refresh still works when called directly.
+func (i *CoinIndex) Pause() {
+	i.paused.Store(true)
+}
+
+// Resume restarts the background refreshes after Pause, from the next refresh interval on.
+func (i *CoinIndex) Resume() {
+	i.paused.Store(false)
+}
+
+// Paused reports whether background refreshes are paused.
+func (i *CoinIndex) Paused() bool {
+	return i.paused.Load()
+}
+
+// Refresh downloads the coin list and swaps it into the index.
+func (i *CoinIndex) Refresh(ctx context.Context) error {
+	var list []struct {
+		ID     string `json:"id"`
+		Symbol string `json:"symbol"`
+		Name   string `json:"name"`
+	}
+	if err := gecko.GetJSON(ctx, "/coins/list", nil, &list); err != nil {
+		return fmt.Errorf("failed to fetch coin list: %v", err)
+	}
+
+	// Start from the previous enrichment so a failed market page doesn't drop ranks and thumbnails.
+	enrichment := i.previousEnrichment()
+	for page := 1; page <= i.marketPages; page++ {
+		if err := fetchMarketPage(ctx, page, enrichment); err != nil {
+			break
+		}
+	}
+
+	coins := make([]indexedCoin, 0, len(list))
+	for _, c := range list {
+		match := types.CoinMatch{ID: c.ID, Symbol: c.Symbol, Name: c.Name}
+		if extra, ok := enrichment[c.ID]; ok {
+			match.MarketCapRank = extra.MarketCapRank
+			match.Thumb = extra.Thumb
+		}
+		coins = append(coins, indexedCoin{
+			coin:   match,
+			id:     strings.ToLower(c.ID),
+			symbol: strings.ToLower(c.Symbol),
+			name:   strings.ToLower(c.Name),
+		})
+	}
+
+	i.mu.Lock()
+	i.coins = coins
+	i.updatedAt = time.Now().UTC()
+	i.mu.Unlock()
+
+	return nil
+}
+
+// previousEnrichment returns the ranks and thumbnails currently held by the index.
+func (i *CoinIndex) previousEnrichment() map[string]types.CoinMatch {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	enrichment := make(map[string]types.CoinMatch, len(i.coins))
+	for _, c := range i.coins {
+		if c.coin.MarketCapRank > 0 || c.coin.Thumb != "" {
+			enrichment[c.coin.ID] = c.coin
+		}
+	}
+	return enrichment
+}
+
+// fetchMarketPage stores the rank and thumbnail of every coin on one market page into enrichment.
+func fetchMarketPage(ctx context.Context, page int, enrichment map[string]types.CoinMatch) error {
+	query := url.Values{}
+	query.Set("vs_currency", "usd")
+	query.Set("order", "market_cap_desc")
+	query.Set("per_page", "250")
+	query.Set("page", strconv.Itoa(page))
+
+	var markets []struct {
+		ID            string `json:"id"`
+		Image         string `json:"image"`
+		MarketCapRank int    `json:"market_cap_rank"`
+	}
+	if err := gecko.GetJSON(ctx, "/coins/markets", query, &markets); err != nil {
+		return err
+	}
+
+	for _, m := range markets {
+		enrichment[m.ID] = types.CoinMatch{
+			ID:            m.ID,
+			MarketCapRank: m.MarketCapRank,
+			// The markets endpoint returns the large image; the thumbnail lives next to it.
+			Thumb: strings.Replace(m.Image, "/large/", "/thumb/", 1),
+		}
+	}
+	return nil
+}
+
+// UpdatedAt returns the time of the last successful refresh.
+func (i *CoinIndex) UpdatedAt() time.Time {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.updatedAt
+}
+
+// scoredCoin is a search candidate together with its match quality.
+type scoredCoin struct {
+	coin  types.CoinMatch
+	score int
+}
+
+// Search returns up to limit coins matching query, best matches first.
+func (i *CoinIndex) Search(query string, limit int) ([]types.CoinMatch, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, errors.New("search query must not be empty")
+	}
+
+	i.mu.RLock()
+	coins := i.coins
+	i.mu.RUnlock()
+
+	if len(coins) == 0 {
+		return nil, ErrIndexNotReady
+	}
+
+	var candidates []scoredCoin
+	for _, c := range coins {
+		if score := matchScore(c, query); score > 0 {
+			candidates = append(candidates, scoredCoin{coin: c.coin, score: score})
+		}
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.score != cb.score {
+			return ca.score > cb.score
+		}
+		// Within the same match quality, ranked coins come first, lowest rank first.
+		ra, rb := ca.coin.MarketCapRank, cb.coin.MarketCapRank
+		if (ra > 0) != (rb > 0) {
+			return ra > 0
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		return ca.coin.Name < cb.coin.Name
+	})
+
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	matches := make([]types.CoinMatch, len(candidates))
+	for n, c := range candidates {
+		matches[n] = c.coin
+	}
+	return matches, nil
+}
+
+// matchScore ranks how well a coin matches the (lowercased) query; 0 means no match.
+func matchScore(c indexedCoin, query string) int {
+	switch {
+	case c.id == query || c.symbol == query:
+		return 100
+	case c.name == query:
+		return 95
+	case strings.HasPrefix(c.symbol, query):
+		return 80
+	case strings.HasPrefix(c.name, query) || strings.HasPrefix(c.id, query):
+		return 70
+	case hasWordPrefix(c.name, query):
+		return 60
+	case strings.Contains(c.name, query) || strings.Contains(c.id, query):
+		return 40
+	}
+	return 0
+}
+
+// hasWordPrefix reports whether any word of name starts with query.
+func hasWordPrefix(name, query string) bool {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '.' || r == '(' || r == ')'
+	})
+	for _, w := range words {
+		if strings.HasPrefix(w, query) {
+			return true
+		}
+	}
+	return false
+}
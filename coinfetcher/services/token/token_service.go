@@ -0,0 +1,114 @@
+package token_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	gecko "coinfetcher/services/gecko"
+	"coinfetcher/types"
+)
+
+// TokenPriceFetcher is an interface that can fetch token prices by contract address on a given platform.
+type TokenPriceFetcher interface {
+	FetchTokenPrices(context.Context, string, []string) ([]types.PriceResponse, error)
+}
+
+// tokenPriceFetcher implements the TokenPriceFetcher interface.
+type tokenPriceFetcher struct {
+	batchSize int // Maximum number of contracts sent in a single upstream request.
+}
+
+// NewTokenPriceFetcher creates a new instance of the TokenPriceFetcher.
+// Contracts are split into upstream requests of at most batchSize addresses.
+func NewTokenPriceFetcher(batchSize int) TokenPriceFetcher {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &tokenPriceFetcher{batchSize: batchSize}
+}
+
+// FetchTokenPrices method of tokenPriceFetcher.
+// It validates the contracts for the platform and fetches their prices from the CoinGecko API in batches.
+// Contracts CoinGecko has no data for are left out of the result.
+func (s *tokenPriceFetcher) FetchTokenPrices(ctx context.Context, platform string, contracts []string) ([]types.PriceResponse, error) {
+	if err := ValidatePlatform(platform); err != nil {
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, errors.New("at least one contract address is required")
+	}
+
+	// Normalise and de-duplicate the addresses, keeping the caller's order.
+	normalized := make([]string, 0, len(contracts))
+	seen := make(map[string]bool, len(contracts))
+	for _, contract := range contracts {
+		address, err := NormalizeContract(platform, contract)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[address] {
+			seen[address] = true
+			normalized = append(normalized, address)
+		}
+	}
+
+	prices := make([]types.PriceResponse, 0, len(normalized))
+	for start := 0; start < len(normalized); start += s.batchSize {
+		end := start + s.batchSize
+		if end > len(normalized) {
+			end = len(normalized)
+		}
+
+		batch, err := fetchTokenBatch(ctx, platform, normalized[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch token prices: %w", err)
+		}
+		prices = append(prices, batch...)
+	}
+
+	return prices, nil
+}
+
+// fetchTokenBatch fetches the prices of one batch of contracts with a single upstream request.
+func fetchTokenBatch(ctx context.Context, platform string, contracts []string) ([]types.PriceResponse, error) {
+	query := url.Values{}
+	query.Set("contract_addresses", strings.Join(contracts, ","))
+	query.Set("vs_currencies", "usd")
+	query.Set("include_24hr_vol", "true")
+	query.Set("include_last_updated_at", "true")
+
+	var data map[string]struct {
+		USD           float64 `json:"usd"`
+		LastUpdatedAt int64   `json:"last_updated_at"`
+		Vol24Hr       float64 `json:"usd_24h_vol"`
+	}
+	if err := gecko.GetJSON(ctx, "/simple/token_price/"+url.PathEscape(platform), query, &data); err != nil {
+		return nil, err
+	}
+
+	// CoinGecko keys EVM contracts in lowercase, so match case-insensitively.
+	byAddress := make(map[string]string, len(data))
+	for address := range data {
+		byAddress[strings.ToLower(address)] = address
+	}
+
+	prices := make([]types.PriceResponse, 0, len(contracts))
+	for _, contract := range contracts {
+		key, ok := byAddress[strings.ToLower(contract)]
+		if !ok {
+			continue
+		}
+		priceData := data[key]
+		prices = append(prices, types.PriceResponse{
+			Ticker:    contract,
+			Price:     priceData.USD,
+			Timestamp: time.Unix(priceData.LastUpdatedAt, 0),
+			Vol24Hr:   priceData.Vol24Hr,
+		})
+	}
+	return prices, nil
+}
@@ -0,0 +1,169 @@
+package token_service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// evmPlatforms lists the CoinGecko asset platforms that use 20-byte, EIP-55 style addresses.
+var evmPlatforms = map[string]bool{
+	"ethereum":            true,
+	"binance-smart-chain": true,
+	"polygon-pos":         true,
+	"arbitrum-one":        true,
+	"optimistic-ethereum": true,
+	"base":                true,
+	"avalanche":           true,
+	"fantom":              true,
+	"xdai":                true,
+	"linea":               true,
+	"zksync":              true,
+	"cronos":              true,
+	"celo":                true,
+	"moonbeam":            true,
+}
+
+var (
+	platformPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+	evmPattern      = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	genericPattern  = regexp.MustCompile(`^[0-9A-Za-z._:-]{1,128}$`)
+)
+
+// base58Alphabet is the Bitcoin alphabet used by Solana and Tron addresses.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ValidatePlatform checks that platform looks like a CoinGecko asset platform id.
+func ValidatePlatform(platform string) error {
+	if !platformPattern.MatchString(platform) {
+		return fmt.Errorf("invalid platform %q", platform)
+	}
+	return nil
+}
+
+// NormalizeContract validates address for the given platform and returns it in the form CoinGecko keys its response by.
+func NormalizeContract(platform, address string) (string, error) {
+	address = strings.TrimSpace(address)
+
+	switch {
+	case evmPlatforms[platform]:
+		if err := validateEVMAddress(address); err != nil {
+			return "", fmt.Errorf("invalid %s contract %q: %v", platform, address, err)
+		}
+		return strings.ToLower(address), nil
+	case platform == "solana":
+		if err := validateSolanaAddress(address); err != nil {
+			return "", fmt.Errorf("invalid solana contract %q: %v", address, err)
+		}
+		return address, nil
+	case platform == "tron":
+		if err := validateTronAddress(address); err != nil {
+			return "", fmt.Errorf("invalid tron contract %q: %v", address, err)
+		}
+		return address, nil
+	}
+
+	// Platforms we don't know the address format of only get a sanity check.
+	if !genericPattern.MatchString(address) {
+		return "", fmt.Errorf("invalid %s contract %q", platform, address)
+	}
+	return address, nil
+}
+
+// validateEVMAddress checks the 0x-prefixed hex format and, for mixed-case input, the EIP-55 checksum.
+func validateEVMAddress(address string) error {
+	if !evmPattern.MatchString(address) {
+		return errors.New("expected 0x followed by 40 hex characters")
+	}
+
+	hexPart := address[2:]
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return nil // Single-case addresses carry no checksum.
+	}
+
+	if hexPart != eip55Checksum(hexPart) {
+		return errors.New("EIP-55 checksum mismatch")
+	}
+	return nil
+}
+
+// eip55Checksum returns the checksummed spelling of a 40 character hex address (without 0x).
+func eip55Checksum(hexPart string) string {
+	lower := strings.ToLower(hexPart)
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(lower))
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	out := []byte(lower)
+	for i, c := range out {
+		// Letters are upper-cased when the matching hash nibble is 8 or more.
+		if c >= 'a' && c <= 'f' && digest[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return string(out)
+}
+
+// validateSolanaAddress checks that address is a base58 encoded 32 byte public key.
+func validateSolanaAddress(address string) error {
+	decoded, err := decodeBase58(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != 32 {
+		return fmt.Errorf("expected 32 bytes, got %d", len(decoded))
+	}
+	return nil
+}
+
+// validateTronAddress checks a base58check encoded Tron address (0x41 prefix and 4 byte checksum).
+func validateTronAddress(address string) error {
+	decoded, err := decodeBase58(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != 25 || decoded[0] != 0x41 {
+		return errors.New("expected a 25 byte address starting with 0x41")
+	}
+
+	payload, checksum := decoded[:21], decoded[21:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return errors.New("base58check checksum mismatch")
+	}
+	return nil
+}
+
+// decodeBase58 decodes a Bitcoin-alphabet base58 string.
+func decodeBase58(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty address")
+	}
+
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	// Every leading '1' encodes a leading zero byte.
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,668 @@
+package webhook_utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	fileUtils "coinfetcher/services/file"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers sent with every delivery. Receivers verify a delivery by computing the
+// HMAC-SHA256 of "<timestamp>.<body>" with the endpoint's secret, comparing it with the
+// signature, and rejecting timestamps too far from their own clock to stop replays.
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix seconds at which the attempt was signed.
+	HeaderSignature = "X-Webhook-Signature" // "v1=" followed by the hex encoded signature.
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"   // Waiting for its first attempt or a retry.
+	StatusDelivered = "delivered" // Accepted by the endpoint.
+	StatusFailed    = "failed"    // Given up on; it can still be resent.
+)
+
+// stats publishes the delivery counters under "webhooks" in expvar.
+var stats = expvar.NewMap("webhooks")
+
+// ErrQueueFull is returned by Enqueue when deliveries are produced faster than they can be sent.
+var ErrQueueFull = errors.New("webhook queue is full")
+
+// ErrEndpointNotFound is returned for endpoint IDs that don't exist, or belong to someone else.
+var ErrEndpointNotFound = errors.New("webhook endpoint not found")
+
+// ErrDeliveryNotFound is returned for deliveries that don't exist, or were pruned from the log.
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// ErrInvalidEndpoint is wrapped by the errors describing why an endpoint was rejected.
+var ErrInvalidEndpoint = errors.New("invalid webhook endpoint")
+
+// ErrEndpointInUse is returned by DeleteEndpoint for endpoints something still delivers to.
+var ErrEndpointInUse = errors.New("webhook endpoint is in use")
+
+// ErrNotSaved is wrapped by the errors of changes that were undone because the endpoints couldn't be saved.
+var ErrNotSaved = errors.New("webhook endpoints could not be saved")
+
+// ErrPrivateAddress is returned for deliveries to addresses that aren't on the public internet.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// privateRanges are the ranges besides loopback, link-local, private and multicast ones
+// that deliveries may not reach: shared (carrier-grade NAT), benchmarking and reserved ones.
+var privateRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Config tunes a Dispatcher. Zero fields take the defaults of DefaultConfig.
+type Config struct {
+	Workers        int           // Deliveries sent concurrently.
+	QueueSize      int           // Deliveries waiting to be sent.
+	MaxAttempts    int           // Attempts before a delivery is given up on.
+	InitialBackoff time.Duration // Wait before the first retry; doubled for each further one.
+	MaxBackoff     time.Duration // Cap on the wait between retries.
+	Timeout        time.Duration // Time allowed for a single attempt.
+	History        int           // Deliveries kept in the log of each endpoint.
+
+	// AllowPrivateNetworks lets endpoints reach loopback, link-local and private addresses.
+	// It is off by default so endpoints can't be used to probe the network the server runs in.
+	AllowPrivateNetworks bool
+}
+
+// DefaultConfig returns the settings used for the fields a Config leaves zero.
+func DefaultConfig() Config {
+	return Config{
+		Workers:        4,
+		QueueSize:      1000,
+		MaxAttempts:    6,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Timeout:        10 * time.Second,
+		History:        200,
+	}
+}
+
+// Endpoint is a URL deliveries are sent to, with the secret they are signed with.
+type Endpoint struct {
+	ID          string    `json:"id"`
+	Owner       string    `json:"owner,omitempty"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"secret,omitempty"` // Only shown when the endpoint is created.
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Attempt records one try at sending a delivery.
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"` // Zero when no response was received.
+	LatencyMs  int64     `json:"latencyMs"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Delivery is a payload sent, or on its way, to an endpoint.
+type Delivery struct {
+	ID         string          `json:"id"`
+	EndpointID string          `json:"endpointId"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Status     string          `json:"status"`
+	Attempts   []Attempt       `json:"attempts"`
+	ResendOf   string          `json:"resendOf,omitempty"` // Delivery this one repeats.
+}
+
+// body is what is POSTed to the endpoint.
+type body struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher POSTs signed JSON payloads to registered endpoints. Failed attempts are
+// retried with exponential backoff and jitter; deliveries that exhaust their attempts, or
+// that the endpoint rejected outright, are marked failed and can be resent. Every attempt
+// is kept in a bounded per-endpoint log. Endpoints are persisted to a file so they, and
+// their secrets, survive restarts.
+type Dispatcher struct {
+	path   string // File endpoints are persisted to; empty keeps them in memory only.
+	config Config
+	client *http.Client
+	queue  chan *Delivery
+	inUse  []func(id string) bool // Set up before the dispatcher is used; see AddReferrer.
+
+	mu         sync.Mutex
+	endpoints  map[string]*Endpoint
+	deliveries map[string][]*Delivery // By endpoint ID, oldest first, at most config.History long.
+}
+
+// NewDispatcher creates a dispatcher persisting its endpoints to path, loading the ones saved
+// there; Run sends its deliveries. A missing file is not an error.
+func NewDispatcher(path string, config Config) (*Dispatcher, error) {
+	defaults := DefaultConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaults.InitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.History <= 0 {
+		config.History = defaults.History
+	}
+
+	d := &Dispatcher{
+		path:       path,
+		config:     config,
+		client:     newClient(config),
+		queue:      make(chan *Delivery, config.QueueSize),
+		endpoints:  make(map[string]*Endpoint),
+		deliveries: make(map[string][]*Delivery),
+	}
+	if path == "" {
+		return d, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks file: %v", err)
+	}
+	var saved struct {
+		Endpoints []Endpoint `json:"endpoints"`
+	}
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse webhooks file %s: %v", path, err)
+	}
+	for i := range saved.Endpoints {
+		endpoint := saved.Endpoints[i]
+		d.endpoints[endpoint.ID] = &endpoint
+	}
+	return d, nil
+}
+
+// CreateEndpoint registers url for owner with a new secret. The returned endpoint is the
+// only one carrying the secret, so if the endpoints can't be saved it is removed again.
+func (d *Dispatcher) CreateEndpoint(owner, rawURL, description string) (Endpoint, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return Endpoint{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidEndpoint)
+	}
+	// Names are checked again on every delivery, as they can be made to resolve to anything.
+	if !d.config.AllowPrivateNetworks {
+		if addr, err := netip.ParseAddr(target.Hostname()); (err == nil && !isPublic(addr)) || target.Hostname() == "localhost" {
+			return Endpoint{}, fmt.Errorf("%w: url must point to a public address", ErrInvalidEndpoint)
+		}
+	}
+
+	endpoint := &Endpoint{
+		ID:          newID(8),
+		Owner:       owner,
+		URL:         rawURL,
+		Description: description,
+		Secret:      "whsec_" + newID(24),
+		CreatedAt:   time.Now().UTC(),
+	}
+	d.mu.Lock()
+	d.endpoints[endpoint.ID] = endpoint
+	d.mu.Unlock()
+
+	if err := d.save(); err != nil {
+		d.mu.Lock()
+		delete(d.endpoints, endpoint.ID)
+		d.mu.Unlock()
+		return Endpoint{}, fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return *endpoint, nil
+}
+
+// Endpoints returns the endpoints of owner sorted by creation, or every endpoint if all is
+// true. Secrets are left out.
+func (d *Dispatcher) Endpoints(owner string, all bool) []Endpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	endpoints := []Endpoint{}
+	for _, endpoint := range d.endpoints {
+		if all || endpoint.Owner == owner {
+			endpoints = append(endpoints, redact(*endpoint))
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if !endpoints[i].CreatedAt.Equal(endpoints[j].CreatedAt) {
+			return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+		}
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints
+}
+
+// Endpoint returns the endpoint with id, without its secret, if owner may see it; all
+// grants access to every endpoint.
+func (d *Dispatcher) Endpoint(id, owner string, all bool) (Endpoint, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	endpoint, err := d.lookup(id, owner, all)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return redact(*endpoint), nil
+}
+
+// AddReferrer registers inUse to be asked whether an endpoint is still delivered to before it
+// is deleted. It is called without the dispatcher's lock held, so it may call back into the
+// dispatcher. Referrers are added before the dispatcher is used.
+func (d *Dispatcher) AddReferrer(inUse func(id string) bool) {
+	d.inUse = append(d.inUse, inUse)
+}
+
+// DeleteEndpoint removes the endpoint with id and its delivery log. Deliveries still queued
+// for it are dropped. Endpoints a referrer still uses can't be deleted, and the endpoint is
+// kept if the endpoints can't be saved.
+func (d *Dispatcher) DeleteEndpoint(id, owner string, all bool) error {
+	if _, err := d.Endpoint(id, owner, all); err != nil {
+		return err
+	}
+	for _, inUse := range d.inUse {
+		if inUse(id) {
+			return ErrEndpointInUse
+		}
+	}
+
+	d.mu.Lock()
+	endpoint, err := d.lookup(id, owner, all)
+	if err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	deliveries := d.deliveries[id]
+	delete(d.endpoints, id)
+	delete(d.deliveries, id)
+	d.mu.Unlock()
+
+	if err := d.save(); err != nil {
+		d.mu.Lock()
+		d.endpoints[id] = endpoint
+		d.deliveries[id] = deliveries
+		d.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return nil
+}
+
+// lookup returns the endpoint with id if owner may see it. Callers hold d.mu.
+func (d *Dispatcher) lookup(id, owner string, all bool) (*Endpoint, error) {
+	endpoint, ok := d.endpoints[id]
+	if !ok || (!all && endpoint.Owner != owner) {
+		return nil, ErrEndpointNotFound
+	}
+	return endpoint, nil
+}
+
+// Deliveries returns the log of the endpoint with id, most recent first.
+func (d *Dispatcher) Deliveries(id, owner string, all bool) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.lookup(id, owner, all); err != nil {
+		return nil, err
+	}
+	log := d.deliveries[id]
+	deliveries := make([]Delivery, 0, len(log))
+	for i := len(log) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, copyDelivery(log[i]))
+	}
+	return deliveries, nil
+}
+
+// Failed returns the deliveries given up on, oldest first, for which filter returns true.
+// A nil filter returns them all.
+func (d *Dispatcher) Failed(filter func(Delivery) bool) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	failed := []Delivery{}
+	for _, log := range d.deliveries {
+		for _, delivery := range log {
+			if delivery.Status == StatusFailed && (filter == nil || filter(*delivery)) {
+				failed = append(failed, copyDelivery(delivery))
+			}
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].CreatedAt.Before(failed[j].CreatedAt) })
+	return failed
+}
+
+// Enqueue schedules payload, encoded as JSON, for delivery to the endpoint with id and returns
+// the delivery. It never blocks.
+func (d *Dispatcher) Enqueue(id, event string, payload interface{}) (Delivery, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to encode webhook payload: %v", err)
+	}
+	return d.enqueue(&Delivery{EndpointID: id, Event: event, Payload: raw})
+}
+
+// Resend schedules the payload of an earlier delivery to the endpoint again, as a new delivery.
+func (d *Dispatcher) Resend(id, deliveryID, owner string, all bool) (Delivery, error) {
+	d.mu.Lock()
+	if _, err := d.lookup(id, owner, all); err != nil {
+		d.mu.Unlock()
+		return Delivery{}, err
+	}
+	var original *Delivery
+	for _, delivery := range d.deliveries[id] {
+		if delivery.ID == deliveryID {
+			original = delivery
+		}
+	}
+	d.mu.Unlock()
+	if original == nil {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	return d.enqueue(&Delivery{EndpointID: id, Event: original.Event, Payload: original.Payload, ResendOf: original.ID})
+}
+
+// enqueue logs delivery and queues it for its first attempt.
+func (d *Dispatcher) enqueue(delivery *Delivery) (Delivery, error) {
+	delivery.ID = newID(12)
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.Status = StatusPending
+	delivery.Attempts = []Attempt{}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.endpoints[delivery.EndpointID]; !ok {
+		return Delivery{}, ErrEndpointNotFound
+	}
+	select {
+	case d.queue <- delivery:
+	default:
+		stats.Add("dropped", 1)
+		return Delivery{}, ErrQueueFull
+	}
+
+	log := append(d.deliveries[delivery.EndpointID], delivery)
+	if len(log) > d.config.History {
+		log = log[len(log)-d.config.History:]
+	}
+	d.deliveries[delivery.EndpointID] = log
+	return copyDelivery(delivery), nil
+}
+
+// Run sends deliveries until ctx is cancelled. Retries still waiting for their backoff
+// when it is are abandoned.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-d.queue:
+					d.attempt(ctx, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt sends delivery once, logs the attempt, and schedules a retry or gives up on the
+// delivery if it failed.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	d.mu.Lock()
+	endpoint, ok := d.endpoints[delivery.EndpointID]
+	var target Endpoint
+	if ok {
+		target = *endpoint
+	}
+	d.mu.Unlock()
+	if !ok {
+		return // The endpoint was deleted while the delivery was queued.
+	}
+
+	start := time.Now()
+	statusCode, retryable, err := d.send(ctx, target, delivery)
+	if err != nil && ctx.Err() != nil {
+		return // Shutting down; the attempt says nothing about the endpoint.
+	}
+	record := Attempt{Time: start.UTC(), StatusCode: statusCode, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	delivery.Attempts = append(delivery.Attempts, record)
+	attempts := len(delivery.Attempts)
+	switch {
+	case err == nil:
+		delivery.Status = StatusDelivered
+	case !retryable || attempts >= d.config.MaxAttempts:
+		delivery.Status = StatusFailed
+	}
+	status := delivery.Status
+	d.mu.Unlock()
+
+	switch status {
+	case StatusDelivered:
+		stats.Add("delivered", 1)
+		return
+	case StatusFailed:
+		stats.Add("failed", 1)
+		log.WithFields(log.Fields{"delivery": delivery.ID, "endpoint": target.ID, "url": target.URL, "attempts": attempts}).
+			WithError(err).Warn("Giving up on webhook delivery")
+		return
+	}
+
+	stats.Add("retried", 1)
+	time.AfterFunc(d.backoff(attempts), func() {
+		select {
+		case d.queue <- delivery:
+		case <-ctx.Done():
+		default:
+			d.mu.Lock()
+			delivery.Status = StatusFailed
+			delivery.Attempts[len(delivery.Attempts)-1].Error = ErrQueueFull.Error()
+			d.mu.Unlock()
+			stats.Add("failed", 1)
+		}
+	})
+}
+
+// send POSTs delivery to endpoint, signed with its secret, and returns the status code of the
+// response. Network errors, timeouts, 408, 429 and 5xx responses are worth retrying; other
+// failures will fail the same way again.
+func (d *Dispatcher) send(ctx context.Context, endpoint Endpoint, delivery *Delivery) (statusCode int, retryable bool, err error) {
+	raw, err := json.Marshal(body{ID: delivery.ID, Event: delivery.Event, CreatedAt: delivery.CreatedAt, Data: delivery.Payload})
+	if err != nil {
+		return 0, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(raw))
+	if err != nil {
+		return 0, false, err
+	}
+	// Every attempt is signed anew, so retries carry a fresh timestamp.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "coinfetcher-webhooks")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "v1="+Sign(endpoint.Secret, timestamp, raw))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, ErrPrivateAddress) {
+		return 0, false, err // The endpoint's name resolves to an address it may not reach.
+	}
+	if err != nil {
+		return 0, true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused.
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return resp.StatusCode, true, fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, false, fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+}
+
+// newClient returns the client deliveries are sent with. It doesn't follow redirects, which
+// would let an endpoint point deliveries elsewhere, and unless config allows private networks
+// it refuses to connect to addresses that aren't public. The address is checked when the
+// connection is made, after the name was resolved, so DNS rebinding can't get around it.
+func newClient(config Config) *http.Client {
+	dialer := &net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || !isPublic(addr.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would make the connection on the dialer's behalf, unchecked.
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // Reported as a failed attempt with the 3xx status.
+		},
+	}
+}
+
+// isPublic reports whether addr is on the public internet.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false // Also rules out loopback, link-local, multicast and unspecified addresses.
+	}
+	for _, prefix := range privateRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with secret, as
+// sent in the signature header.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the wait before the retry following attempt: the initial backoff doubled
+// per attempt, capped, with up to 20% jitter so failing endpoints aren't hit in lockstep.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.config.InitialBackoff
+	for i := 1; i < attempt && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+	return wait + time.Duration(mathrand.Int63n(int64(wait)/5+1))
+}
+
+// save writes the endpoints to the dispatcher's file. The file is replaced atomically and
+// only readable by its owner, as it holds the secrets.
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	saved := struct {
+		Endpoints []Endpoint `json:"endpoints"`
+	}{Endpoints: make([]Endpoint, 0, len(d.endpoints))}
+	for _, endpoint := range d.endpoints {
+		saved.Endpoints = append(saved.Endpoints, *endpoint)
+	}
+	d.mu.Unlock()
+	sort.Slice(saved.Endpoints, func(i, j int) bool { return saved.Endpoints[i].ID < saved.Endpoints[j].ID })
+
+	raw, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileUtils.WriteAtomic(d.path, raw)
+}
+
+// redact returns endpoint without its secret.
+func redact(endpoint Endpoint) Endpoint {
+	endpoint.Secret = ""
+	return endpoint
+}
+
+// copyDelivery returns a copy of delivery that doesn't share its attempt log. Callers hold d.mu.
+func copyDelivery(delivery *Delivery) Delivery {
+	c := *delivery
+	c.Attempts = append([]Attempt{}, delivery.Attempts...)
+	return c
+}
+
+// newID returns a random hex ID of n bytes.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
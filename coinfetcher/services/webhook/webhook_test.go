@@ -0,0 +1,141 @@
+package webhook_utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"1.1.1.1":            true,
+		"2606:4700::1111":    true,
+		"127.0.0.1":          false,
+		"10.1.2.3":           false,
+		"172.16.0.1":         false,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"0.0.0.0":            false,
+		"255.255.255.255":    false,
+		"::1":                false,
+		"fe80::1":            false,
+		"fd00::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:169.254.1.1": false,
+	} {
+		if got := isPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCreateEndpointRejectsPrivateAddresses(t *testing.T) {
+	d, err := NewDispatcher("", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{
+		"http://127.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1:8080/",
+		"http://[::1]/hook",
+		"http://localhost/hook",
+		"ftp://example.com/hook",
+	} {
+		if _, err := d.CreateEndpoint("alice", url, ""); !errors.Is(err, ErrInvalidEndpoint) {
+			t.Errorf("CreateEndpoint(%s) = %v, want ErrInvalidEndpoint", url, err)
+		}
+	}
+	if _, err := d.CreateEndpoint("alice", "https://hooks.example.com/coinfetcher", ""); err != nil {
+		t.Errorf("CreateEndpoint of a public URL = %v", err)
+	}
+}
+
+func TestSendRefusesPrivateAddressesWhenResolved(t *testing.T) {
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer receiver.Close()
+
+	d, err := NewDispatcher("", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stands in for a public name that was made to resolve to loopback.
+	endpoint := Endpoint{ID: "e1", URL: receiver.URL, Secret: "whsec_test"}
+	_, retryable, err := d.send(context.Background(), endpoint, &Delivery{ID: "d1", Event: "test", Payload: []byte(`{}`)})
+	if !errors.Is(err, ErrPrivateAddress) || retryable {
+		t.Errorf("send = (retryable %v, %v), want a final ErrPrivateAddress", retryable, err)
+	}
+	if calls != 0 {
+		t.Errorf("receiver got %d requests, want none", calls)
+	}
+}
+
+func TestSendSignsAndDoesNotFollowRedirects(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { redirected = true }))
+	defer target.Close()
+
+	var signature, timestamp string
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature, timestamp = r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp)
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+		}
+	}))
+	defer receiver.Close()
+
+	d, err := NewDispatcher("", Config{AllowPrivateNetworks: true, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := &Delivery{ID: "d1", Event: "test", Payload: []byte(`{"a":1}`)}
+
+	status, _, err := d.send(context.Background(), Endpoint{URL: receiver.URL + "/ok", Secret: "whsec_test"}, delivery)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("send = (%d, %v), want 200", status, err)
+	}
+	if want := "v1=" + Sign("whsec_test", timestamp, body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+
+	status, retryable, err := d.send(context.Background(), Endpoint{URL: receiver.URL + "/redirect", Secret: "whsec_test"}, delivery)
+	if err == nil || retryable || status != http.StatusTemporaryRedirect {
+		t.Errorf("send to a redirect = (%d, retryable %v, %v), want a final failure with 307", status, retryable, err)
+	}
+	if redirected {
+		t.Error("the redirect was followed")
+	}
+}
+
+func TestChangesAreUndoneWhenTheEndpointsCanNotBeSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	d, err := NewDispatcher(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := d.CreateEndpoint("alice", "https://hooks.example.com/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.path = filepath.Join(path, "missing", "webhooks.json")
+	if _, err := d.CreateEndpoint("alice", "https://hooks.example.com/b", ""); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("CreateEndpoint = %v, want ErrNotSaved", err)
+	}
+	if err := d.DeleteEndpoint(kept.ID, "alice", false); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("DeleteEndpoint = %v, want ErrNotSaved", err)
+	}
+	if endpoints := d.Endpoints("alice", false); len(endpoints) != 1 || endpoints[0].ID != kept.ID {
+		t.Errorf("endpoints = %+v, want only %s", endpoints, kept.ID)
+	}
+}
@@ -9,8 +9,226 @@ type PriceResponse struct {
 	Vol24Hr   float64   `json:"vol24Hr"`
 }
 
+type Quote struct {
+	Ticker     string    `json:"ticker"`
+	Currency   string    `json:"currency"`
+	Price      float64   `json:"price"`
+	MarketCap  float64   `json:"marketCap"`
+	Vol24Hr    float64   `json:"vol24Hr"`
+	Change24Hr float64   `json:"change24Hr"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
 type HealthResponse struct {
 	Status         string    `json:"status"`
 	GeckoApiStatus string    `json:"geckoapistatus"`
 	Timestamp      time.Time `json:"timestamp"`
 }
+
+type CoinMatch struct {
+	ID            string `json:"id"`
+	Symbol        string `json:"symbol"`
+	Name          string `json:"name"`
+	MarketCapRank int    `json:"marketCapRank,omitempty"`
+	Thumb         string `json:"thumb,omitempty"`
+}
+
+type SearchResponse struct {
+	Query string      `json:"query"`
+	Coins []CoinMatch `json:"coins"`
+}
+
+type DominanceShare struct {
+	Symbol     string  `json:"symbol"`
+	Percentage float64 `json:"percentage"`
+	MarketCap  float64 `json:"marketCap"`
+}
+
+type GlobalMarketResponse struct {
+	ActiveCryptocurrencies int              `json:"activeCryptocurrencies"`
+	Markets                int              `json:"markets"`
+	TotalMarketCap         float64          `json:"totalMarketCap"`
+	TotalVol24Hr           float64          `json:"totalVol24Hr"`
+	MarketCapChange24Hr    float64          `json:"marketCapChange24Hr"`
+	BTCDominance           float64          `json:"btcDominance"`
+	ETHDominance           float64          `json:"ethDominance"`
+	Dominance              []DominanceShare `json:"dominance"`
+	Timestamp              time.Time        `json:"timestamp"`
+}
+
+type CoinImage struct {
+	Thumb string `json:"thumb"`
+	Small string `json:"small"`
+	Large string `json:"large"`
+}
+
+type CoinInfo struct {
+	ID          string            `json:"id"`
+	Symbol      string            `json:"symbol"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Image       CoinImage         `json:"image"`
+	Homepage    []string          `json:"homepage"`
+	Categories  []string          `json:"categories"`
+	GenesisDate string            `json:"genesisDate,omitempty"`
+	Platforms   map[string]string `json:"platforms"`
+}
+
+type TokenPriceResponse struct {
+	Platform string          `json:"platform"`
+	Prices   []PriceResponse `json:"prices"`
+	Missing  []string        `json:"missing,omitempty"`
+}
+
+type ExchangeTicker struct {
+	Exchange   string    `json:"exchange"`
+	ExchangeID string    `json:"exchangeId"`
+	Base       string    `json:"base"`
+	Target     string    `json:"target"`
+	Last       float64   `json:"last"`
+	Bid        float64   `json:"bid"`
+	Ask        float64   `json:"ask"`
+	SpreadPct  float64   `json:"spreadPct"`
+	Vol24Hr    float64   `json:"vol24Hr"`
+	TrustScore string    `json:"trustScore"`
+	Stale      bool      `json:"stale"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type VenueQuote struct {
+	Exchange string  `json:"exchange"`
+	Pair     string  `json:"pair"`
+	Price    float64 `json:"price"`
+}
+
+type TickerSummary struct {
+	Venues              int        `json:"venues"`
+	BestBid             VenueQuote `json:"bestBid"`
+	BestAsk             VenueQuote `json:"bestAsk"`
+	CrossVenueSpreadPct float64    `json:"crossVenueSpreadPct"`
+	Arbitrage           bool       `json:"arbitrage"`
+}
+
+type TickersResponse struct {
+	ID      string           `json:"id"`
+	Tickers []ExchangeTicker `json:"tickers"`
+	Summary TickerSummary    `json:"summary"`
+}
+
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Price     float64   `json:"price"`
+	MarketCap float64   `json:"marketCap"`
+	Vol24Hr   float64   `json:"vol24Hr"`
+}
+
+type HistoryResponse struct {
+	ID     string         `json:"id"`
+	Days   int            `json:"days"`
+	Points []HistoryPoint `json:"points"`
+}
+
+type APIError struct {
+	Status  int          `json:"status"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+type FieldError struct {
+	In      string `json:"in"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Problem struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Instance   string       `json:"instance,omitempty"`
+	Code       string       `json:"code"`
+	RetryAfter int          `json:"retryAfter,omitempty"`
+	Ticker     string       `json:"ticker,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`
+}
+
+type Meta struct {
+	RequestID string    `json:"requestId"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Meta  Meta        `json:"meta"`
+	Error *APIError   `json:"error"`
+}
+
+type StreamRequest struct {
+	Action  string   `json:"action"`
+	Tickers []string `json:"tickers"`
+}
+
+type StreamMessage struct {
+	Type    string          `json:"type"`
+	Tickers []string        `json:"tickers,omitempty"`
+	Prices  []PriceResponse `json:"prices,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type AlertRule struct {
+	ID              string     `json:"id"`
+	Owner           string     `json:"owner,omitempty"`
+	Ticker          string     `json:"ticker"`
+	Kind            string     `json:"kind"`
+	Threshold       float64    `json:"threshold"`
+	Window          string     `json:"window,omitempty"`
+	Cooldown        string     `json:"cooldown,omitempty"`
+	WebhookID       string     `json:"webhookId"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastTriggeredAt *time.Time `json:"lastTriggeredAt,omitempty"`
+}
+
+type AlertEvent struct {
+	Rule        AlertRule     `json:"rule"`
+	Quote       PriceResponse `json:"quote"`
+	Value       float64       `json:"value"`
+	Message     string        `json:"message"`
+	TriggeredAt time.Time     `json:"triggeredAt"`
+}
+
+type Holding struct {
+	Coin      string   `json:"coin"`
+	Amount    float64  `json:"amount"`
+	TotalCost *float64 `json:"totalCost,omitempty"` // What the whole amount cost in the quote currency, not a price per coin.
+}
+
+type PortfolioRequest struct {
+	Currency string    `json:"currency"`
+	Holdings []Holding `json:"holdings"`
+}
+
+type PositionValue struct {
+	Coin             string    `json:"coin"`
+	Amount           float64   `json:"amount"`
+	Price            float64   `json:"price"`
+	Value            float64   `json:"value"`
+	WeightPct        float64   `json:"weightPct"`
+	TotalCost        *float64  `json:"totalCost,omitempty"`
+	UnrealisedPnl    *float64  `json:"unrealisedPnl,omitempty"`
+	UnrealisedPnlPct *float64  `json:"unrealisedPnlPct,omitempty"`
+	QuoteTimestamp   time.Time `json:"quoteTimestamp"`
+	Stale            bool      `json:"stale"`
+}
+
+type PortfolioValuation struct {
+	Currency      string          `json:"currency"`
+	Total         float64         `json:"total"`
+	TotalCost     *float64        `json:"totalCost,omitempty"`     // Sum over the positions with a total cost.
+	UnrealisedPnl *float64        `json:"unrealisedPnl,omitempty"` // Sum over the positions with a total cost.
+	Positions     []PositionValue `json:"positions"`
+	Stale         []string        `json:"stale"`   // Coins whose quote is older than the staleness limit.
+	Missing       []string        `json:"missing"` // Coins CoinGecko has no quote for, left out of the total.
+	Timestamp     time.Time       `json:"timestamp"`
+}